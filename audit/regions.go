@@ -0,0 +1,158 @@
+// Package audit looks for likely mistakes in the formulas of a sheet,
+// such as a formula differing from the ones copied around it.
+package audit
+
+import (
+	"github.com/usr-ein/excelparser/parser"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+// Fingerprint returns the formula of host in R1C1 notation, which is the same
+// for every copy of a formula, e.g. =R[-1]C+1 for =A1+1 in A2 and =B1+1 in B2.
+func Fingerprint(f xl.Formula, host xl.Cell) (xl.Formula, error) {
+	node, err := parser.Parse(string(f), host.Sheet)
+	if err != nil {
+		return "", err
+	}
+	return parser.StringifyNodeR1C1(node, host), nil
+}
+
+// Region is a rectangle of adjacent cells holding copies of the same formula.
+type Region struct {
+	// Cells of the region, with RowRel and ColRel set to false
+	Range xl.Range
+	// Formula of the top left cell of the region, as written in it
+	Formula xl.Formula
+	// The formula in R1C1 notation, shared by every cell of the region,
+	// or as written if it doesn't parse
+	Fingerprint xl.Formula
+}
+
+// Inconsistency is a formula that differs from the ones on both sides of it,
+// in its row or in its column, while those are copies of each other.
+// This is what Excel warns about as an "inconsistent formula".
+type Inconsistency struct {
+	Cell    xl.Cell
+	Formula xl.Formula
+	// Formula of the cell had it been copied like its neighbours, or "" if that copy
+	// would reference cells off the sheet, or if the neighbours are formulas that don't parse
+	Expected xl.Formula
+}
+
+// fingerprints returns the fingerprint of every formula cell of the sheet,
+// with "" for the other cells. Formulas that don't parse are their own fingerprint,
+// so that only the same text copied around them matches them.
+func fingerprints(sheet *xl.Sheet) [][]xl.Formula {
+	fps := make([][]xl.Formula, len(sheet.Content))
+	for i, row := range sheet.Content {
+		fps[i] = make([]xl.Formula, len(row))
+		for j, val := range row {
+			if val.Type != xl.CTFormula {
+				continue
+			}
+			host := xl.Cell{Sheet: sheet.Name, Row: uint32(i), Col: uint16(j)}
+			fp, err := Fingerprint(val.ValFormula, host)
+			if err != nil {
+				fp = val.ValFormula
+			}
+			fps[i][j] = fp
+		}
+	}
+	return fps
+}
+
+// Regions groups the formula cells of the sheet into regions of copies of the same formula,
+// going from top to bottom and left to right. Each region extends as far right as it can,
+// then as far down, so a formula copied over a block makes a single region.
+// Formula cells without copies next to them make regions of their own,
+// and so do formulas that don't parse, unless the same text is next to them.
+func Regions(sheet *xl.Sheet) []Region {
+	fps := fingerprints(sheet)
+	taken := make([][]bool, len(fps))
+	for i := range fps {
+		taken[i] = make([]bool, len(fps[i]))
+	}
+	// Tells whether cell (i, j) is free and holds the given fingerprint
+	matches := func(i, j int, fp xl.Formula) bool {
+		return i < len(fps) && j < len(fps[i]) && !taken[i][j] && fps[i][j] == fp
+	}
+
+	regions := make([]Region, 0)
+	for i, row := range fps {
+		for j, fp := range row {
+			if fp == "" || taken[i][j] {
+				continue
+			}
+			endCol := j + 1
+			for matches(i, endCol, fp) {
+				endCol++
+			}
+			endRow := i + 1
+			for rowMatches(endRow, j, endCol, fp, matches) {
+				endRow++
+			}
+			for k := i; k < endRow; k++ {
+				for l := j; l < endCol; l++ {
+					taken[k][l] = true
+				}
+			}
+			regions = append(regions, Region{
+				Range: xl.Range{
+					Start: xl.Cell{Sheet: sheet.Name, Row: uint32(i), Col: uint16(j)},
+					End:   xl.Cell{Sheet: sheet.Name, Row: uint32(endRow), Col: uint16(endCol)},
+				},
+				Formula:     sheet.Content[i][j].ValFormula,
+				Fingerprint: fp,
+			})
+		}
+	}
+	return regions
+}
+
+// rowMatches tells whether the columns from start to end (excluded) of row i all match fp.
+func rowMatches(i, start, end int, fp xl.Formula, matches func(i, j int, fp xl.Formula) bool) bool {
+	for j := start; j < end; j++ {
+		if !matches(i, j, fp) {
+			return false
+		}
+	}
+	return true
+}
+
+// Inconsistencies lists the formulas of the sheet that differ from their neighbours,
+// from top to bottom and left to right. See Inconsistency.
+// Formulas that don't parse differ from the ones around them, unless they are the same text.
+func Inconsistencies(sheet *xl.Sheet) []Inconsistency {
+	fps := fingerprints(sheet)
+	at := func(i, j int) xl.Formula {
+		if i < 0 || i >= len(fps) || j < 0 || j >= len(fps[i]) {
+			return ""
+		}
+		return fps[i][j]
+	}
+
+	found := make([]Inconsistency, 0)
+	for i, row := range fps {
+		for j, fp := range row {
+			if fp == "" {
+				continue
+			}
+			expected := xl.Formula("")
+			if above := at(i-1, j); above != "" && above == at(i+1, j) && above != fp {
+				expected = above
+			} else if left := at(i, j-1); left != "" && left == at(i, j+1) && left != fp {
+				expected = left
+			}
+			if expected == "" {
+				continue
+			}
+			host := xl.Cell{Sheet: sheet.Name, Row: uint32(i), Col: uint16(j)}
+			inconsistency := Inconsistency{Cell: host, Formula: sheet.Content[i][j].ValFormula}
+			if node, err := parser.ParseR1C1(string(expected), host); err == nil {
+				inconsistency.Expected = parser.StringifyNode(node, sheet.Name)
+			}
+			found = append(found, inconsistency)
+		}
+	}
+	return found
+}
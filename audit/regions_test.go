@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"testing"
+
+	"github.com/usr-ein/excelparser/xl"
+)
+
+func buildSheet(t *testing.T, content [][]any) *xl.Sheet {
+	raw := xl.RawSheet{Name: "Sheet1", Content: content}
+	sheet, err := raw.ToSheet()
+	if err != nil {
+		t.Fatalf("ToSheet failed with %s", err)
+	}
+	return &sheet
+}
+
+func TestFingerprint(t *testing.T) {
+	a, err := Fingerprint("=SUM($A$1:A2)*B2", xl.Cell{Sheet: "Sheet1", Row: 1, Col: 2})
+	if err != nil {
+		t.Fatalf("Fingerprint failed with %s", err)
+	}
+	b, err := Fingerprint("=SUM($A$1:A3)*B3", xl.Cell{Sheet: "Sheet1", Row: 2, Col: 2})
+	if err != nil {
+		t.Fatalf("Fingerprint failed with %s", err)
+	}
+	if a != b {
+		t.Errorf("copies have different fingerprints %s and %s", a, b)
+	}
+}
+
+func TestRegions(t *testing.T) {
+	sheet := buildSheet(t, [][]any{
+		{1, 2, "=A1+B1", "=A1*2", "=B1*2"},
+		{3, 4, "=A2+B2", "=A2*2", "=B2*2"},
+		{5, 6, "=A3+B3", "=A3*2", "=B3*2"},
+		{7, 8, "=A4-B4", "=SUM(C1:C3)", nil},
+	})
+	regions := Regions(sheet)
+	expected := []struct {
+		rng     string
+		formula xl.Formula
+	}{
+		{"Sheet1!$C$1:$C$3", "=A1+B1"},
+		{"Sheet1!$D$1:$E$3", "=A1*2"},
+		{"Sheet1!$C$4:$C$4", "=A4-B4"},
+		{"Sheet1!$D$4:$D$4", "=SUM(C1:C3)"},
+	}
+	if len(regions) != len(expected) {
+		t.Fatalf("got %d regions %+v; want %d", len(regions), regions, len(expected))
+	}
+	for i, want := range expected {
+		if got := regions[i].Range.String(); got != want.rng {
+			t.Errorf("region %d is %s; want %s", i, got, want.rng)
+		}
+		if got := regions[i].Formula; got != want.formula {
+			t.Errorf("region %d has formula %s; want %s", i, got, want.formula)
+		}
+	}
+	if got := regions[1].Fingerprint; got != "=RC[-3]*2" {
+		t.Errorf("region 1 has fingerprint %s; want =RC[-3]*2", got)
+	}
+}
+
+func TestInconsistencies(t *testing.T) {
+	sheet := buildSheet(t, [][]any{
+		{1, 10, "=A1*B1", "=C1", "=D1", "=E1"},
+		{2, 20, "=A2*B2", nil, nil, nil},
+		{3, 30, "=A3+B3", nil, nil, nil},
+		{4, 40, "=A4*B4", "=C4", "=C4", "=E4"},
+		{5, 50, "=A5*B5", nil, nil, nil},
+	})
+	found := Inconsistencies(sheet)
+	expected := []Inconsistency{
+		{Cell: xl.Cell{Sheet: "Sheet1", Row: 2, Col: 2}, Formula: "=A3+B3", Expected: "=A3*B3"},
+		{Cell: xl.Cell{Sheet: "Sheet1", Row: 3, Col: 4}, Formula: "=C4", Expected: "=D4"},
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("got %d inconsistencies %+v; want %d", len(found), found, len(expected))
+	}
+	for i, want := range expected {
+		if found[i] != want {
+			t.Errorf("inconsistency %d is %+v; want %+v", i, found[i], want)
+		}
+	}
+}
+
+func TestRegionsBadFormula(t *testing.T) {
+	sheet := buildSheet(t, [][]any{
+		{1, "=A1*2", "=SUM(A1"},
+		{2, "=A2*2", "=SUM(A1"},
+		{3, "=(A3", "=A3*2"},
+		{4, "=A4*2", "=A4*2"},
+	})
+	regions := Regions(sheet)
+	expected := []struct {
+		rng         string
+		fingerprint xl.Formula
+	}{
+		{"Sheet1!$B$1:$B$2", "=RC[-1]*2"},
+		{"Sheet1!$C$1:$C$2", "=SUM(A1"},
+		{"Sheet1!$B$3:$B$3", "=(A3"},
+		{"Sheet1!$C$3:$C$4", "=RC[-2]*2"},
+		{"Sheet1!$B$4:$B$4", "=RC[-1]*2"},
+	}
+	if len(regions) != len(expected) {
+		t.Fatalf("got %d regions %+v; want %d", len(regions), regions, len(expected))
+	}
+	for i, want := range expected {
+		if got := regions[i].Range.String(); got != want.rng || regions[i].Fingerprint != want.fingerprint {
+			t.Errorf("region %d is %s with %s; want %s with %s", i, got, regions[i].Fingerprint, want.rng, want.fingerprint)
+		}
+	}
+
+	found := Inconsistencies(sheet)
+	want := Inconsistency{Cell: xl.Cell{Sheet: "Sheet1", Row: 2, Col: 1}, Formula: "=(A3", Expected: "=A3*2"}
+	if len(found) != 1 || found[0] != want {
+		t.Errorf("got inconsistencies %+v; want %+v", found, want)
+	}
+}
+
+func TestInconsistenciesBetweenBadFormulas(t *testing.T) {
+	sheet := buildSheet(t, [][]any{
+		{1, "=SUM(A1"},
+		{2, "=A2*2"},
+		{3, "=SUM(A1"},
+	})
+	// There is no copy of the formulas around it to expect
+	found := Inconsistencies(sheet)
+	want := Inconsistency{Cell: xl.Cell{Sheet: "Sheet1", Row: 1, Col: 1}, Formula: "=A2*2"}
+	if len(found) != 1 || found[0] != want {
+		t.Errorf("got inconsistencies %+v; want %+v", found, want)
+	}
+}
@@ -0,0 +1,170 @@
+package depgraph
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/usr-ein/excelparser/xl"
+)
+
+// CircularReferenceError lists the groups of formula cells that depend on each other.
+type CircularReferenceError struct {
+	// Each cycle is a strongly connected component of the graph, in workbook order
+	Cycles [][]xl.Cell
+}
+
+func (e *CircularReferenceError) Error() string {
+	cycles := make([]string, len(e.Cycles))
+	for i, cycle := range e.Cycles {
+		addresses := make([]string, len(cycle))
+		for j, c := range cycle {
+			addresses[j] = string(c.ToAddress())
+		}
+		cycles[i] = "[" + strings.Join(addresses, ", ") + "]"
+	}
+	return fmt.Sprintf("circular references: %s", strings.Join(cycles, ", "))
+}
+
+// Cycles returns the groups of formula cells that depend on each other,
+// using Tarjan's strongly connected components algorithm.
+// A formula referencing itself is a cycle of one cell.
+func (g *Graph) Cycles() [][]xl.Cell {
+	t := tarjan{
+		g:       g,
+		index:   make(map[xl.Cell]int),
+		lowLink: make(map[xl.Cell]int),
+		onStack: make(map[xl.Cell]bool),
+	}
+	for _, c := range g.Formulas() {
+		if _, visited := t.index[c]; !visited {
+			t.strongConnect(c)
+		}
+	}
+	cycles := make([][]xl.Cell, 0)
+	for _, scc := range t.components {
+		if len(scc) == 1 && !g.dependsOn(scc[0], scc[0]) {
+			continue
+		}
+		g.sort(scc)
+		cycles = append(cycles, scc)
+	}
+	// Report the cycles in the order of their first cell
+	compare := g.cellOrder()
+	slices.SortFunc(cycles, func(a, b []xl.Cell) int {
+		return compare(a[0], b[0])
+	})
+	return cycles
+}
+
+// RecalcOrder returns the formula cells in an order where every formula
+// comes after the formulas it references. If there are circular references,
+// the cells that are not part of, nor depend on, a cycle are still returned,
+// along with a *CircularReferenceError.
+func (g *Graph) RecalcOrder() ([]xl.Cell, error) {
+	return g.Order(g.Formulas())
+}
+
+// Order is like RecalcOrder, but only sorts a subset of the formula cells,
+// e.g. the ones affected by a change. Dependencies on formulas outside of the subset are ignored.
+// It uses Kahn's algorithm.
+func (g *Graph) Order(cells []xl.Cell) ([]xl.Cell, error) {
+	cells = slices.Clone(cells)
+	inSubset := make(map[xl.Cell]bool, len(cells))
+	for i, c := range cells {
+		cells[i] = g.key(c)
+		inSubset[cells[i]] = true
+	}
+	inDegree := make(map[xl.Cell]int, len(cells))
+	successors := make(map[xl.Cell][]xl.Cell, len(cells))
+	for _, c := range cells {
+		seen := make(map[xl.Cell]bool)
+		g.forEachDependent(c, func(d xl.Cell) {
+			if !inSubset[d] || seen[d] {
+				return
+			}
+			seen[d] = true
+			successors[c] = append(successors[c], d)
+			inDegree[d]++
+		})
+	}
+
+	order := make([]xl.Cell, 0, len(cells))
+	queue := make([]xl.Cell, 0)
+	for _, c := range cells {
+		if inDegree[c] == 0 {
+			queue = append(queue, c)
+		}
+	}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		order = append(order, c)
+		for _, d := range successors[c] {
+			inDegree[d]--
+			if inDegree[d] == 0 {
+				queue = append(queue, d)
+			}
+		}
+	}
+	if len(order) != len(cells) {
+		cycles := make([][]xl.Cell, 0)
+		for _, cycle := range g.Cycles() {
+			if slices.ContainsFunc(cycle, func(c xl.Cell) bool { return inSubset[c] }) {
+				cycles = append(cycles, cycle)
+			}
+		}
+		return order, &CircularReferenceError{Cycles: cycles}
+	}
+	return order, nil
+}
+
+func (g *Graph) dependsOn(dependent xl.Cell, precedent xl.Cell) bool {
+	found := false
+	g.forEachDependent(precedent, func(d xl.Cell) {
+		found = found || d == dependent
+	})
+	return found
+}
+
+type tarjan struct {
+	g          *Graph
+	counter    int
+	index      map[xl.Cell]int
+	lowLink    map[xl.Cell]int
+	stack      []xl.Cell
+	onStack    map[xl.Cell]bool
+	components [][]xl.Cell
+}
+
+func (t *tarjan) strongConnect(c xl.Cell) {
+	t.index[c] = t.counter
+	t.lowLink[c] = t.counter
+	t.counter++
+	t.stack = append(t.stack, c)
+	t.onStack[c] = true
+
+	t.g.forEachDependent(c, func(d xl.Cell) {
+		if _, visited := t.index[d]; !visited {
+			t.strongConnect(d)
+			t.lowLink[c] = min(t.lowLink[c], t.lowLink[d])
+		} else if t.onStack[d] {
+			t.lowLink[c] = min(t.lowLink[c], t.index[d])
+		}
+	})
+
+	if t.lowLink[c] != t.index[c] {
+		return
+	}
+	component := make([]xl.Cell, 0)
+	for {
+		top := t.stack[len(t.stack)-1]
+		t.stack = t.stack[:len(t.stack)-1]
+		t.onStack[top] = false
+		component = append(component, top)
+		if top == c {
+			break
+		}
+	}
+	t.components = append(t.components, component)
+}
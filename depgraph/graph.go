@@ -0,0 +1,315 @@
+// Package depgraph builds the dependency graph of the formulas of a workbook,
+// to know in which order they must be computed and which ones a change affects.
+package depgraph
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/usr-ein/excelparser/parser"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+// Graph links every formula cell of a workbook to the cells and ranges it references.
+// Cells are identified regardless of their relativeness, with RowRel and ColRel set to false.
+type Graph struct {
+	wb *xl.Workbook
+
+	// Parsed formula of each formula cell
+	formulas map[xl.Cell]parser.Node
+	// Direct references of each formula cell, as ranges
+	precedents map[xl.Cell][]xl.Range
+	// Formula cells referencing a single cell
+	cellDependents map[xl.Cell]map[xl.Cell]struct{}
+	// Formula cells referencing a range of more than one cell
+	rangeDependents *rangeIndex
+	// Formula cells whose formula doesn't parse, with their parse error
+	unparsed map[xl.Cell]error
+}
+
+// Build parses every formula of the workbook and links it to its references.
+// Formulas that don't parse are left out of the graph, see Unparsed.
+func Build(wb *xl.Workbook) *Graph {
+	g := &Graph{
+		wb:              wb,
+		formulas:        make(map[xl.Cell]parser.Node),
+		precedents:      make(map[xl.Cell][]xl.Range),
+		cellDependents:  make(map[xl.Cell]map[xl.Cell]struct{}),
+		rangeDependents: newRangeIndex(),
+		unparsed:        make(map[xl.Cell]error),
+	}
+	for _, sheet := range wb.Sheets {
+		for i, row := range sheet.Content {
+			for j, val := range row {
+				if val.Type != xl.CTFormula {
+					continue
+				}
+				cell := xl.Cell{Sheet: sheet.Name, Row: uint32(i), Col: uint16(j)}
+				node, err := parser.Parse(string(val.ValFormula), sheet.Name)
+				if err != nil {
+					g.SetUnparsed(cell, err)
+					continue
+				}
+				g.SetFormula(cell, node)
+			}
+		}
+	}
+	return g
+}
+
+// SetFormula sets the formula of a cell, replacing its previous references if any.
+func (g *Graph) SetFormula(c xl.Cell, n parser.Node) {
+	c = g.key(c)
+	g.Remove(c)
+	refs := make([]xl.Range, 0)
+	for _, r := range g.references(c, n, make(map[xl.DefinedName]bool)) {
+		r = g.canonical(r)
+		refs = append(refs, r)
+		if isSingleCell(r) {
+			if g.cellDependents[r.Start] == nil {
+				g.cellDependents[r.Start] = make(map[xl.Cell]struct{})
+			}
+			g.cellDependents[r.Start][c] = struct{}{}
+		} else {
+			g.rangeDependents.add(edge{precedent: r, dependent: c})
+		}
+	}
+	g.formulas[c] = n
+	g.precedents[c] = refs
+}
+
+// SetUnparsed records that the formula of a cell doesn't parse, with its parse error,
+// and forgets its previous formula: it doesn't depend on anything.
+func (g *Graph) SetUnparsed(c xl.Cell, err error) {
+	c = g.key(c)
+	g.Remove(c)
+	g.unparsed[c] = err
+}
+
+// Unparsed returns the formula cells whose formula doesn't parse, in workbook order,
+// with their parse error.
+func (g *Graph) Unparsed() ([]xl.Cell, []error) {
+	cells := make([]xl.Cell, 0, len(g.unparsed))
+	for c := range g.unparsed {
+		cells = append(cells, c)
+	}
+	g.sort(cells)
+	errs := make([]error, len(cells))
+	for i, c := range cells {
+		errs[i] = g.unparsed[c]
+	}
+	return cells, errs
+}
+
+// Remove forgets the formula of a cell, e.g. when it was replaced by a value.
+func (g *Graph) Remove(c xl.Cell) {
+	c = g.key(c)
+	delete(g.unparsed, c)
+	for _, r := range g.precedents[c] {
+		if isSingleCell(r) {
+			delete(g.cellDependents[r.Start], c)
+		} else {
+			g.rangeDependents.remove(edge{precedent: r, dependent: c})
+		}
+	}
+	delete(g.formulas, c)
+	delete(g.precedents, c)
+}
+
+// Formula returns the parsed formula of a cell, and false if the cell holds no formula.
+func (g *Graph) Formula(c xl.Cell) (parser.Node, bool) {
+	n, ok := g.formulas[g.key(c)]
+	return n, ok
+}
+
+// Formulas returns all the formula cells of the graph, in workbook order.
+func (g *Graph) Formulas() []xl.Cell {
+	cells := make([]xl.Cell, 0, len(g.formulas))
+	for c := range g.formulas {
+		cells = append(cells, c)
+	}
+	g.sort(cells)
+	return cells
+}
+
+// Precedents returns the cells and ranges a formula cell directly references.
+// Single cells are given as ranges of one cell.
+func (g *Graph) Precedents(c xl.Cell) []xl.Range {
+	return slices.Clone(g.precedents[g.key(c)])
+}
+
+// Dependents returns the formula cells directly referencing a cell,
+// either on its own or through a range.
+func (g *Graph) Dependents(c xl.Cell) []xl.Cell {
+	seen := make(map[xl.Cell]struct{})
+	g.forEachDependent(g.key(c), func(d xl.Cell) {
+		seen[d] = struct{}{}
+	})
+	cells := make([]xl.Cell, 0, len(seen))
+	for d := range seen {
+		cells = append(cells, d)
+	}
+	g.sort(cells)
+	return cells
+}
+
+// TransitiveDependents returns all the formula cells affected by a change of the given cells,
+// directly or through other formulas. The given cells are not included, unless they
+// depend on each other.
+func (g *Graph) TransitiveDependents(cells ...xl.Cell) []xl.Cell {
+	seen := make(map[xl.Cell]struct{})
+	queue := make([]xl.Cell, 0, len(cells))
+	for _, c := range cells {
+		queue = append(queue, g.key(c))
+	}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		g.forEachDependent(c, func(d xl.Cell) {
+			if _, ok := seen[d]; ok {
+				return
+			}
+			seen[d] = struct{}{}
+			queue = append(queue, d)
+		})
+	}
+	res := make([]xl.Cell, 0, len(seen))
+	for c := range seen {
+		res = append(res, c)
+	}
+	g.sort(res)
+	return res
+}
+
+// forEachDependent calls f for each formula directly referencing c,
+// possibly more than once for the same formula.
+func (g *Graph) forEachDependent(c xl.Cell, f func(xl.Cell)) {
+	for d := range g.cellDependents[c] {
+		f(d)
+	}
+	g.rangeDependents.dependents(c, f)
+}
+
+// References returns every cell and range a formula tree references, as ranges.
+func References(n parser.Node) []xl.Range {
+	refs := make([]xl.Range, 0)
+	parser.Inspect(n, func(n parser.Node) bool {
+		switch n.Type() {
+		case parser.NodeTypeCell:
+			c := key(n.(parser.CellNode).Cell)
+			refs = append(refs, xl.Range{Start: c, End: xl.Cell{Sheet: c.Sheet, Row: c.Row + 1, Col: c.Col + 1}})
+		case parser.NodeTypeSpillRef:
+			// The spill range is only known once the anchor is computed
+			c := key(n.(parser.SpillRefNode).Cell)
+			refs = append(refs, xl.Range{Start: c, End: xl.Cell{Sheet: c.Sheet, Row: c.Row + 1, Col: c.Col + 1}})
+		case parser.NodeTypeCellRange:
+			r := n.(parser.CellRangeNode).Range().Normalize()
+			r.Start, r.End = key(r.Start), key(r.End)
+			refs = append(refs, r)
+		}
+		return true
+	})
+	return refs
+}
+
+// references returns the references of a formula located in host, including
+// the ones of the defined names and the tables it uses.
+func (g *Graph) references(host xl.Cell, n parser.Node, seen map[xl.DefinedName]bool) []xl.Range {
+	refs := References(n)
+	for _, ref := range collect[parser.Ref3DNode](n) {
+		if ranges, err := ref.Expand(g.wb); err == nil {
+			for _, r := range ranges {
+				r = r.Normalize()
+				r.Start, r.End = key(r.Start), key(r.End)
+				refs = append(refs, r)
+			}
+		}
+	}
+	for _, ref := range collect[parser.StructuredRefNode](n) {
+		if r, err := g.wb.ResolveTableRef(ref.TableRef, host); err == nil {
+			refs = append(refs, r)
+		}
+	}
+	for _, name := range collect[parser.NameNode](n) {
+		lookup := name.Sheet
+		if lookup == "" {
+			lookup = host.Sheet
+		}
+		def, ok := g.wb.ResolveName(name.Name, lookup)
+		if !ok || seen[def] {
+			continue
+		}
+		seen[def] = true
+		resolved, err := parser.ResolveName(parser.Context{CurrentSheet: host.Sheet, Names: g.wb}, name)
+		if err != nil {
+			continue
+		}
+		refs = append(refs, g.references(host, resolved, seen)...)
+	}
+	return refs
+}
+
+// collect returns the nodes of type T of a formula tree.
+func collect[T parser.Node](n parser.Node) []T {
+	res := make([]T, 0)
+	parser.Inspect(n, func(n parser.Node) bool {
+		if t, ok := n.(T); ok {
+			res = append(res, t)
+		}
+		return true
+	})
+	return res
+}
+
+func key(c xl.Cell) xl.Cell {
+	return xl.Cell{Sheet: c.Sheet, Row: c.Row, Col: c.Col}
+}
+
+// key identifies a cell in the graph, regardless of its relativeness and of the case of its sheet name.
+func (g *Graph) key(c xl.Cell) xl.Cell {
+	return g.canonicalCell(key(c))
+}
+
+func isSingleCell(r xl.Range) bool {
+	return r.End.Row == r.Start.Row+1 && r.End.Col == r.Start.Col+1
+}
+
+// canonicalCell uses the workbook's spelling of the sheet name,
+// since references to sheets are case-insensitive.
+func (g *Graph) canonicalCell(c xl.Cell) xl.Cell {
+	if sheet, ok := g.wb.GetSheet(c.Sheet); ok {
+		c.Sheet = sheet.Name
+	}
+	return c
+}
+
+func (g *Graph) canonical(r xl.Range) xl.Range {
+	return xl.Range{Start: g.canonicalCell(r.Start), End: g.canonicalCell(r.End)}
+}
+
+// sort orders cells by sheet position in the workbook, then row, then column.
+func (g *Graph) sort(cells []xl.Cell) {
+	slices.SortFunc(cells, g.cellOrder())
+}
+
+// cellOrder returns the comparison function used by sort.
+func (g *Graph) cellOrder() func(a, b xl.Cell) int {
+	sheetIndex := make(map[string]int, len(g.wb.Sheets))
+	for i, sheet := range g.wb.Sheets {
+		sheetIndex[sheet.Name] = i
+	}
+	return func(a, b xl.Cell) int {
+		if a.Sheet != b.Sheet {
+			ia, oka := sheetIndex[a.Sheet]
+			ib, okb := sheetIndex[b.Sheet]
+			if oka && okb {
+				return cmp.Compare(ia, ib)
+			}
+			return cmp.Compare(a.Sheet, b.Sheet)
+		}
+		if a.Row != b.Row {
+			return cmp.Compare(a.Row, b.Row)
+		}
+		return cmp.Compare(a.Col, b.Col)
+	}
+}
@@ -0,0 +1,200 @@
+package depgraph
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/usr-ein/excelparser/xl"
+)
+
+func buildWorkbook(t *testing.T, sheets ...xl.RawSheet) *xl.Workbook {
+	wb := &xl.Workbook{Name: "Book1"}
+	for _, raw := range sheets {
+		sheet, err := raw.ToSheet()
+		if err != nil {
+			t.Fatalf("ToSheet failed with %s", err)
+		}
+		wb.Sheets = append(wb.Sheets, sheet)
+	}
+	return wb
+}
+
+func addresses(cells []xl.Cell) []string {
+	res := make([]string, len(cells))
+	for i, c := range cells {
+		res[i] = string(c.ToAddress())
+	}
+	return res
+}
+
+func mustCell(t *testing.T, address string) xl.Cell {
+	c, err := xl.ParseCell(address, "Sheet1")
+	if err != nil {
+		t.Fatalf("ParseCell(%s) failed with %s", address, err)
+	}
+	return c
+}
+
+func TestGraphQueries(t *testing.T) {
+	wb := buildWorkbook(t,
+		xl.RawSheet{
+			Name: "Sheet1",
+			Content: [][]any{
+				{1, 2, "=A1+B1"},
+				{3, "=SUM(A1:A2)", "=C1*B2"},
+			},
+		},
+		xl.RawSheet{
+			Name:    "Sheet2",
+			Content: [][]any{{"=sheet1!C2+1"}},
+		},
+	)
+	g := Build(wb)
+
+	if got := addresses(g.Dependents(mustCell(t, "A1"))); !slices.Equal(got, []string{"Sheet1!$C$1", "Sheet1!$B$2"}) {
+		t.Errorf("Dependents(A1) = %v", got)
+	}
+	if got := addresses(g.Dependents(mustCell(t, "A2"))); !slices.Equal(got, []string{"Sheet1!$B$2"}) {
+		t.Errorf("Dependents(A2) = %v", got)
+	}
+	precedents := g.Precedents(mustCell(t, "C2"))
+	if len(precedents) != 2 || precedents[0].StringRel("") != "Sheet1!$C$1:$C$1" || precedents[1].StringRel("") != "Sheet1!$B$2:$B$2" {
+		t.Errorf("Precedents(C2) = %v", precedents)
+	}
+	if got := addresses(g.TransitiveDependents(mustCell(t, "A1"))); !slices.Equal(got, []string{"Sheet1!$C$1", "Sheet1!$B$2", "Sheet1!$C$2", "Sheet2!$A$1"}) {
+		t.Errorf("TransitiveDependents(A1) = %v", got)
+	}
+
+	order, err := g.RecalcOrder()
+	if err != nil {
+		t.Fatalf("RecalcOrder failed with %s", err)
+	}
+	position := make(map[xl.Cell]int)
+	for i, c := range order {
+		position[c] = i
+	}
+	for _, c := range order {
+		for _, r := range g.Precedents(c) {
+			if p, ok := position[r.Start]; ok && p > position[c] {
+				t.Errorf("%s is computed before its precedent %s", c.ToAddress(), r.Start.ToAddress())
+			}
+		}
+	}
+	if len(order) != 4 {
+		t.Errorf("RecalcOrder returned %d cells; want 4", len(order))
+	}
+}
+
+func TestGraphCycles(t *testing.T) {
+	wb := buildWorkbook(t, xl.RawSheet{
+		Name: "Sheet1",
+		Content: [][]any{
+			{"=B1", "=C1", "=A1", 1},
+			{"=A2", "=SUM(A1:D1)", "=D1*2", nil},
+		},
+	})
+	g := Build(wb)
+	cycles := g.Cycles()
+	if len(cycles) != 2 {
+		t.Fatalf("Cycles() = %v; want 2 cycles", cycles)
+	}
+	if got := addresses(cycles[0]); !slices.Equal(got, []string{"Sheet1!$A$1", "Sheet1!$B$1", "Sheet1!$C$1"}) {
+		t.Errorf("Cycles()[0] = %v", got)
+	}
+	if got := addresses(cycles[1]); !slices.Equal(got, []string{"Sheet1!$A$2"}) {
+		t.Errorf("Cycles()[1] = %v", got)
+	}
+
+	order, err := g.RecalcOrder()
+	var circErr *CircularReferenceError
+	if !errors.As(err, &circErr) {
+		t.Fatalf("RecalcOrder error = %v; want a CircularReferenceError", err)
+	}
+	if len(circErr.Cycles) != 2 {
+		t.Errorf("CircularReferenceError has %d cycles; want 2", len(circErr.Cycles))
+	}
+	// Only C2 doesn't depend on a cycle
+	if got := addresses(order); !slices.Equal(got, []string{"Sheet1!$C$2"}) {
+		t.Errorf("RecalcOrder() = %v", got)
+	}
+}
+
+func TestGraphNames(t *testing.T) {
+	wb := buildWorkbook(t,
+		xl.RawSheet{
+			Name:    "Sheet1",
+			Content: [][]any{{1, 2, "=Total*Rate"}},
+		},
+	)
+	wb.Names = xl.DefinedNames{
+		{Name: "Total", RefersTo: "=SUM(Sheet1!$A$1:$B$1)"},
+		{Name: "Rate", RefersTo: "=Sheet1!$D$1"},
+		// Names defined in terms of themselves don't hang the graph
+		{Name: "Loop", RefersTo: "=Loop"},
+	}
+	wb.Sheets[0].Content[0] = append(wb.Sheets[0].Content[0], xl.CVal{Type: xl.CTFormula, ValFormula: "=Loop"})
+	g := Build(wb)
+	if got := addresses(g.Dependents(mustCell(t, "B1"))); !slices.Equal(got, []string{"Sheet1!$C$1"}) {
+		t.Errorf("Dependents(B1) = %v", got)
+	}
+	if got := addresses(g.Dependents(mustCell(t, "D1"))); !slices.Equal(got, []string{"Sheet1!$C$1"}) {
+		t.Errorf("Dependents(D1) = %v", got)
+	}
+}
+
+func TestGraphStructuredRefs(t *testing.T) {
+	wb := buildWorkbook(t,
+		xl.RawSheet{
+			Name:    "Sheet1",
+			Content: [][]any{{"Qty", "Double"}, {1, "=[@Qty]*2"}, {2, "=[@Qty]*2"}, {"=SUM(Items[Qty])", nil}},
+		},
+	)
+	ref, _ := xl.ParseRange("A1:B3", "Sheet1")
+	wb.Tables = xl.Tables{{Name: "Items", Ref: ref, Columns: []string{"Qty", "Double"}, Headers: true}}
+	g := Build(wb)
+	if got := addresses(g.Dependents(mustCell(t, "A3"))); !slices.Equal(got, []string{"Sheet1!$B$3", "Sheet1!$A$4"}) {
+		t.Errorf("Dependents(A3) = %v", got)
+	}
+}
+
+func TestGraphRef3D(t *testing.T) {
+	wb := buildWorkbook(t,
+		xl.RawSheet{Name: "Summary", Content: [][]any{{"=SUM(Jan:Mar!A1)"}}},
+		xl.RawSheet{Name: "Jan", Content: [][]any{{1}}},
+		xl.RawSheet{Name: "Feb", Content: [][]any{{2}}},
+		xl.RawSheet{Name: "Mar", Content: [][]any{{3}}},
+	)
+	g := Build(wb)
+	feb, _ := xl.ParseCell("Feb!A1", "")
+	if got := addresses(g.Dependents(feb)); !slices.Equal(got, []string{"Summary!$A$1"}) {
+		t.Errorf("Dependents(Feb!A1) = %v", got)
+	}
+}
+
+func TestGraphUnparsed(t *testing.T) {
+	wb := buildWorkbook(t, xl.RawSheet{
+		Name:    "Sheet1",
+		Content: [][]any{{1, "=SUM(A1", "=A1*2"}, {"=B1+1", "=IF(A1", nil}},
+	})
+	g := Build(wb)
+
+	cells, errs := g.Unparsed()
+	if got := addresses(cells); !slices.Equal(got, []string{"Sheet1!$B$1", "Sheet1!$B$2"}) || len(errs) != 2 {
+		t.Errorf("Unparsed() = %v, %v", got, errs)
+	}
+	if _, ok := g.Formula(mustCell(t, "B1")); ok {
+		t.Errorf("B1 has a formula although it doesn't parse")
+	}
+	if got := addresses(g.Dependents(mustCell(t, "A1"))); !slices.Equal(got, []string{"Sheet1!$C$1"}) {
+		t.Errorf("Dependents(A1) = %v", got)
+	}
+	if got := addresses(g.Dependents(mustCell(t, "B1"))); !slices.Equal(got, []string{"Sheet1!$A$2"}) {
+		t.Errorf("Dependents(B1) = %v", got)
+	}
+
+	g.Remove(mustCell(t, "B1"))
+	if cells, _ := g.Unparsed(); len(cells) != 1 {
+		t.Errorf("Unparsed() = %v after removing B1", addresses(cells))
+	}
+}
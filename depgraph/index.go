@@ -0,0 +1,83 @@
+package depgraph
+
+import "github.com/usr-ein/excelparser/xl"
+
+// Rows per bucket of the range index
+const blockSize = 256
+
+// Ranges spanning more buckets than this are kept aside and scanned linearly,
+// so that whole columns don't end up copied in thousands of buckets.
+const maxBlocks = 64
+
+type edge struct {
+	precedent xl.Range
+	dependent xl.Cell
+}
+
+// rangeIndex finds the formula cells depending on ranges containing a given cell,
+// without scanning every range of the workbook.
+type rangeIndex struct {
+	buckets map[string]map[uint32][]edge
+	tall    map[string][]edge
+}
+
+func newRangeIndex() *rangeIndex {
+	return &rangeIndex{
+		buckets: make(map[string]map[uint32][]edge),
+		tall:    make(map[string][]edge),
+	}
+}
+
+func (idx *rangeIndex) blocks(r xl.Range) (first uint32, last uint32) {
+	return r.Start.Row / blockSize, (r.End.Row - 1) / blockSize
+}
+
+func (idx *rangeIndex) add(e edge) {
+	sheet := e.precedent.Start.Sheet
+	first, last := idx.blocks(e.precedent)
+	if last-first >= maxBlocks {
+		idx.tall[sheet] = append(idx.tall[sheet], e)
+		return
+	}
+	if idx.buckets[sheet] == nil {
+		idx.buckets[sheet] = make(map[uint32][]edge)
+	}
+	for b := first; b <= last; b++ {
+		idx.buckets[sheet][b] = append(idx.buckets[sheet][b], e)
+	}
+}
+
+func (idx *rangeIndex) remove(e edge) {
+	sheet := e.precedent.Start.Sheet
+	first, last := idx.blocks(e.precedent)
+	if last-first >= maxBlocks {
+		idx.tall[sheet] = removeEdge(idx.tall[sheet], e)
+		return
+	}
+	for b := first; b <= last; b++ {
+		idx.buckets[sheet][b] = removeEdge(idx.buckets[sheet][b], e)
+	}
+}
+
+func removeEdge(edges []edge, e edge) []edge {
+	for i, other := range edges {
+		if other == e {
+			return append(edges[:i], edges[i+1:]...)
+		}
+	}
+	return edges
+}
+
+// dependents calls f with the dependent of every range containing c.
+func (idx *rangeIndex) dependents(c xl.Cell, f func(xl.Cell)) {
+	for _, e := range idx.buckets[c.Sheet][c.Row/blockSize] {
+		if e.precedent.Contains(c) {
+			f(e.dependent)
+		}
+	}
+	for _, e := range idx.tall[c.Sheet] {
+		if e.precedent.Contains(c) {
+			f(e.dependent)
+		}
+	}
+}
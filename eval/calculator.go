@@ -0,0 +1,214 @@
+package eval
+
+import (
+	"slices"
+
+	"github.com/pkg/errors"
+	"github.com/usr-ein/excelparser/depgraph"
+	"github.com/usr-ein/excelparser/parser"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+// Calculator keeps the computed values of a workbook's formulas up to date.
+// Attach it to the workbook as its xl.Calculator, and changes made through
+// Workbook.SetCell only recompute the formulas depending on the changed cell.
+type Calculator struct {
+	graph *depgraph.Graph
+
+	// Loads the workbooks of external references, see Context.Workbooks.
+	Workbooks parser.WorkbookResolver
+}
+
+var _ xl.Calculator = (*Calculator)(nil)
+
+// NewCalculator builds the dependency graph of the workbook and attaches
+// the calculator to it. It doesn't compute anything, see RecalculateAll.
+// Formulas that don't parse compute to #NAME?, see depgraph.Graph.Unparsed.
+func NewCalculator(wb *xl.Workbook) *Calculator {
+	calc := &Calculator{graph: depgraph.Build(wb)}
+	wb.Calc = calc
+	return calc
+}
+
+// Graph returns the dependency graph the calculator maintains.
+func (calc *Calculator) Graph() *depgraph.Graph {
+	return calc.graph
+}
+
+// RecalculateAll computes every formula of the workbook.
+func (calc *Calculator) RecalculateAll(wb *xl.Workbook) error {
+	unparsed, _ := calc.graph.Unparsed()
+	for _, c := range unparsed {
+		if val, ok := cellPtr(wb, c); ok {
+			val.SetComputed(xl.CVal{Type: xl.CTError, ValError: xl.ErrorName})
+		}
+	}
+	return calc.recalculate(wb, calc.graph.Formulas())
+}
+
+// CellChanged updates the graph with the new content of c, then recomputes c
+// if it is a formula, and every formula depending on it, directly or not.
+// A formula that doesn't parse is taken out of the graph and computes to #NAME?,
+// and its parse error is returned once the formulas depending on it are recomputed.
+func (calc *Calculator) CellChanged(wb *xl.Workbook, c xl.Cell) error {
+	sheet, ok := wb.GetSheet(c.Sheet)
+	if !ok {
+		return errors.New("sheet not found")
+	}
+	val, err := sheet.Get(c)
+	if err != nil {
+		return err
+	}
+	dirty := calc.graph.TransitiveDependents(c)
+	// Writing over a spilled cell blocks its spill
+	if owner, ok := sheet.SpillOwner(c); ok && owner != c {
+		dirty = append(calc.graph.TransitiveDependents(c, owner), owner)
+	}
+	dirty = append(dirty, calc.unblocked(wb, c)...)
+	var parseErr error
+	if val.Type == xl.CTFormula {
+		node, err := parser.Parse(string(val.ValFormula), sheet.Name)
+		if err == nil {
+			calc.graph.SetFormula(c, node)
+			return calc.recalculate(wb, append(dirty, c))
+		}
+		parseErr = errors.Wrapf(err, "failed to parse formula in %s", c.ToAddress())
+		calc.graph.SetUnparsed(c, err)
+	} else {
+		calc.graph.Remove(c)
+	}
+	r, spilled := sheet.SpillRange(c)
+	sheet.ClearSpill(c)
+	if spilled {
+		dirty = append(dirty, calc.graph.TransitiveDependents(spillCells(sheet, r, c)...)...)
+	}
+	if parseErr != nil {
+		sheet.Content[c.Row][c.Col].SetComputed(xl.CVal{Type: xl.CTError, ValError: xl.ErrorName})
+	}
+	if err := calc.recalculate(wb, dirty); err != nil {
+		return err
+	}
+	return parseErr
+}
+
+// NamesChanged rebuilds the dependency graph, since formulas using the
+// changed names now depend on other cells, and recomputes every formula.
+func (calc *Calculator) NamesChanged(wb *xl.Workbook) error {
+	calc.graph = depgraph.Build(wb)
+	return calc.RecalculateAll(wb)
+}
+
+// recalculate recomputes the given formula cells, in dependency order.
+// Formulas computing to arrays spill them, and the formulas reading the cells
+// they spilled over are recomputed afterwards, once each.
+func (calc *Calculator) recalculate(wb *xl.Workbook, dirty []xl.Cell) error {
+	followedUp := make(map[xl.Cell]bool)
+	var cycleErr error
+	for len(dirty) > 0 {
+		spilled, err := calc.compute(wb, dirty)
+		var cycle *depgraph.CircularReferenceError
+		if errors.As(err, &cycle) {
+			// Computed anyway, like the rest of the cells
+			if cycleErr == nil {
+				cycleErr = err
+			}
+		} else if err != nil {
+			return err
+		}
+		dirty = make([]xl.Cell, 0)
+		// Cells no longer spilled over may unblock other spills
+		for _, c := range append(calc.graph.TransitiveDependents(spilled...), calc.unblocked(wb, spilled...)...) {
+			if !followedUp[c] {
+				followedUp[c] = true
+				dirty = append(dirty, c)
+			}
+		}
+	}
+	return cycleErr
+}
+
+// compute recomputes the given formula cells, in dependency order,
+// and returns the cells whose spilled values changed. Like with Graph.Order,
+// circular references don't stop the computation, their error is returned last.
+func (calc *Calculator) compute(wb *xl.Workbook, dirty []xl.Cell) ([]xl.Cell, error) {
+	// Forget the stale values first, so that nothing reads them
+	// if the order is broken by a circular reference.
+	for _, c := range dirty {
+		if val, ok := cellPtr(wb, c); ok {
+			val.HasComputed = false
+		}
+	}
+	spilled := make([]xl.Cell, 0)
+	order, orderErr := calc.graph.Order(dirty)
+	for _, c := range order {
+		node, ok := calc.graph.Formula(c)
+		if !ok {
+			continue
+		}
+		val, ok := cellPtr(wb, c)
+		if !ok {
+			continue
+		}
+		res, err := EvaluateValue(node, &Context{Workbook: wb, Host: c, Workbooks: calc.Workbooks})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to evaluate %s", c.ToAddress())
+		}
+		sheet, _ := wb.GetSheet(c.Sheet)
+		if old, ok := sheet.SpillRange(c); ok {
+			spilled = append(spilled, spillCells(sheet, old, c)...)
+		}
+		if rows, cols := res.Dims(); res.Kind == KindArray && rows*cols > 1 {
+			if err := sheet.Spill(c, toCVals(res)); err != nil && err != xl.ErrorSpill {
+				return nil, errors.Wrapf(err, "failed to spill %s", c.ToAddress())
+			}
+			if r, ok := sheet.SpillRange(c); ok {
+				spilled = append(spilled, spillCells(sheet, r, c)...)
+			}
+			continue
+		}
+		sheet.ClearSpill(c)
+		val.SetComputed(res.ToCVal())
+	}
+	return spilled, orderErr
+}
+
+// unblocked returns the anchors of the blocked spills over the given cells,
+// which may spill once they changed, and the formulas depending on them.
+func (calc *Calculator) unblocked(wb *xl.Workbook, cells ...xl.Cell) []xl.Cell {
+	var anchors []xl.Cell
+	for _, c := range cells {
+		if sheet, ok := wb.GetSheet(c.Sheet); ok {
+			anchors = append(anchors, sheet.BlockedSpills(c)...)
+		}
+	}
+	if len(anchors) == 0 {
+		return nil
+	}
+	return append(calc.graph.TransitiveDependents(anchors...), anchors...)
+}
+
+// spillCells returns the cells of a spill range of sheet, but its anchor.
+func spillCells(sheet *xl.Sheet, r xl.Range, anchor xl.Cell) []xl.Cell {
+	cells := r.CellsIn(sheet)
+	return slices.DeleteFunc(cells, func(c xl.Cell) bool { return c.Row == anchor.Row && c.Col == anchor.Col })
+}
+
+// toCVals converts the values of an array into cell values.
+func toCVals(v Value) [][]xl.CVal {
+	rows := make([][]xl.CVal, len(v.Array))
+	for i, row := range v.Array {
+		rows[i] = make([]xl.CVal, len(row))
+		for j, elem := range row {
+			rows[i][j] = elem.ToCVal()
+		}
+	}
+	return rows
+}
+
+func cellPtr(wb *xl.Workbook, c xl.Cell) (*xl.CVal, bool) {
+	sheet, ok := wb.GetSheet(c.Sheet)
+	if !ok || !c.IsInBounds(sheet) {
+		return nil, false
+	}
+	return &sheet.Content[c.Row][c.Col], true
+}
@@ -0,0 +1,261 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/usr-ein/excelparser/parser"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+func TestCalculatorSetCell(t *testing.T) {
+	raw := xl.RawSheet{
+		Name: "Sheet1",
+		Content: [][]any{
+			{1, 2, "=A1+B1"},
+			{3, "=C1*10", "=A2*2"},
+		},
+	}
+	sheet, err := raw.ToSheet()
+	if err != nil {
+		t.Fatalf("ToSheet failed with %s", err)
+	}
+	wb := &xl.Workbook{Name: "Book1", Sheets: []xl.Sheet{sheet}}
+	calc := NewCalculator(wb)
+	if err := calc.RecalculateAll(wb); err != nil {
+		t.Fatalf("RecalculateAll failed with %s", err)
+	}
+	content := wb.Sheets[0].Content
+	if content[1][1].ValNumber != 30 || !content[1][1].HasComputed || content[1][1].ComputedType != xl.CTNumber {
+		t.Errorf("B2 = %v; want 30", content[1][1])
+	}
+
+	// Tamper with C2, which doesn't depend on A1, to check it's not recomputed
+	content[1][2].ValNumber = -1
+
+	a1, _ := xl.ParseCell("A1", "Sheet1")
+	if err := wb.SetCell(a1, xl.CVal{Type: xl.CTNumber, ValNumber: 5}); err != nil {
+		t.Fatalf("SetCell failed with %s", err)
+	}
+	if content[0][2].ValNumber != 7 {
+		t.Errorf("C1 = %v; want 7", content[0][2])
+	}
+	if content[1][1].ValNumber != 70 {
+		t.Errorf("B2 = %v; want 70", content[1][1])
+	}
+	if content[1][2].ValNumber != -1 {
+		t.Errorf("C2 was recomputed although it doesn't depend on A1")
+	}
+
+	// Replacing a value by a formula adds it to the graph
+	d2, _ := xl.ParseCell("D2", "Sheet1")
+	if err := wb.SetCell(d2, xl.CVal{Type: xl.CTFormula, ValFormula: "=B2+1"}); err != nil {
+		t.Fatalf("SetCell failed with %s", err)
+	}
+	content = wb.Sheets[0].Content
+	if content[1][3].ValNumber != 71 {
+		t.Errorf("D2 = %v; want 71", content[1][3])
+	}
+	if err := wb.SetCell(a1, xl.CVal{Type: xl.CTNumber, ValNumber: 0}); err != nil {
+		t.Fatalf("SetCell failed with %s", err)
+	}
+	if content[1][3].ValNumber != 21 {
+		t.Errorf("D2 = %v; want 21", content[1][3])
+	}
+
+	// Excel errors are stored as computed values too
+	if err := wb.SetCell(a1, xl.CVal{Type: xl.CTString, ValString: "x"}); err != nil {
+		t.Fatalf("SetCell failed with %s", err)
+	}
+	if computed := content[0][2].Computed(); computed.Type != xl.CTError || computed.ValError != xl.ErrorValue {
+		t.Errorf("C1 = %v; want #VALUE!", content[0][2])
+	}
+}
+
+func TestCalculatorSetCellUnparsed(t *testing.T) {
+	raw := xl.RawSheet{
+		Name:    "Sheet1",
+		Content: [][]any{{1, "=A1*2", "=B1+1"}},
+	}
+	sheet, err := raw.ToSheet()
+	if err != nil {
+		t.Fatalf("ToSheet failed with %s", err)
+	}
+	wb := &xl.Workbook{Name: "Book1", Sheets: []xl.Sheet{sheet}}
+	calc := NewCalculator(wb)
+	if err := calc.RecalculateAll(wb); err != nil {
+		t.Fatalf("RecalculateAll failed with %s", err)
+	}
+
+	b1, _ := xl.ParseCell("B1", "Sheet1")
+	if err := wb.SetCell(b1, xl.CVal{Type: xl.CTFormula, ValFormula: "=A1*3"}); err != nil {
+		t.Fatalf("SetCell failed with %s", err)
+	}
+	if err := wb.SetCell(b1, xl.CVal{Type: xl.CTFormula, ValFormula: "=SUM(A1"}); err == nil {
+		t.Errorf("expected an error for an unparseable formula")
+	}
+	content := wb.Sheets[0].Content
+	if computed := content[0][1].Computed(); computed.Type != xl.CTError || computed.ValError != xl.ErrorName {
+		t.Errorf("B1 = %v; want #NAME?", content[0][1])
+	}
+	if computed := content[0][2].Computed(); computed.Type != xl.CTError || computed.ValError != xl.ErrorName {
+		t.Errorf("C1 = %v; want #NAME? from B1", content[0][2])
+	}
+
+	// The old formula of B1 is gone from the graph
+	a1, _ := xl.ParseCell("A1", "Sheet1")
+	if err := wb.SetCell(a1, xl.CVal{Type: xl.CTNumber, ValNumber: 5}); err != nil {
+		t.Fatalf("SetCell failed with %s", err)
+	}
+	if computed := content[0][1].Computed(); computed.Type != xl.CTError || computed.ValError != xl.ErrorName {
+		t.Errorf("B1 = %v; want #NAME? after changing A1", content[0][1])
+	}
+	if deps := calc.Graph().TransitiveDependents(a1); len(deps) != 0 {
+		t.Errorf("A1 has dependents %v; want none", deps)
+	}
+}
+
+func TestCalculatorUnparsed(t *testing.T) {
+	raw := xl.RawSheet{
+		Name:    "Sheet1",
+		Content: [][]any{{1, "=SUM(A1", "=B1+1", "=A1*2"}},
+	}
+	sheet, err := raw.ToSheet()
+	if err != nil {
+		t.Fatalf("ToSheet failed with %s", err)
+	}
+	wb := &xl.Workbook{Name: "Book1", Sheets: []xl.Sheet{sheet}}
+	calc := NewCalculator(wb)
+	if err := calc.RecalculateAll(wb); err != nil {
+		t.Fatalf("RecalculateAll failed with %s", err)
+	}
+	content := wb.Sheets[0].Content
+	for _, val := range content[0][1:3] {
+		if computed := val.Computed(); computed.Type != xl.CTError || computed.ValError != xl.ErrorName {
+			t.Errorf("%v; want #NAME?", val)
+		}
+	}
+	if content[0][3].ValNumber != 2 {
+		t.Errorf("D1 = %v; want 2", content[0][3])
+	}
+}
+
+func TestCalculatorNames(t *testing.T) {
+	raw := xl.RawSheet{
+		Name:    "Sheet1",
+		Content: [][]any{{10, 20, "=SUM(Revenue)*TaxRate"}},
+	}
+	sheet, err := raw.ToSheet()
+	if err != nil {
+		t.Fatalf("ToSheet failed with %s", err)
+	}
+	wb := &xl.Workbook{Name: "Book1", Sheets: []xl.Sheet{sheet}}
+	NewCalculator(wb)
+	names := parser.NewNameManager(wb)
+	if err := names.Define(xl.DefinedName{Name: "Revenue", RefersTo: "=Sheet1!$A$1:$B$1"}); err != nil {
+		t.Fatalf("Define failed with %s", err)
+	}
+	c1 := &wb.Sheets[0].Content[0][2]
+	if computed := c1.Computed(); computed.Type != xl.CTError || computed.ValError != xl.ErrorName {
+		t.Errorf("C1 = %v; want #NAME? while TaxRate is undefined", c1)
+	}
+	if err := names.Define(xl.DefinedName{Name: "TaxRate", RefersTo: "=0.5"}); err != nil {
+		t.Fatalf("Define failed with %s", err)
+	}
+	if c1.ValNumber != 15 {
+		t.Errorf("C1 = %v; want 15", c1)
+	}
+
+	// Cells referenced through names are tracked like the others
+	a1, _ := xl.ParseCell("A1", "Sheet1")
+	if err := wb.SetCell(a1, xl.CVal{Type: xl.CTNumber, ValNumber: 30}); err != nil {
+		t.Fatalf("SetCell failed with %s", err)
+	}
+	if c1.ValNumber != 25 {
+		t.Errorf("C1 = %v; want 25", c1)
+	}
+}
+
+func TestCalculatorSpill(t *testing.T) {
+	raw := xl.RawSheet{
+		Name: "Sheet1",
+		Content: [][]any{
+			{1, 2, "=A1:B2*10", nil, nil, "=SUM(C1#)", "=D2+1"},
+			{3, 4, nil, nil, nil, nil, nil},
+		},
+	}
+	sheet, err := raw.ToSheet()
+	if err != nil {
+		t.Fatalf("ToSheet failed with %s", err)
+	}
+	wb := &xl.Workbook{Name: "Book1", Sheets: []xl.Sheet{sheet}}
+	calc := NewCalculator(wb)
+	if err := calc.RecalculateAll(wb); err != nil {
+		t.Fatalf("RecalculateAll failed with %s", err)
+	}
+	content := wb.Sheets[0].Content
+	if content[1][3].Computed().ValNumber != 40 {
+		t.Errorf("D2 = %v; want 40 spilled from C1", content[1][3])
+	}
+	if content[0][5].ValNumber != 100 {
+		t.Errorf("F1 = %v; want 100", content[0][5])
+	}
+	// G1 doesn't depend on C1 in the graph, so it is recomputed after the spill
+	if content[0][6].ValNumber != 41 {
+		t.Errorf("G1 = %v; want 41", content[0][6])
+	}
+
+	a1, _ := xl.ParseCell("A1", "Sheet1")
+	if err := wb.SetCell(a1, xl.CVal{Type: xl.CTNumber, ValNumber: 5}); err != nil {
+		t.Fatalf("SetCell failed with %s", err)
+	}
+	if content[0][2].ValNumber != 50 || content[0][5].ValNumber != 140 {
+		t.Errorf("C1 = %v, F1 = %v; want 50 and 140", content[0][2], content[0][5])
+	}
+
+	// Writing over the spill blocks it
+	d1, _ := xl.ParseCell("D1", "Sheet1")
+	if err := wb.SetCell(d1, xl.CVal{Type: xl.CTString, ValString: "x"}); err != nil {
+		t.Fatalf("SetCell failed with %s", err)
+	}
+	if computed := content[0][2].Computed(); computed.Type != xl.CTError || computed.ValError != xl.ErrorSpill {
+		t.Errorf("C1 = %v; want #SPILL!", content[0][2])
+	}
+	if computed := content[0][5].Computed(); computed.Type != xl.CTError || computed.ValError != xl.ErrorRef {
+		t.Errorf("F1 = %v; want #REF! without a spill", content[0][5])
+	}
+	if content[1][3].HasComputed || content[0][6].ValNumber != 1 {
+		t.Errorf("D2 = %v, G1 = %v; want D2 cleared", content[1][3], content[0][6])
+	}
+
+	// Clearing what blocks the spill spills it again
+	if err := wb.SetCell(d1, xl.CValEmpty); err != nil {
+		t.Fatalf("SetCell failed with %s", err)
+	}
+	if content[1][3].Computed().ValNumber != 40 || content[0][5].ValNumber != 140 {
+		t.Errorf("D2 = %v, F1 = %v; want 40 and 140 once spilled again", content[1][3], content[0][5])
+	}
+	if content[0][6].ValNumber != 41 {
+		t.Errorf("G1 = %v; want 41", content[0][6])
+	}
+
+	// So does clearing a value typed in the middle of it
+	d2, _ := xl.ParseCell("D2", "Sheet1")
+	if err := wb.SetCell(d2, xl.CVal{Type: xl.CTNumber, ValNumber: 7}); err != nil {
+		t.Fatalf("SetCell failed with %s", err)
+	}
+	if computed := content[0][2].Computed(); computed.Type != xl.CTError || computed.ValError != xl.ErrorSpill {
+		t.Errorf("C1 = %v; want #SPILL!", content[0][2])
+	}
+	if err := wb.SetCell(d2, xl.CValEmpty); err != nil {
+		t.Fatalf("SetCell failed with %s", err)
+	}
+	if content[0][2].Computed().ValNumber != 50 || content[1][3].Computed().ValNumber != 40 {
+		t.Errorf("C1 = %v, D2 = %v; want 50 and 40 once spilled again", content[0][2], content[1][3])
+	}
+	if content[0][5].ValNumber != 140 {
+		t.Errorf("F1 = %v; want 140", content[0][5])
+	}
+	if len(wb.Sheets[0].Blocked) != 0 {
+		t.Errorf("blocked spills = %v; want none", wb.Sheets[0].Blocked)
+	}
+}
@@ -0,0 +1,56 @@
+package eval
+
+import (
+	"github.com/usr-ein/excelparser/parser"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+// Context holds what the evaluator needs to resolve references.
+// Either Workbook or Sheet must be set. When only Sheet is set,
+// references to other sheets evaluate to #REF!.
+type Context struct {
+	Workbook *xl.Workbook
+	Sheet    *xl.Sheet
+
+	// Cell the formula is located in, used by functions like ROW()
+	// when they are called without arguments.
+	Host xl.Cell
+
+	// Defined names the formula can use, the ones of Workbook if nil.
+	// Unknown names evaluate to #NAME?.
+	Names parser.NameResolver
+
+	// Loads the workbooks of external references like [Book2.xlsx]Sheet1!A1,
+	// which evaluate to #REF! if nil or if their workbook can't be loaded.
+	Workbooks parser.WorkbookResolver
+}
+
+func (ctx *Context) names() parser.NameResolver {
+	if ctx.Names == nil && ctx.Workbook != nil {
+		return ctx.Workbook
+	}
+	return ctx.Names
+}
+
+// currentSheet returns the name of the sheet the formula is located in, if known.
+func (ctx *Context) currentSheet() string {
+	if ctx.Host.Sheet != "" {
+		return ctx.Host.Sheet
+	}
+	if ctx.Sheet != nil {
+		return ctx.Sheet.Name
+	}
+	return ""
+}
+
+func (ctx *Context) getSheet(name string) (*xl.Sheet, bool) {
+	if ctx.Workbook != nil {
+		if s, ok := ctx.Workbook.GetSheet(name); ok {
+			return s, true
+		}
+	}
+	if ctx.Sheet != nil && ctx.Sheet.Name == name {
+		return ctx.Sheet, true
+	}
+	return nil, false
+}
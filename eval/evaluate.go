@@ -0,0 +1,392 @@
+// Package eval computes the value of formulas parsed by the parser package,
+// reading their inputs from an xl.Workbook or xl.Sheet.
+package eval
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/usr-ein/excelparser/parser"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+var ErrCircularReference = errors.New("circular reference")
+
+// Evaluate computes the value of a formula tree.
+// Excel errors such as #DIV/0! are values of type CTError,
+// errors mean the tree could not be evaluated at all.
+func Evaluate(n parser.Node, ctx *Context) (xl.CVal, error) {
+	v, err := EvaluateValue(n, ctx)
+	if err != nil {
+		return xl.CVal{}, err
+	}
+	return v.ToCVal(), nil
+}
+
+// EvaluateValue is like Evaluate, but returns the raw Value,
+// so arrays and Excel errors are kept as is.
+func EvaluateValue(n parser.Node, ctx *Context) (Value, error) {
+	e := &evaluator{
+		ctx:      ctx,
+		visiting: make(map[xl.Cell]bool),
+		memo:     make(map[xl.Cell]Value),
+		names:    make(map[string]bool),
+		books:    make(map[string]bool),
+	}
+	return e.eval(n)
+}
+
+type evaluator struct {
+	ctx *Context
+	// Formula cells being evaluated, to detect circular references
+	visiting map[xl.Cell]bool
+	// Formula cells without a computed value that we already evaluated
+	memo map[xl.Cell]Value
+	// Defined names being evaluated, to detect names defined in terms of themselves
+	names map[string]bool
+	// External workbooks being evaluated, to detect workbooks linking to each other
+	books map[string]bool
+	// Values of the names bound by LET and LAMBDA, by parser.IdentifierKey
+	scope map[string]Value
+	// Number of nested lambda calls
+	depth int
+}
+
+func (e *evaluator) eval(n parser.Node) (Value, error) {
+	switch n.Type() {
+	case parser.NodeTypeNumber:
+		return Num(n.(parser.NumberNode).Value), nil
+	case parser.NodeTypeText:
+		return Str(n.(parser.TextNode).Value), nil
+	case parser.NodeTypeLogical:
+		return Bool(n.(parser.LogicalNode).Value), nil
+	case parser.NodeTypeError:
+		return Err(n.(parser.ErrorNode).Code), nil
+	case parser.NodeTypeCell:
+		cell := n.(parser.CellNode).Cell
+		return e.readRange(xl.Range{Start: cell, End: xl.Cell{Sheet: cell.Sheet, Row: cell.Row + 1, Col: cell.Col + 1}})
+	case parser.NodeTypeCellRange:
+		return e.readRange(n.(parser.CellRangeNode).Range().Normalize())
+	case parser.NodeTypeName:
+		return e.evalName(n.(parser.NameNode))
+	case parser.NodeTypeStructuredRef:
+		if e.ctx.Workbook == nil {
+			return Err(ErrRef), nil
+		}
+		r, err := e.ctx.Workbook.ResolveTableRef(n.(parser.StructuredRefNode).TableRef, e.ctx.Host)
+		if err != nil {
+			return Err(ErrRef), nil
+		}
+		return e.readRange(r)
+	case parser.NodeTypeRef3D:
+		return e.readRef3D(n.(parser.Ref3DNode))
+	case parser.NodeTypeExternalRef:
+		return e.evalExternal(n.(parser.ExternalRefNode))
+	case parser.NodeTypeSpillRef:
+		return e.readSpill(n.(parser.SpillRefNode).Cell)
+	case parser.NodeTypeArray:
+		rows := n.(parser.ArrayNode).Rows
+		array := make([][]Value, len(rows))
+		for i, row := range rows {
+			array[i] = make([]Value, len(row))
+			for j, elem := range row {
+				val, err := e.eval(elem)
+				if err != nil {
+					return Value{}, err
+				}
+				array[i][j] = val
+			}
+		}
+		return Array(array), nil
+	case parser.NodeTypeFunction:
+		return e.call(n.(parser.FunctionNode))
+	case parser.NodeTypeIdentifier:
+		return e.evalIdentifier(n.(parser.IdentifierNode)), nil
+	case parser.NodeTypeCall:
+		return e.evalCall(n.(parser.CallNode))
+	case parser.NodeTypeEmpty:
+		return Empty, nil
+	case parser.NodeTypeUnaryExpression:
+		uNode := n.(parser.UnaryExpressionNode)
+		operand, err := e.eval(uNode.Operand)
+		if err != nil {
+			return Value{}, err
+		}
+		if uNode.Operator == "@" {
+			return e.implicitIntersection(operand), nil
+		}
+		return unaryOp(uNode.Operator, operand), nil
+	case parser.NodeTypeBinaryExpression:
+		bNode := n.(parser.BinaryExpressionNode)
+		left, err := e.eval(bNode.Left)
+		if err != nil {
+			return Value{}, err
+		}
+		right, err := e.eval(bNode.Right)
+		if err != nil {
+			return Value{}, err
+		}
+		if bNode.Operator == ":" || bNode.Operator == " " || bNode.Operator == "," {
+			return e.referenceOp(bNode.Operator, left, right)
+		}
+		return binaryOp(bNode.Operator, left, right), nil
+	}
+	return Value{}, errors.Errorf("cannot evaluate node of type %s", n.Type())
+}
+
+// readRange reads the values of a range as an array that remembers where it came from.
+func (e *evaluator) readRange(r xl.Range) (Value, error) {
+	sheet, ok := e.ctx.getSheet(r.Start.Sheet)
+	if !ok {
+		return Err(ErrRef), nil
+	}
+	// Whole columns and rows are only read as far as the sheet goes
+	read := r.ClampTo(sheet)
+	rows := make([][]Value, 0, read.End.Row-read.Start.Row)
+	for i := read.Start.Row; i < read.End.Row; i++ {
+		row := make([]Value, 0, read.End.Col-read.Start.Col)
+		for j := read.Start.Col; j < read.End.Col; j++ {
+			val, err := e.cellValue(sheet, xl.Cell{Sheet: sheet.Name, Row: i, Col: j})
+			if err != nil {
+				return Value{}, err
+			}
+			row = append(row, val)
+		}
+		rows = append(rows, row)
+	}
+	return Value{Kind: KindArray, Array: rows, Ref: &r}, nil
+}
+
+// readRef3D reads the values of a 3D reference, laid out on a single row like unions.
+func (e *evaluator) readRef3D(n parser.Ref3DNode) (Value, error) {
+	if e.ctx.Workbook == nil {
+		return Err(ErrRef), nil
+	}
+	ranges, err := n.Expand(e.ctx.Workbook)
+	if err != nil {
+		return Err(ErrRef), nil
+	}
+	values := make([]Value, 0)
+	for _, r := range ranges {
+		val, err := e.readRange(r.Normalize())
+		if err != nil {
+			return Value{}, err
+		}
+		values = append(values, val.Flatten()...)
+	}
+	return Array([][]Value{values}), nil
+}
+
+// readSpill reads the values the formula in anchor spilled, or #REF! if it didn't spill.
+func (e *evaluator) readSpill(anchor xl.Cell) (Value, error) {
+	sheet, ok := e.ctx.getSheet(anchor.Sheet)
+	if !ok {
+		return Err(ErrRef), nil
+	}
+	r, ok := sheet.SpillRange(anchor)
+	if !ok {
+		return Err(ErrRef), nil
+	}
+	return e.readRange(r)
+}
+
+func (e *evaluator) cellValue(sheet *xl.Sheet, c xl.Cell) (Value, error) {
+	cval, err := sheet.Get(c)
+	if err != nil {
+		// Outside of the used range, so empty
+		return Empty, nil
+	}
+	if cval.Type == xl.CTFormula && !cval.HasComputed {
+		return e.evalFormulaCell(sheet, c, cval.ValFormula)
+	}
+	return fromCVal(cval), nil
+}
+
+// evalFormulaCell computes a formula cell that has no computed value yet.
+func (e *evaluator) evalFormulaCell(sheet *xl.Sheet, c xl.Cell, f xl.Formula) (Value, error) {
+	if val, ok := e.memo[c]; ok {
+		return val, nil
+	}
+	if e.visiting[c] {
+		return Value{}, errors.Wrapf(ErrCircularReference, "in %s", c.ToAddress())
+	}
+	e.visiting[c] = true
+	defer delete(e.visiting, c)
+
+	node, err := parser.Parse(string(f), sheet.Name)
+	if err != nil {
+		return Value{}, errors.Wrapf(err, "failed to parse formula in %s", c.ToAddress())
+	}
+	inner := &evaluator{
+		ctx: &Context{
+			Workbook:  e.ctx.Workbook,
+			Sheet:     e.ctx.Sheet,
+			Host:      c,
+			Names:     e.ctx.Names,
+			Workbooks: e.ctx.Workbooks,
+		},
+		visiting: e.visiting,
+		memo:     e.memo,
+		names:    e.names,
+		books:    e.books,
+	}
+	val, err := inner.eval(node)
+	if err != nil {
+		return Value{}, err
+	}
+	val = val.Scalar()
+	e.memo[c] = val
+	return val, nil
+}
+
+// evalName evaluates what a defined name stands for, or #NAME? if it isn't defined.
+func (e *evaluator) evalName(n parser.NameNode) (Value, error) {
+	ctx := parser.Context{CurrentSheet: e.ctx.currentSheet(), Names: e.ctx.names()}
+	node, err := parser.ResolveName(ctx, n)
+	if errors.Is(err, parser.ErrUnknownName) {
+		return Err(ErrName), nil
+	}
+	if err != nil {
+		return Value{}, err
+	}
+	key := strings.ToUpper(ctx.CurrentSheet + "!" + n.String())
+	if e.names[key] {
+		return Value{}, errors.Wrapf(ErrCircularReference, "in name %s", n.String())
+	}
+	e.names[key] = true
+	defer delete(e.names, key)
+	// Definitions don't see the names bound where they are used
+	return e.within(nil).eval(node)
+}
+
+// evalExternal evaluates a reference to another workbook, loaded through
+// the context's resolver, or #REF! if it can't be loaded.
+func (e *evaluator) evalExternal(n parser.ExternalRefNode) (Value, error) {
+	if e.ctx.Workbooks == nil {
+		return Err(ErrRef), nil
+	}
+	wb, err := e.ctx.Workbooks.ResolveWorkbook(n.Path, n.Book)
+	if err != nil {
+		return Err(ErrRef), nil
+	}
+	key := strings.ToUpper(n.Path + "[" + n.Book + "]")
+	if e.books[key] {
+		return Value{}, errors.Wrapf(ErrCircularReference, "in workbook %s", n.Book)
+	}
+	e.books[key] = true
+	defer delete(e.books, key)
+	// Cells of the other workbook can have the same addresses as ours,
+	// so they get their own memo.
+	inner := &evaluator{
+		ctx: &Context{
+			Workbook:  wb,
+			Host:      xl.Cell{Sheet: n.Sheet()},
+			Workbooks: e.ctx.Workbooks,
+		},
+		visiting: make(map[xl.Cell]bool),
+		memo:     make(map[xl.Cell]Value),
+		names:    make(map[string]bool),
+		books:    e.books,
+	}
+	return inner.eval(n.Ref)
+}
+
+// implicitIntersection applies the @ operator: ranges give their cell on the row
+// or column of the host cell, e.g. A5 for @A1:A10 in C5, or #VALUE! if there is none.
+// Other arrays give their top-left value.
+func (e *evaluator) implicitIntersection(v Value) Value {
+	if v.Kind != KindArray {
+		return v
+	}
+	if v.Ref == nil {
+		return v.Scalar()
+	}
+	r := v.Ref.Normalize()
+	row, okRow := intersectIndex(int(r.Start.Row), int(r.End.Row), int(e.ctx.Host.Row))
+	col, okCol := intersectIndex(int(r.Start.Col), int(r.End.Col), int(e.ctx.Host.Col))
+	if !okRow || !okCol {
+		return Err(ErrValue)
+	}
+	if rows, cols := v.Dims(); row >= rows || col >= cols {
+		// Past the end of the sheet, for whole columns and rows
+		return Empty
+	}
+	return v.Array[row][col]
+}
+
+// intersectIndex returns the index of host in [start, end), which is 0 when
+// they span a single row or column, and false if host isn't in it.
+func intersectIndex(start int, end int, host int) (int, bool) {
+	if end-start == 1 {
+		return 0, true
+	}
+	if host < start || host >= end {
+		return 0, false
+	}
+	return host - start, true
+}
+
+// referenceOp applies the range (colon), intersection (space) and union (comma) operators.
+func (e *evaluator) referenceOp(operator string, left Value, right Value) (Value, error) {
+	if left.IsError() {
+		return left, nil
+	}
+	if right.IsError() {
+		return right, nil
+	}
+	if left.Ref == nil || right.Ref == nil {
+		return Err(ErrValue), nil
+	}
+	if operator == ":" {
+		// The smallest range holding both, e.g. A1:C3 for A1:INDEX(B:C, 3, 2)
+		l, r := left.Ref.Normalize(), right.Ref.Normalize()
+		if l.Start.Sheet != r.Start.Sheet {
+			return Err(ErrValue), nil
+		}
+		start, end := l.Start, l.End
+		start.Row, start.Col = min(l.Start.Row, r.Start.Row), min(l.Start.Col, r.Start.Col)
+		end.Row, end.Col = max(l.End.Row, r.End.Row), max(l.End.Col, r.End.Col)
+		return e.readRange(xl.Range{Start: start, End: end})
+	}
+	if operator == " " {
+		inter, ok := left.Ref.Intersect(*right.Ref)
+		if !ok {
+			return Err(ErrNull), nil
+		}
+		return e.readRange(inter)
+	}
+	// A union has no shape of its own, so we lay all its values out on a single row.
+	union := append(left.Flatten(), right.Flatten()...)
+	return Array([][]Value{union}), nil
+}
+
+func (e *evaluator) call(fNode parser.FunctionNode) (Value, error) {
+	name := strings.ToUpper(fNode.Name)
+	// Newer functions are prefixed in files, e.g. _xlfn.IFS
+	name = strings.TrimPrefix(name, "_XLFN.")
+
+	if form, ok := specialForms[name]; ok {
+		return form(e, fNode.Arguments)
+	}
+	fn, ok := Functions[name]
+	if !ok {
+		// Lambdas can be given a name, e.g. Double for =LAMBDA(x, x*2)
+		named, err := e.evalName(parser.NameNode{Name: fNode.Name})
+		if err != nil {
+			return Value{}, err
+		}
+		if named.Kind != KindLambda {
+			return Err(ErrName), nil
+		}
+		return e.callLambda(named, fNode.Arguments)
+	}
+	args := make([]Value, len(fNode.Arguments))
+	for i, arg := range fNode.Arguments {
+		val, err := e.eval(arg)
+		if err != nil {
+			return Value{}, err
+		}
+		args[i] = val
+	}
+	return fn(args), nil
+}
@@ -0,0 +1,401 @@
+package eval
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/usr-ein/excelparser/parser"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+func testWorkbook(t *testing.T) *xl.Workbook {
+	raw := xl.RawSheet{
+		Name: "Sheet1",
+		Content: [][]any{
+			{1, 2, "3", true},
+			{4, 5, "abc", nil},
+			{"=A1+A2", "=SUM(A1:B2)", "=C1&C2", "=A3*2"},
+		},
+	}
+	other := xl.RawSheet{
+		Name:    "Data",
+		Content: [][]any{{"a", 10}, {"b", 20}, {"c", 30}},
+	}
+	wb := &xl.Workbook{Name: "Book1"}
+	for _, rawSheet := range []xl.RawSheet{raw, other} {
+		sheet, err := rawSheet.ToSheet()
+		if err != nil {
+			t.Fatalf("ToSheet failed with %s", err)
+		}
+		wb.Sheets = append(wb.Sheets, sheet)
+	}
+	return wb
+}
+
+func evalString(t *testing.T, wb *xl.Workbook, formula string) string {
+	node, err := parser.Parse(formula, "Sheet1")
+	if err != nil {
+		t.Fatalf("could not parse %s: %v", formula, err)
+	}
+	val, err := EvaluateValue(node, &Context{Workbook: wb})
+	if err != nil {
+		t.Fatalf("could not evaluate %s: %v", formula, err)
+	}
+	return val.Scalar().String()
+}
+
+func TestEvaluate(t *testing.T) {
+	wb := testWorkbook(t)
+	cases := map[string]string{
+		`=1+2*3`:                              "7",
+		`=(1+2)*3`:                            "9",
+		`=2^3^2`:                              "64",
+		`=-A1+10`:                             "9",
+		`=A1+C1`:                              "4",
+		`=A1+D1`:                              "2",
+		`=A1+C2`:                              "#VALUE!",
+		`=1/0`:                                "#DIV/0!",
+		`=A1&B1`:                              "12",
+		`="x"&D1`:                             "xTRUE",
+		`=A3`:                                 "5",
+		`=D3`:                                 "10",
+		`=B3`:                                 "12",
+		`=C3`:                                 "3abc",
+		`=SUM(A1:D2)`:                         "12",
+		`=SUM(C1, 1)`:                         "1",
+		`=SUM("3", 1)`:                        "4",
+		`=AVERAGE(A1:B2)`:                     "3",
+		`=COUNT(A1:D2)`:                       "4",
+		`=COUNTA(A1:D2)`:                      "7",
+		`=MAX(A1:B2)-MIN(A1:B2)`:              "4",
+		`=IF(A1>0, "pos", 1/0)`:               "pos",
+		`=IF(A1<0, 1)`:                        "FALSE",
+		`=IFERROR(1/0, "oops")`:               "oops",
+		`=AND(TRUE, A1)`:                      "TRUE",
+		`=OR(FALSE, 0)`:                       "FALSE",
+		`=NOT(D1)`:                            "FALSE",
+		`="abc"="ABC"`:                        "TRUE",
+		`=1<"a"`:                              "TRUE",
+		`="a"<TRUE`:                           "TRUE",
+		`=D2=0`:                               "TRUE",
+		`=D2=""`:                              "TRUE",
+		`=ROUND(2.675, 2)`:                    "2.68",
+		`=MOD(-3, 2)`:                         "1",
+		`=LEFT("hello", 2)&RIGHT("hello")`:    "heo",
+		`=MID("hello", 2, 3)`:                 "ell",
+		`=LEN(C2)`:                            "3",
+		`=UPPER(TRIM("  a   b "))`:            "A B",
+		`=VLOOKUP("b", Data!A1:B3, 2, FALSE)`: "20",
+		`=VLOOKUP("b", Data!A1:B3, 2,)`:       "20",
+		`=IF(FALSE,,2)`:                       "2",
+		`=IF(TRUE,,2)+1`:                      "1",
+		`=-A1%*200`:                           "-2",
+		`=(A1+1)%*50`:                         "1",
+		`=INDEX(Data!A1:B3, 3, 2)`:            "30",
+		`=SUM(Data!B1:INDEX(Data!B:B, 2))`:    "30",
+		`=ROWS(Data!A3:INDEX(Data!B:B, 1))`:   "3",
+		`=ISBLANK(INDEX(Data!B:B, 100))`:      "TRUE",
+		`=INDEX(Data!A:B, 100, 2)&"x"`:        "x",
+		`=COUNTA(INDEX(Data!A:B, 100, 0))`:    "0",
+		`=INDEX(Data!B:B, 1048577)`:           "#REF!",
+		`=MATCH(20, Data!B1:B3, 0)`:           "2",
+		`=CHOOSE(2, "a", "b", "c")`:           "b",
+		`=ROW(B7)+COLUMN(C1)`:                 "10",
+		`=SUM(A1:B2 B1:B2)`:                   "7",
+		`=SUM((A1,B2))`:                       "6",
+		`=SUMPRODUCT(A1:B1, A2:B2)`:           "14",
+		`=NoSheet!A1`:                         "#REF!",
+		`=FOOBAR(1)`:                          "#NAME?",
+		`=SWITCH(A1, 2, "two", 1, "one")`:     "one",
+		`=SUM(A:A)`:                           "10",
+		`=VLOOKUP("c", Data!A:B, 2, FALSE)`:   "30",
+		`=SUM(2:2)`:                           "9",
+		`=ROWS(Data!A:A)`:                     "1048576",
+		`=SUM({1;2;3}*A1:A3)`:                 "24",
+		`=SUM({1,2,3}*A1:A3)`:                 "60",
+		`=INDEX({"a","b"},2)`:                 "b",
+		`=INDEX({1,2;3,-4}, 2, 2)`:            "-4",
+		`=ROWS({1;2;3})`:                      "3",
+		`=IFERROR(A1/0, #N/A)`:                "#N/A",
+		`=ISNA(#N/A)`:                         "TRUE",
+		`=INDEX({1,#REF!}, 2)`:                "#REF!",
+		`=SUM(Sheet1:Data!B1)`:                "12",
+		`=SUM(Sheet1:Data!A1:B2)`:             "42",
+		`=COUNT(Data:Sheet1!A1:B1)`:           "3",
+		`=SUM(Sheet1:Nope!A1)`:                "#REF!",
+	}
+	for formula, expected := range cases {
+		if got := evalString(t, wb, formula); got != expected {
+			t.Errorf("Evaluate(%s) = %s; want %s", formula, got, expected)
+		}
+	}
+}
+
+func TestEvaluateToCVal(t *testing.T) {
+	wb := testWorkbook(t)
+	node, err := parser.Parse(`=SUM(A1:B2)`, "Sheet1")
+	if err != nil {
+		t.Fatalf("could not parse: %v", err)
+	}
+	val, err := Evaluate(node, &Context{Workbook: wb})
+	if err != nil {
+		t.Fatalf("Evaluate failed with %s", err)
+	}
+	if val.Type != xl.CTNumber || val.ValNumber != 12 {
+		t.Errorf("Evaluate = %v; want number 12", val)
+	}
+
+	node, err = parser.Parse(`=1/0`, "Sheet1")
+	if err != nil {
+		t.Fatalf("could not parse: %v", err)
+	}
+	val, err = Evaluate(node, &Context{Workbook: wb})
+	if err != nil {
+		t.Fatalf("Evaluate failed with %s", err)
+	}
+	if val.Type != xl.CTError || val.ValError != ErrDiv0 {
+		t.Errorf("Evaluate(=1/0) = %v; want %s", val, ErrDiv0)
+	}
+}
+
+func TestEvaluateCircular(t *testing.T) {
+	raw := xl.RawSheet{
+		Name:    "Sheet1",
+		Content: [][]any{{"=B1+1", "=A1+1"}},
+	}
+	sheet, err := raw.ToSheet()
+	if err != nil {
+		t.Fatalf("ToSheet failed with %s", err)
+	}
+	node, err := parser.Parse(`=A1`, "Sheet1")
+	if err != nil {
+		t.Fatalf("could not parse: %v", err)
+	}
+	if _, err := Evaluate(node, &Context{Sheet: &sheet}); err == nil {
+		t.Errorf("expected circular reference error")
+	}
+}
+
+func TestEvaluateNames(t *testing.T) {
+	wb := testWorkbook(t)
+	names := xl.DefinedNames{
+		{Name: "Revenue", RefersTo: "=Sheet1!$A$1:$A$2"},
+		{Name: "TaxRate", RefersTo: "=0.5"},
+		{Name: "TaxRate", Scope: "Data", RefersTo: "=0.1"},
+		{Name: "Prices", Scope: "Data", RefersTo: "=$B$1:$B$3"},
+		{Name: "Net", RefersTo: "=SUM(Revenue)*(1-TaxRate)"},
+		{Name: "Loop", RefersTo: "=Loop+1"},
+	}
+	cases := map[string]string{
+		`=SUM(Revenue)*TaxRate`: "2.5",
+		`=Net`:                  "2.5",
+		`=Data!TaxRate`:         "0.1",
+		`=SUM(Data!Prices)`:     "60",
+		`=ROWS(Revenue)`:        "2",
+		`=Unknown+1`:            "#NAME?",
+		`=Prices`:               "#NAME?",
+	}
+	for formula, expected := range cases {
+		node, err := parser.Parse(formula, "Sheet1")
+		if err != nil {
+			t.Fatalf("could not parse %s: %v", formula, err)
+		}
+		val, err := EvaluateValue(node, &Context{Workbook: wb, Host: xl.Cell{Sheet: "Sheet1"}, Names: names})
+		if err != nil {
+			t.Fatalf("could not evaluate %s: %v", formula, err)
+		}
+		if got := val.Scalar().String(); got != expected {
+			t.Errorf("Evaluate(%s) = %s; want %s", formula, got, expected)
+		}
+	}
+
+	node, err := parser.Parse(`=Loop`, "Sheet1")
+	if err != nil {
+		t.Fatalf("could not parse: %v", err)
+	}
+	if _, err := Evaluate(node, &Context{Workbook: wb, Names: names}); !errors.Is(err, ErrCircularReference) {
+		t.Errorf("expected circular reference error, got %v", err)
+	}
+}
+
+func TestEvaluateStructuredRefs(t *testing.T) {
+	raw := xl.RawSheet{
+		Name: "Sheet1",
+		Content: [][]any{
+			{"Item", "Qty", "Price", "Total"},
+			{"a", 2, 10, "=[@Qty]*[@Price]"},
+			{"b", 3, 20, "=[@Qty]*[@Price]"},
+			{"Total", "=SUM([Qty])", nil, "=SUM(Sales[Total])"},
+		},
+	}
+	sheet, err := raw.ToSheet()
+	if err != nil {
+		t.Fatalf("ToSheet failed with %s", err)
+	}
+	ref, _ := xl.ParseRange("A1:D4", "Sheet1")
+	wb := &xl.Workbook{
+		Name:   "Book1",
+		Sheets: []xl.Sheet{sheet},
+		Tables: xl.Tables{{Name: "Sales", Ref: ref, Columns: []string{"Item", "Qty", "Price", "Total"}, Headers: true, Totals: true}},
+	}
+	cases := map[string]string{
+		`=SUM(Sales[Qty])`:                         "5",
+		`=Sales[[#Totals],[Total]]`:                "80",
+		`=ROWS(Sales[#All])`:                       "4",
+		`=INDEX(Sales[#Headers], 1, 3)`:            "Price",
+		`=SUM(Sales[[Qty]:[Price]])`:               "35",
+		`=Sales[[#Totals],[Qty]]`:                  "5",
+		`=SUM(Nope[Qty])`:                          "#REF!",
+		`=COUNTA(Sales[[#Data],[#Totals],[Item]])`: "3",
+	}
+	for formula, expected := range cases {
+		if got := evalString(t, wb, formula); got != expected {
+			t.Errorf("Evaluate(%s) = %s; want %s", formula, got, expected)
+		}
+	}
+}
+
+func TestEvaluateImplicitIntersection(t *testing.T) {
+	wb := testWorkbook(t)
+	cases := []struct {
+		formula string
+		host    string
+		want    string
+	}{
+		{`=@A1:A3`, "E2", "4"},
+		{`=@A1:D1`, "C5", "3"},
+		{`=@A1:B2`, "B2", "5"},
+		{`=@A1:A3`, "E5", "#VALUE!"},
+		{`=@A:A*2`, "F3", "10"},
+		{`=@{7,8,9}`, "A1", "7"},
+		{`=@Data!B1:B3+1`, "E3", "31"},
+		{`=-@A1:A2`, "Z1", "-1"},
+	}
+	for _, tc := range cases {
+		host, _ := xl.ParseCell(tc.host, "Sheet1")
+		node, err := parser.Parse(tc.formula, "Sheet1")
+		if err != nil {
+			t.Fatalf("could not parse %s: %v", tc.formula, err)
+		}
+		val, err := EvaluateValue(node, &Context{Workbook: wb, Host: host})
+		if err != nil {
+			t.Fatalf("could not evaluate %s: %v", tc.formula, err)
+		}
+		if got := val.String(); got != tc.want {
+			t.Errorf("Evaluate(%s) in %s = %s; want %s", tc.formula, tc.host, got, tc.want)
+		}
+	}
+}
+
+func TestEvaluateLambdas(t *testing.T) {
+	wb := testWorkbook(t)
+	cases := map[string]string{
+		`=LET(x, A1*2, x+x)`:                                               "4",
+		`=LET(x, 1, y, x+1, LET(x, 10, x+y))`:                              "12",
+		`=LAMBDA(a, b, a+b)(1, 2)`:                                         "3",
+		`=LET(f, LAMBDA(v, v*2), f(3))`:                                    "6",
+		`=LET(n, 10, add, LAMBDA(v, v+n), n*add(1))`:                       "110",
+		`=LAMBDA(x, LAMBDA(y, x-y))(5)(2)`:                                 "3",
+		`=_xlfn.LET(_xlpm.x, 2, _xlpm.x*3)`:                                "6",
+		`=LAMBDA(a, b, a+b)(1)`:                                            "#VALUE!",
+		`=LAMBDA(x, x)`:                                                    "#CALC!",
+		`=x`:                                                               "#NAME?",
+		`=SUM(MAP(A1:B2, LAMBDA(v, v*10)))`:                                "120",
+		`=MAP(A1:A2, B1:B2, LAMBDA(a, b, a*b))`:                            "{2;20}",
+		`=REDUCE(0, A1:B2, LAMBDA(acc, v, acc+v))`:                         "12",
+		`=REDUCE(A1:B2, LAMBDA(acc, v, acc&v))`:                            "1245",
+		`=SCAN(0, A1:B2, LAMBDA(acc, v, acc+v))`:                           "{1,3;7,12}",
+		`=BYROW(A1:B2, LAMBDA(row, SUM(row)))`:                             "{3;9}",
+		`=BYCOL(A1:B2, LAMBDA(col, MAX(col)))`:                             "{4,5}",
+		`=BYROW(A1:B2, LAMBDA(row, row))`:                                  "{#CALC!;#CALC!}",
+		`=MAKEARRAY(2, 3, LAMBDA(i, j, i*10+j))`:                           "{11,12,13;21,22,23}",
+		`=SUM(MAKEARRAY(1E20, 1, LAMBDA(i, j, 1)))`:                        "#VALUE!",
+		`=MAKEARRAY(1E6, 1E6, LAMBDA(i, j, 1))`:                            "#VALUE!",
+		`=MAP(A1:A2, 1)`:                                                   "#VALUE!",
+		`=LET(fact, LAMBDA(f, n, IF(n<2, 1, n*f(f, n-1))), fact(fact, 5))`: "120",
+	}
+	for formula, expected := range cases {
+		node, err := parser.Parse(formula, "Sheet1")
+		if err != nil {
+			t.Fatalf("could not parse %s: %v", formula, err)
+		}
+		val, err := EvaluateValue(node, &Context{Workbook: wb})
+		if err != nil {
+			t.Fatalf("could not evaluate %s: %v", formula, err)
+		}
+		if got := val.String(); got != expected {
+			t.Errorf("Evaluate(%s) = %s; want %s", formula, got, expected)
+		}
+	}
+}
+
+func TestEvaluateNamedLambda(t *testing.T) {
+	wb := testWorkbook(t)
+	names := xl.DefinedNames{
+		{Name: "Double", RefersTo: "=LAMBDA(x, x*2)"},
+		{Name: "Forever", RefersTo: "=LAMBDA(n, Forever(n+1))"},
+	}
+	cases := map[string]string{
+		`=Double(A2)+1`: "9",
+		`=Forever(1)`:   "#NUM!",
+		`=Nope(1)`:      "#NAME?",
+	}
+	for formula, expected := range cases {
+		node, err := parser.Parse(formula, "Sheet1")
+		if err != nil {
+			t.Fatalf("could not parse %s: %v", formula, err)
+		}
+		val, err := Evaluate(node, &Context{Workbook: wb, Names: names})
+		if err != nil {
+			t.Fatalf("could not evaluate %s: %v", formula, err)
+		}
+		if got := fromCVal(val).String(); got != expected {
+			t.Errorf("Evaluate(%s) = %s; want %s", formula, got, expected)
+		}
+	}
+}
+
+// books resolves external references to workbooks by file name.
+type books map[string]*xl.Workbook
+
+func (b books) ResolveWorkbook(path string, book string) (*xl.Workbook, error) {
+	wb, ok := b[book]
+	if !ok {
+		return nil, errors.New("workbook not found")
+	}
+	return wb, nil
+}
+
+func TestEvaluateExternalRefs(t *testing.T) {
+	wb := testWorkbook(t)
+	other := testWorkbook(t)
+	other.Name = "Book2.xlsx"
+	other.Names = xl.DefinedNames{{Name: "Rate", RefersTo: "=Data!$B$1/100"}}
+	resolver := books{"Book2.xlsx": other, "Book1.xlsx": wb}
+	cases := map[string]string{
+		`=[Book2.xlsx]Sheet1!A3`:                     "5",
+		`=SUM([Book2.xlsx]Data!B1:B3)`:               "60",
+		`='C:\x\[Book2.xlsx]Sheet1'!B3*2`:            "24",
+		`=[Book2.xlsx]!Rate`:                         "0.1",
+		`=[Book3.xlsx]Sheet1!A1`:                     "#REF!",
+		`=[Book2.xlsx]Nope!A1`:                       "#REF!",
+		`=[Book2.xlsx]Sheet1!A1+[Book1.xlsx]Data!B2`: "21",
+	}
+	for formula, expected := range cases {
+		node, err := parser.Parse(formula, "Sheet1")
+		if err != nil {
+			t.Fatalf("could not parse %s: %v", formula, err)
+		}
+		val, err := EvaluateValue(node, &Context{Workbook: wb, Workbooks: resolver})
+		if err != nil {
+			t.Fatalf("could not evaluate %s: %v", formula, err)
+		}
+		if got := val.Scalar().String(); got != expected {
+			t.Errorf("Evaluate(%s) = %s; want %s", formula, got, expected)
+		}
+	}
+
+	if got := evalString(t, wb, `=[Book2.xlsx]Sheet1!A1`); got != "#REF!" {
+		t.Errorf("expected #REF! without a resolver, got %s", got)
+	}
+}
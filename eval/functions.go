@@ -0,0 +1,1071 @@
+package eval
+
+import (
+	"math"
+	"strings"
+
+	"github.com/usr-ein/excelparser/parser"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+// Function is an Excel function taking already evaluated arguments.
+// Excel errors in the arguments are passed as is, so each function
+// decides whether to propagate them.
+type Function func(args []Value) Value
+
+// Functions is the library of functions available to formulas, keyed by upper-case name.
+// It can be extended with custom functions.
+var Functions = map[string]Function{
+	// math
+	"SUM":        fnSum,
+	"PRODUCT":    fnProduct,
+	"AVERAGE":    fnAverage,
+	"MIN":        fnMin,
+	"MAX":        fnMax,
+	"COUNT":      fnCount,
+	"COUNTA":     fnCountA,
+	"COUNTBLANK": fnCountBlank,
+	"SUMPRODUCT": fnSumProduct,
+	"ABS":        mathFunc(math.Abs),
+	"SQRT":       fnSqrt,
+	"EXP":        mathFunc(math.Exp),
+	"LN":         fnLn,
+	"INT":        mathFunc(math.Floor),
+	"SIGN":       fnSign,
+	"PI":         fnPi,
+	"MOD":        fnMod,
+	"POWER":      fnPower,
+	"ROUND":      roundFunc(math.Round),
+	"ROUNDUP":    roundFunc(roundAwayFromZero),
+	"ROUNDDOWN":  roundFunc(math.Trunc),
+	"TRUNC":      fnTrunc,
+	// logical
+	"AND":   fnAnd,
+	"OR":    fnOr,
+	"XOR":   fnXor,
+	"NOT":   fnNot,
+	"TRUE":  fnTrue,
+	"FALSE": fnFalse,
+	// text
+	"LEN":         fnLen,
+	"LEFT":        fnLeft,
+	"RIGHT":       fnRight,
+	"MID":         fnMid,
+	"UPPER":       textFunc(strings.ToUpper),
+	"LOWER":       textFunc(strings.ToLower),
+	"TRIM":        textFunc(trimSpaces),
+	"CONCATENATE": fnConcat,
+	"CONCAT":      fnConcat,
+	"EXACT":       fnExact,
+	"REPT":        fnRept,
+	"VALUE":       fnValue,
+	// information
+	"ISBLANK":   isFunc(func(v Value) bool { return v.Kind == KindEmpty }),
+	"ISNUMBER":  isFunc(func(v Value) bool { return v.Kind == KindNumber }),
+	"ISTEXT":    isFunc(func(v Value) bool { return v.Kind == KindString }),
+	"ISLOGICAL": isFunc(func(v Value) bool { return v.Kind == KindBool }),
+	"ISERROR":   isFunc(func(v Value) bool { return v.Kind == KindError }),
+	"ISERR":     isFunc(func(v Value) bool { return v.Kind == KindError && v.Err != ErrNA }),
+	"ISNA":      isFunc(func(v Value) bool { return v.Kind == KindError && v.Err == ErrNA }),
+	"NA":        fnNA,
+	// lookup
+	"CHOOSE":  fnChoose,
+	"INDEX":   fnIndex,
+	"MATCH":   fnMatch,
+	"VLOOKUP": fnVLookup,
+	"HLOOKUP": fnHLookup,
+	"ROWS":    fnRows,
+	"COLUMNS": fnColumns,
+}
+
+// specialForm is a function that needs its arguments unevaluated,
+// either to evaluate them lazily (IF) or to look at the references themselves (ROW).
+type specialForm func(e *evaluator, args []parser.Node) (Value, error)
+
+var specialForms map[string]specialForm
+
+func init() {
+	// Set in init to break the initialization cycle through evaluator.eval
+	specialForms = map[string]specialForm{
+		"IF":      formIf,
+		"IFERROR": formIfError,
+		"IFNA":    formIfNA,
+		"IFS":     formIfs,
+		"SWITCH":  formSwitch,
+		"ROW":     formRow,
+		"COLUMN":  formColumn,
+
+		"LET":       formLet,
+		"LAMBDA":    formLambda,
+		"MAP":       formMap,
+		"REDUCE":    formReduce,
+		"SCAN":      formScan,
+		"BYROW":     formByRow,
+		"BYCOL":     formByCol,
+		"MAKEARRAY": formMakeArray,
+	}
+}
+
+// numbers calls f on every number in args, following the rules of aggregate functions:
+// values typed directly as arguments are coerced, but text and booleans
+// coming from ranges or arrays are ignored. The first error found is returned.
+func numbers(args []Value, f func(float64)) *Value {
+	for _, arg := range args {
+		if arg.Kind == KindArray {
+			for _, v := range arg.Flatten() {
+				if v.IsError() {
+					return &v
+				}
+				if v.Kind == KindNumber {
+					f(v.Num)
+				}
+			}
+			continue
+		}
+		if arg.Kind == KindEmpty {
+			continue
+		}
+		num := toNumber(arg)
+		if num.IsError() {
+			return &num
+		}
+		f(num.Num)
+	}
+	return nil
+}
+
+func fnSum(args []Value) Value {
+	total := 0.0
+	if err := numbers(args, func(f float64) { total += f }); err != nil {
+		return *err
+	}
+	return Num(total)
+}
+
+func fnProduct(args []Value) Value {
+	product, count := 1.0, 0
+	if err := numbers(args, func(f float64) { product *= f; count++ }); err != nil {
+		return *err
+	}
+	if count == 0 {
+		return Num(0)
+	}
+	return Num(product)
+}
+
+func fnAverage(args []Value) Value {
+	total, count := 0.0, 0
+	if err := numbers(args, func(f float64) { total += f; count++ }); err != nil {
+		return *err
+	}
+	if count == 0 {
+		return Err(ErrDiv0)
+	}
+	return Num(total / float64(count))
+}
+
+func fnMin(args []Value) Value {
+	res, count := math.Inf(1), 0
+	if err := numbers(args, func(f float64) { res = math.Min(res, f); count++ }); err != nil {
+		return *err
+	}
+	if count == 0 {
+		return Num(0)
+	}
+	return Num(res)
+}
+
+func fnMax(args []Value) Value {
+	res, count := math.Inf(-1), 0
+	if err := numbers(args, func(f float64) { res = math.Max(res, f); count++ }); err != nil {
+		return *err
+	}
+	if count == 0 {
+		return Num(0)
+	}
+	return Num(res)
+}
+
+func fnCount(args []Value) Value {
+	count := 0
+	for _, arg := range args {
+		if arg.Kind == KindArray {
+			for _, v := range arg.Flatten() {
+				if v.Kind == KindNumber {
+					count++
+				}
+			}
+			continue
+		}
+		if arg.Kind == KindBool || !toNumber(arg).IsError() && arg.Kind != KindEmpty {
+			count++
+		}
+	}
+	return Num(float64(count))
+}
+
+func fnCountA(args []Value) Value {
+	count := 0
+	for _, arg := range args {
+		for _, v := range arg.Flatten() {
+			if v.Kind != KindEmpty {
+				count++
+			}
+		}
+	}
+	return Num(float64(count))
+}
+
+func fnCountBlank(args []Value) Value {
+	if len(args) != 1 {
+		return Err(ErrValue)
+	}
+	count := 0
+	for _, v := range args[0].Flatten() {
+		if v.Kind == KindEmpty || (v.Kind == KindString && v.Str == "") {
+			count++
+		}
+	}
+	return Num(float64(count))
+}
+
+func fnSumProduct(args []Value) Value {
+	if len(args) == 0 {
+		return Err(ErrValue)
+	}
+	rows, cols := args[0].Dims()
+	for _, arg := range args[1:] {
+		if r, c := arg.Dims(); r != rows || c != cols {
+			return Err(ErrValue)
+		}
+	}
+	total := 0.0
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			product := 1.0
+			for _, arg := range args {
+				v := arg.At(i, j)
+				if v.IsError() {
+					return v
+				}
+				if v.Kind != KindNumber {
+					product = 0
+					continue
+				}
+				product *= v.Num
+			}
+			total += product
+		}
+	}
+	return Num(total)
+}
+
+// mathFunc wraps a unary math function, lifting it over arrays.
+func mathFunc(f func(float64) float64) Function {
+	return func(args []Value) Value {
+		if len(args) != 1 {
+			return Err(ErrValue)
+		}
+		return lift1(args[0], func(v Value) Value {
+			num := toNumber(v)
+			if num.IsError() {
+				return num
+			}
+			return Num(f(num.Num))
+		})
+	}
+}
+
+func fnSqrt(args []Value) Value {
+	return mathFunc(func(f float64) float64 {
+		if f < 0 {
+			return math.NaN()
+		}
+		return math.Sqrt(f)
+	})(args)
+}
+
+func fnLn(args []Value) Value {
+	return mathFunc(func(f float64) float64 {
+		if f <= 0 {
+			return math.NaN()
+		}
+		return math.Log(f)
+	})(args)
+}
+
+func fnSign(args []Value) Value {
+	return mathFunc(func(f float64) float64 {
+		if f > 0 {
+			return 1
+		}
+		if f < 0 {
+			return -1
+		}
+		return 0
+	})(args)
+}
+
+func fnPi(args []Value) Value {
+	if len(args) != 0 {
+		return Err(ErrValue)
+	}
+	return Num(math.Pi)
+}
+
+// numberArgs coerces all args to numbers, returning the first error if any.
+func numberArgs(args []Value) ([]float64, *Value) {
+	nums := make([]float64, len(args))
+	for i, arg := range args {
+		num := toNumber(arg)
+		if num.IsError() {
+			return nil, &num
+		}
+		nums[i] = num.Num
+	}
+	return nums, nil
+}
+
+func fnMod(args []Value) Value {
+	if len(args) != 2 {
+		return Err(ErrValue)
+	}
+	nums, err := numberArgs(args)
+	if err != nil {
+		return *err
+	}
+	if nums[1] == 0 {
+		return Err(ErrDiv0)
+	}
+	// The result has the sign of the divisor in Excel
+	return Num(nums[0] - nums[1]*math.Floor(nums[0]/nums[1]))
+}
+
+func fnPower(args []Value) Value {
+	if len(args) != 2 {
+		return Err(ErrValue)
+	}
+	return binaryOp("^", args[0], args[1])
+}
+
+func roundAwayFromZero(f float64) float64 {
+	if f < 0 {
+		return -math.Ceil(-f)
+	}
+	return math.Ceil(f)
+}
+
+// roundFunc builds ROUND-like functions taking a number of digits.
+func roundFunc(round func(float64) float64) Function {
+	return func(args []Value) Value {
+		if len(args) != 2 {
+			return Err(ErrValue)
+		}
+		nums, err := numberArgs(args)
+		if err != nil {
+			return *err
+		}
+		scale := math.Pow(10, math.Trunc(nums[1]))
+		// Avoids floating point artifacts such as 2.675*100 = 267.49999...
+		scaled := math.Round(nums[0]*scale*1e9) / 1e9
+		return Num(round(scaled) / scale)
+	}
+}
+
+func fnTrunc(args []Value) Value {
+	if len(args) == 1 {
+		args = append(args, Num(0))
+	}
+	return roundFunc(math.Trunc)(args)
+}
+
+// logicals calls f on every boolean in args, with the same rules as numbers.
+// It returns #VALUE! if no boolean was found at all.
+func logicals(args []Value, f func(bool)) Value {
+	found := false
+	for _, arg := range args {
+		if arg.Kind == KindArray {
+			for _, v := range arg.Flatten() {
+				if v.IsError() {
+					return v
+				}
+				if v.Kind == KindBool || v.Kind == KindNumber {
+					f(toBool(v).Bool)
+					found = true
+				}
+			}
+			continue
+		}
+		b := toBool(arg)
+		if b.IsError() {
+			return b
+		}
+		f(b.Bool)
+		found = true
+	}
+	if !found {
+		return Err(ErrValue)
+	}
+	return Empty
+}
+
+func fnAnd(args []Value) Value {
+	res := true
+	if err := logicals(args, func(b bool) { res = res && b }); err.IsError() {
+		return err
+	}
+	return Bool(res)
+}
+
+func fnOr(args []Value) Value {
+	res := false
+	if err := logicals(args, func(b bool) { res = res || b }); err.IsError() {
+		return err
+	}
+	return Bool(res)
+}
+
+func fnXor(args []Value) Value {
+	res := false
+	if err := logicals(args, func(b bool) { res = res != b }); err.IsError() {
+		return err
+	}
+	return Bool(res)
+}
+
+func fnNot(args []Value) Value {
+	if len(args) != 1 {
+		return Err(ErrValue)
+	}
+	return lift1(args[0], func(v Value) Value {
+		b := toBool(v)
+		if b.IsError() {
+			return b
+		}
+		return Bool(!b.Bool)
+	})
+}
+
+func fnTrue(args []Value) Value {
+	return Bool(true)
+}
+
+func fnFalse(args []Value) Value {
+	return Bool(false)
+}
+
+// textFunc wraps a string to string function, lifting it over arrays.
+func textFunc(f func(string) string) Function {
+	return func(args []Value) Value {
+		if len(args) != 1 {
+			return Err(ErrValue)
+		}
+		return lift1(args[0], func(v Value) Value {
+			text := toText(v)
+			if text.IsError() {
+				return text
+			}
+			return Str(f(text.Str))
+		})
+	}
+}
+
+// trimSpaces removes leading and trailing spaces,
+// and collapses inner runs of spaces into one, like Excel's TRIM.
+func trimSpaces(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool { return r == ' ' }), " ")
+}
+
+func fnLen(args []Value) Value {
+	if len(args) != 1 {
+		return Err(ErrValue)
+	}
+	return lift1(args[0], func(v Value) Value {
+		text := toText(v)
+		if text.IsError() {
+			return text
+		}
+		return Num(float64(len([]rune(text.Str))))
+	})
+}
+
+// textAndCount reads the (text, [count]) arguments of LEFT and RIGHT.
+func textAndCount(args []Value) ([]rune, int, *Value) {
+	if len(args) < 1 || len(args) > 2 {
+		v := Err(ErrValue)
+		return nil, 0, &v
+	}
+	text := toText(args[0])
+	if text.IsError() {
+		return nil, 0, &text
+	}
+	count := 1
+	if len(args) == 2 {
+		num := toNumber(args[1])
+		if num.IsError() {
+			return nil, 0, &num
+		}
+		if num.Num < 0 {
+			v := Err(ErrValue)
+			return nil, 0, &v
+		}
+		count = int(num.Num)
+	}
+	runes := []rune(text.Str)
+	return runes, min(count, len(runes)), nil
+}
+
+func fnLeft(args []Value) Value {
+	runes, count, err := textAndCount(args)
+	if err != nil {
+		return *err
+	}
+	return Str(string(runes[:count]))
+}
+
+func fnRight(args []Value) Value {
+	runes, count, err := textAndCount(args)
+	if err != nil {
+		return *err
+	}
+	return Str(string(runes[len(runes)-count:]))
+}
+
+func fnMid(args []Value) Value {
+	if len(args) != 3 {
+		return Err(ErrValue)
+	}
+	text := toText(args[0])
+	if text.IsError() {
+		return text
+	}
+	nums, err := numberArgs(args[1:])
+	if err != nil {
+		return *err
+	}
+	start, count := int(nums[0]), int(nums[1])
+	if start < 1 || count < 0 {
+		return Err(ErrValue)
+	}
+	runes := []rune(text.Str)
+	if start > len(runes) {
+		return Str("")
+	}
+	end := min(start-1+count, len(runes))
+	return Str(string(runes[start-1 : end]))
+}
+
+func fnConcat(args []Value) Value {
+	var sb strings.Builder
+	for _, arg := range args {
+		for _, v := range arg.Flatten() {
+			text := toText(v)
+			if text.IsError() {
+				return text
+			}
+			sb.WriteString(text.Str)
+		}
+	}
+	return Str(sb.String())
+}
+
+func fnExact(args []Value) Value {
+	if len(args) != 2 {
+		return Err(ErrValue)
+	}
+	a, b := toText(args[0]), toText(args[1])
+	if a.IsError() {
+		return a
+	}
+	if b.IsError() {
+		return b
+	}
+	return Bool(a.Str == b.Str)
+}
+
+func fnRept(args []Value) Value {
+	if len(args) != 2 {
+		return Err(ErrValue)
+	}
+	text := toText(args[0])
+	if text.IsError() {
+		return text
+	}
+	count := toNumber(args[1])
+	if count.IsError() {
+		return count
+	}
+	if count.Num < 0 {
+		return Err(ErrValue)
+	}
+	return Str(strings.Repeat(text.Str, int(count.Num)))
+}
+
+func fnValue(args []Value) Value {
+	if len(args) != 1 {
+		return Err(ErrValue)
+	}
+	v := args[0].Scalar()
+	if v.Kind == KindString {
+		return parseNumber(v.Str)
+	}
+	return toNumber(v)
+}
+
+// isFunc builds the IS* information functions, which never propagate errors.
+func isFunc(pred func(Value) bool) Function {
+	return func(args []Value) Value {
+		if len(args) != 1 {
+			return Err(ErrValue)
+		}
+		return lift1(args[0], func(v Value) Value {
+			return Bool(pred(v))
+		})
+	}
+}
+
+func fnNA(args []Value) Value {
+	return Err(ErrNA)
+}
+
+func fnChoose(args []Value) Value {
+	if len(args) < 2 {
+		return Err(ErrValue)
+	}
+	index := toNumber(args[0])
+	if index.IsError() {
+		return index
+	}
+	i := int(index.Num)
+	if i < 1 || i >= len(args) {
+		return Err(ErrValue)
+	}
+	return args[i]
+}
+
+func fnIndex(args []Value) Value {
+	if len(args) < 2 || len(args) > 3 {
+		return Err(ErrValue)
+	}
+	array := args[0]
+	if array.IsError() {
+		return array
+	}
+	nums, err := numberArgs(args[1:])
+	if err != nil {
+		return *err
+	}
+	// Whole columns and rows are only read as far as the sheet goes,
+	// but are indexed as written: the cells past what was read are empty
+	readRows, readCols := array.Dims()
+	rows, cols := readRows, readCols
+	at := array.At
+	if array.Ref != nil {
+		r := array.Ref.Normalize()
+		rows, cols = int(r.End.Row-r.Start.Row), int(r.End.Col-r.Start.Col)
+		at = func(i, j int) Value {
+			if i >= readRows || j >= readCols {
+				return Empty
+			}
+			return array.Array[i][j]
+		}
+	}
+	row, col := int(nums[0]), 1
+	if len(nums) == 2 {
+		col = int(nums[1])
+	} else if rows == 1 {
+		// INDEX on a single row takes the position as a column
+		row, col = 1, row
+	}
+	if row < 0 || col < 0 || row > rows || col > cols {
+		return Err(ErrRef)
+	}
+	// A 0 row or column selects the whole column or row
+	if row == 0 || col == 0 {
+		out := make([][]Value, 0)
+		for i := 0; i < max(readRows, row); i++ {
+			if row != 0 && i != row-1 {
+				continue
+			}
+			line := make([]Value, 0)
+			for j := 0; j < max(readCols, col); j++ {
+				if col != 0 && j != col-1 {
+					continue
+				}
+				line = append(line, at(i, j))
+			}
+			out = append(out, line)
+		}
+		return Array(out)
+	}
+	val := at(row-1, col-1)
+	if array.Ref == nil {
+		return val
+	}
+	// INDEX of a reference is the reference to the cell, e.g. for A1:INDEX(B:B, 2)
+	cell := array.Ref.Normalize().Start
+	cell.Row += uint32(row - 1)
+	cell.Col += uint16(col - 1)
+	return Value{Kind: KindArray, Array: [][]Value{{val}}, Ref: &xl.Range{Start: cell, End: xl.Cell{Sheet: cell.Sheet, Row: cell.Row + 1, Col: cell.Col + 1}}}
+}
+
+// matchPosition implements MATCH over a flat list of values.
+// It returns a 0-based index, or -1 if nothing matches.
+func matchPosition(needle Value, haystack []Value, matchType int) int {
+	switch {
+	case matchType == 0:
+		for i, v := range haystack {
+			if v.Kind != KindEmpty && typeRank(v) == typeRank(needle) && compare(v, needle) == 0 {
+				return i
+			}
+		}
+	case matchType > 0:
+		// Largest value less than or equal to needle, assuming ascending order
+		found := -1
+		for i, v := range haystack {
+			if v.Kind == KindEmpty || typeRank(v) != typeRank(needle) {
+				continue
+			}
+			if compare(v, needle) > 0 {
+				break
+			}
+			found = i
+		}
+		return found
+	default:
+		// Smallest value greater than or equal to needle, assuming descending order
+		found := -1
+		for i, v := range haystack {
+			if v.Kind == KindEmpty || typeRank(v) != typeRank(needle) {
+				continue
+			}
+			if compare(v, needle) < 0 {
+				break
+			}
+			found = i
+		}
+		return found
+	}
+	return -1
+}
+
+func fnMatch(args []Value) Value {
+	if len(args) < 2 || len(args) > 3 {
+		return Err(ErrValue)
+	}
+	needle := args[0].Scalar()
+	if needle.IsError() {
+		return needle
+	}
+	rows, cols := args[1].Dims()
+	if rows != 1 && cols != 1 {
+		return Err(ErrNA)
+	}
+	matchType := 1
+	if len(args) == 3 {
+		num := toNumber(args[2])
+		if num.IsError() {
+			return num
+		}
+		matchType = int(num.Num)
+	}
+	pos := matchPosition(needle, args[1].Flatten(), matchType)
+	if pos < 0 {
+		return Err(ErrNA)
+	}
+	return Num(float64(pos + 1))
+}
+
+// lookup implements VLOOKUP and HLOOKUP. The table is given as a list of
+// lines to search the first element of, e.g. rows for VLOOKUP.
+func lookup(args []Value, lines func(Value) [][]Value) Value {
+	if len(args) < 3 || len(args) > 4 {
+		return Err(ErrValue)
+	}
+	needle := args[0].Scalar()
+	if needle.IsError() {
+		return needle
+	}
+	if args[1].IsError() {
+		return args[1]
+	}
+	index := toNumber(args[2])
+	if index.IsError() {
+		return index
+	}
+	approximate := Bool(true)
+	if len(args) == 4 {
+		approximate = toBool(args[3])
+		if approximate.IsError() {
+			return approximate
+		}
+	}
+	table := lines(args[1])
+	keys := make([]Value, len(table))
+	for i, line := range table {
+		keys[i] = line[0]
+	}
+	matchType := 0
+	if approximate.Bool {
+		matchType = 1
+	}
+	pos := matchPosition(needle, keys, matchType)
+	if pos < 0 {
+		return Err(ErrNA)
+	}
+	i := int(index.Num)
+	if i < 1 {
+		return Err(ErrValue)
+	}
+	if i > len(table[pos]) {
+		return Err(ErrRef)
+	}
+	return table[pos][i-1]
+}
+
+func fnVLookup(args []Value) Value {
+	return lookup(args, func(v Value) [][]Value {
+		rows, cols := v.Dims()
+		out := make([][]Value, rows)
+		for i := range out {
+			out[i] = make([]Value, cols)
+			for j := range out[i] {
+				out[i][j] = v.At(i, j)
+			}
+		}
+		return out
+	})
+}
+
+func fnHLookup(args []Value) Value {
+	return lookup(args, func(v Value) [][]Value {
+		rows, cols := v.Dims()
+		out := make([][]Value, cols)
+		for j := range out {
+			out[j] = make([]Value, rows)
+			for i := range out[j] {
+				out[j][i] = v.At(i, j)
+			}
+		}
+		return out
+	})
+}
+
+func fnRows(args []Value) Value {
+	if len(args) != 1 {
+		return Err(ErrValue)
+	}
+	rows, _ := refDims(args[0])
+	return Num(float64(rows))
+}
+
+func fnColumns(args []Value) Value {
+	if len(args) != 1 {
+		return Err(ErrValue)
+	}
+	_, cols := refDims(args[0])
+	return Num(float64(cols))
+}
+
+// refDims returns the dimensions of a value, or of the range it was read from,
+// since whole columns and rows are only read as far as their sheet goes.
+func refDims(v Value) (rows int, cols int) {
+	if v.Ref == nil {
+		return v.Dims()
+	}
+	r := v.Ref.Normalize()
+	return int(r.End.Row - r.Start.Row), int(r.End.Col - r.Start.Col)
+}
+
+func formIf(e *evaluator, args []parser.Node) (Value, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return Err(ErrValue), nil
+	}
+	cond, err := e.eval(args[0])
+	if err != nil {
+		return Value{}, err
+	}
+	if cond.Kind == KindArray {
+		if rows, cols := cond.Dims(); rows != 1 || cols != 1 {
+			return e.ifArray(cond, args[1:])
+		}
+	}
+	b := toBool(cond)
+	if b.IsError() {
+		return b, nil
+	}
+	if b.Bool {
+		return e.eval(args[1])
+	}
+	if len(args) == 3 {
+		return e.eval(args[2])
+	}
+	return Bool(false), nil
+}
+
+// ifArray evaluates IF with an array condition, which picks
+// between the two branches element by element.
+func (e *evaluator) ifArray(cond Value, branches []parser.Node) (Value, error) {
+	then, err := e.eval(branches[0])
+	if err != nil {
+		return Value{}, err
+	}
+	otherwise := Bool(false)
+	if len(branches) == 2 {
+		if otherwise, err = e.eval(branches[1]); err != nil {
+			return Value{}, err
+		}
+	}
+	return lift2(cond, lift2(then, otherwise, func(t Value, o Value) Value {
+		return Array([][]Value{{t, o}})
+	}), func(c Value, pair Value) Value {
+		b := toBool(c)
+		if b.IsError() {
+			return b
+		}
+		if b.Bool {
+			return pair.Array[0][0]
+		}
+		return pair.Array[0][1]
+	}), nil
+}
+
+func formIfError(e *evaluator, args []parser.Node) (Value, error) {
+	return ifErrorLike(e, args, func(v Value) bool { return v.IsError() })
+}
+
+func formIfNA(e *evaluator, args []parser.Node) (Value, error) {
+	return ifErrorLike(e, args, func(v Value) bool { return v.IsError() && v.Err == ErrNA })
+}
+
+func ifErrorLike(e *evaluator, args []parser.Node, caught func(Value) bool) (Value, error) {
+	if len(args) != 2 {
+		return Err(ErrValue), nil
+	}
+	val, err := e.eval(args[0])
+	if err != nil {
+		return Value{}, err
+	}
+	if val.Kind != KindArray {
+		if caught(val) {
+			return e.eval(args[1])
+		}
+		return val, nil
+	}
+	fallback, err := e.eval(args[1])
+	if err != nil {
+		return Value{}, err
+	}
+	return lift1(val, func(v Value) Value {
+		if caught(v) {
+			return fallback.Scalar()
+		}
+		return v
+	}), nil
+}
+
+func formIfs(e *evaluator, args []parser.Node) (Value, error) {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return Err(ErrValue), nil
+	}
+	for i := 0; i < len(args); i += 2 {
+		cond, err := e.eval(args[i])
+		if err != nil {
+			return Value{}, err
+		}
+		b := toBool(cond)
+		if b.IsError() {
+			return b, nil
+		}
+		if b.Bool {
+			return e.eval(args[i+1])
+		}
+	}
+	return Err(ErrNA), nil
+}
+
+func formSwitch(e *evaluator, args []parser.Node) (Value, error) {
+	if len(args) < 3 {
+		return Err(ErrValue), nil
+	}
+	val, err := e.eval(args[0])
+	if err != nil {
+		return Value{}, err
+	}
+	val = val.Scalar()
+	if val.IsError() {
+		return val, nil
+	}
+	i := 1
+	for ; i+1 < len(args); i += 2 {
+		candidate, err := e.eval(args[i])
+		if err != nil {
+			return Value{}, err
+		}
+		candidate = candidate.Scalar()
+		if typeRank(candidate) == typeRank(val) && compare(candidate, val) == 0 {
+			return e.eval(args[i+1])
+		}
+	}
+	// The last argument is the default, if there's an odd one left
+	if i < len(args) {
+		return e.eval(args[i])
+	}
+	return Err(ErrNA), nil
+}
+
+func formRow(e *evaluator, args []parser.Node) (Value, error) {
+	r, errVal, err := referenceArg(e, args)
+	if err != nil || errVal.IsError() {
+		return errVal, err
+	}
+	if r.End.Row-r.Start.Row == 1 {
+		return Num(float64(r.Start.Row + 1)), nil
+	}
+	// ROW of a multi-row range is a vertical array
+	rows := make([][]Value, 0, r.End.Row-r.Start.Row)
+	for i := r.Start.Row; i < r.End.Row; i++ {
+		rows = append(rows, []Value{Num(float64(i + 1))})
+	}
+	return Array(rows), nil
+}
+
+func formColumn(e *evaluator, args []parser.Node) (Value, error) {
+	r, errVal, err := referenceArg(e, args)
+	if err != nil || errVal.IsError() {
+		return errVal, err
+	}
+	if r.End.Col-r.Start.Col == 1 {
+		return Num(float64(r.Start.Col + 1)), nil
+	}
+	// COLUMN of a multi-column range is a horizontal array
+	cols := make([]Value, 0, r.End.Col-r.Start.Col)
+	for j := r.Start.Col; j < r.End.Col; j++ {
+		cols = append(cols, Num(float64(j+1)))
+	}
+	return Array([][]Value{cols}), nil
+}
+
+// referenceArg reads the optional reference argument of ROW and COLUMN,
+// defaulting to the host cell. If the argument is not a reference,
+// the returned value holds the Excel error to give back.
+func referenceArg(e *evaluator, args []parser.Node) (xl.Range, Value, error) {
+	if len(args) > 1 {
+		return xl.Range{}, Err(ErrValue), nil
+	}
+	if len(args) == 0 {
+		host := e.ctx.Host
+		return xl.Range{Start: host, End: xl.Cell{Sheet: host.Sheet, Row: host.Row + 1, Col: host.Col + 1}}, Empty, nil
+	}
+	ref, err := e.eval(args[0])
+	if err != nil {
+		return xl.Range{}, Value{}, err
+	}
+	if ref.IsError() {
+		return xl.Range{}, ref, nil
+	}
+	if ref.Ref == nil {
+		return xl.Range{}, Err(ErrValue), nil
+	}
+	return *ref.Ref, Empty, nil
+}
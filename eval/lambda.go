@@ -0,0 +1,288 @@
+package eval
+
+import (
+	"github.com/usr-ein/excelparser/parser"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+// Lambda is a function defined by LAMBDA, along with the names bound
+// where it was defined, which its body can use.
+type Lambda struct {
+	// Keys of the parameters, see parser.IdentifierKey
+	Params []string
+	Body   parser.Node
+
+	scope map[string]Value
+}
+
+// Beyond this many nested lambda calls, e.g. for a recursive lambda that never stops,
+// calls evaluate to #NUM! like in Excel.
+const maxCallDepth = 1000
+
+// within returns an evaluator of the same formula, for the names bound in scope.
+func (e *evaluator) within(scope map[string]Value) *evaluator {
+	inner := *e
+	inner.scope = scope
+	return &inner
+}
+
+// bind returns a copy of scope where key is bound to v.
+func bind(scope map[string]Value, key string, v Value) map[string]Value {
+	res := make(map[string]Value, len(scope)+1)
+	for k, val := range scope {
+		res[k] = val
+	}
+	res[key] = v
+	return res
+}
+
+// evalIdentifier looks up a name bound by LET or LAMBDA, or #NAME? if it isn't bound.
+func (e *evaluator) evalIdentifier(n parser.IdentifierNode) Value {
+	v, ok := e.scope[parser.IdentifierKey(n.Name)]
+	if !ok {
+		return Err(ErrName)
+	}
+	return v
+}
+
+// evalCall calls the lambda its callee computes to, or #VALUE! if it isn't one.
+func (e *evaluator) evalCall(n parser.CallNode) (Value, error) {
+	callee, err := e.eval(n.Callee)
+	if err != nil {
+		return Value{}, err
+	}
+	return e.callLambda(callee, n.Arguments)
+}
+
+// callLambda evaluates args and calls the lambda fn with them.
+func (e *evaluator) callLambda(fn Value, args []parser.Node) (Value, error) {
+	if fn.IsError() {
+		return fn, nil
+	}
+	values, err := e.evalArgs(args)
+	if err != nil {
+		return Value{}, err
+	}
+	return e.apply(fn, values...)
+}
+
+// apply calls the lambda fn with already evaluated arguments.
+// Calls with the wrong number of arguments, or of something else than a lambda, give #VALUE!.
+func (e *evaluator) apply(fn Value, args ...Value) (Value, error) {
+	if fn.Kind != KindLambda || len(args) != len(fn.Lambda.Params) {
+		return Err(ErrValue), nil
+	}
+	if e.depth >= maxCallDepth {
+		return Err(ErrNum), nil
+	}
+	scope := fn.Lambda.scope
+	for i, param := range fn.Lambda.Params {
+		scope = bind(scope, param, args[i])
+	}
+	inner := e.within(scope)
+	inner.depth++
+	return inner.eval(fn.Lambda.Body)
+}
+
+func (e *evaluator) evalArgs(args []parser.Node) ([]Value, error) {
+	values := make([]Value, len(args))
+	for i, arg := range args {
+		val, err := e.eval(arg)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = val
+	}
+	return values, nil
+}
+
+// formLet evaluates LET(name1, value1, [name2, value2, ...], calculation).
+func formLet(e *evaluator, args []parser.Node) (Value, error) {
+	if len(args) < 3 || len(args)%2 == 0 {
+		return Err(ErrValue), nil
+	}
+	scope := e.scope
+	for i := 0; i+1 < len(args); i += 2 {
+		name, ok := args[i].(parser.IdentifierNode)
+		if !ok {
+			return Err(ErrValue), nil
+		}
+		val, err := e.within(scope).eval(args[i+1])
+		if err != nil {
+			return Value{}, err
+		}
+		scope = bind(scope, parser.IdentifierKey(name.Name), val)
+	}
+	return e.within(scope).eval(args[len(args)-1])
+}
+
+// formLambda evaluates LAMBDA([param1, param2, ...], calculation) to a lambda,
+// which closes over the names bound where it is defined.
+func formLambda(e *evaluator, args []parser.Node) (Value, error) {
+	if len(args) == 0 {
+		return Err(ErrValue), nil
+	}
+	params := make([]string, len(args)-1)
+	for i, arg := range args[:len(args)-1] {
+		param, ok := arg.(parser.IdentifierNode)
+		if !ok {
+			return Err(ErrValue), nil
+		}
+		params[i] = parser.IdentifierKey(param.Name)
+	}
+	return Value{Kind: KindLambda, Lambda: &Lambda{Params: params, Body: args[len(args)-1], scope: e.scope}}, nil
+}
+
+// lambdaArgs evaluates the arguments of a helper function like MAP, whose last one must be a lambda.
+// If they are wrong, the returned value holds the Excel error to give back.
+func lambdaArgs(e *evaluator, args []parser.Node, minArgs int, maxArgs int) ([]Value, Value, error) {
+	if len(args) < minArgs || len(args) > maxArgs {
+		return nil, Err(ErrValue), nil
+	}
+	values, err := e.evalArgs(args)
+	if err != nil {
+		return nil, Value{}, err
+	}
+	if values[len(values)-1].Kind != KindLambda {
+		return nil, Err(ErrValue), nil
+	}
+	return values, Empty, nil
+}
+
+// formMap evaluates MAP(array1, [array2, ...], lambda), calling lambda
+// with the elements of the arrays at each position.
+func formMap(e *evaluator, args []parser.Node) (Value, error) {
+	values, errVal, err := lambdaArgs(e, args, 2, 255)
+	if err != nil || errVal.IsError() {
+		return errVal, err
+	}
+	arrays, fn := values[:len(values)-1], values[len(values)-1]
+	rows, cols := 0, 0
+	for _, array := range arrays {
+		r, c := array.Dims()
+		rows, cols = max(rows, r), max(cols, c)
+	}
+	return makeArray(rows, cols, func(i int, j int) (Value, error) {
+		elems := make([]Value, len(arrays))
+		for k, array := range arrays {
+			elems[k] = array.At(i, j)
+		}
+		return e.apply(fn, elems...)
+	})
+}
+
+// formReduce evaluates REDUCE([initial], array, lambda), accumulating the elements
+// of array through lambda(accumulator, value).
+func formReduce(e *evaluator, args []parser.Node) (Value, error) {
+	values, errVal, err := lambdaArgs(e, args, 2, 3)
+	if err != nil || errVal.IsError() {
+		return errVal, err
+	}
+	acc, array, fn := accumulatorArgs(values)
+	for _, v := range array.Flatten() {
+		if acc, err = e.apply(fn, acc, v); err != nil {
+			return Value{}, err
+		}
+	}
+	return acc, nil
+}
+
+// formScan evaluates SCAN([initial], array, lambda) like REDUCE,
+// but returns every intermediate value of the accumulator, in the shape of array.
+func formScan(e *evaluator, args []parser.Node) (Value, error) {
+	values, errVal, err := lambdaArgs(e, args, 2, 3)
+	if err != nil || errVal.IsError() {
+		return errVal, err
+	}
+	acc, array, fn := accumulatorArgs(values)
+	rows, cols := array.Dims()
+	return makeArray(rows, cols, func(i int, j int) (Value, error) {
+		acc, err = e.apply(fn, acc, array.At(i, j))
+		return acc, err
+	})
+}
+
+// accumulatorArgs splits the arguments of REDUCE and SCAN, whose initial value defaults to empty.
+func accumulatorArgs(values []Value) (initial Value, array Value, fn Value) {
+	if len(values) == 2 {
+		return Empty, values[0], values[1]
+	}
+	return values[0].Scalar(), values[1], values[2]
+}
+
+// formByRow evaluates BYROW(array, lambda), calling lambda with each row of array.
+func formByRow(e *evaluator, args []parser.Node) (Value, error) {
+	values, errVal, err := lambdaArgs(e, args, 2, 2)
+	if err != nil || errVal.IsError() {
+		return errVal, err
+	}
+	array, fn := values[0], values[1]
+	rows, cols := array.Dims()
+	return makeArray(rows, 1, func(i int, _ int) (Value, error) {
+		row := make([]Value, cols)
+		for j := range row {
+			row[j] = array.At(i, j)
+		}
+		return e.apply(fn, Array([][]Value{row}))
+	})
+}
+
+// formByCol evaluates BYCOL(array, lambda), calling lambda with each column of array.
+func formByCol(e *evaluator, args []parser.Node) (Value, error) {
+	values, errVal, err := lambdaArgs(e, args, 2, 2)
+	if err != nil || errVal.IsError() {
+		return errVal, err
+	}
+	array, fn := values[0], values[1]
+	rows, cols := array.Dims()
+	return makeArray(1, cols, func(_ int, j int) (Value, error) {
+		col := make([][]Value, rows)
+		for i := range col {
+			col[i] = []Value{array.At(i, j)}
+		}
+		return e.apply(fn, Array(col))
+	})
+}
+
+// formMakeArray evaluates MAKEARRAY(rows, columns, lambda), calling lambda
+// with the 1-based row and column of each element.
+func formMakeArray(e *evaluator, args []parser.Node) (Value, error) {
+	values, errVal, err := lambdaArgs(e, args, 3, 3)
+	if err != nil || errVal.IsError() {
+		return errVal, err
+	}
+	rows, cols, fn := toNumber(values[0]), toNumber(values[1]), values[2]
+	if rows.IsError() {
+		return rows, nil
+	}
+	if cols.IsError() {
+		return cols, nil
+	}
+	// Arrays can't be larger than a sheet
+	if rows.Num < 1 || cols.Num < 1 || rows.Num > xl.MAX_ROWS || cols.Num > xl.MAX_COLS {
+		return Err(ErrValue), nil
+	}
+	return makeArray(int(rows.Num), int(cols.Num), func(i int, j int) (Value, error) {
+		return e.apply(fn, Num(float64(i+1)), Num(float64(j+1)))
+	})
+}
+
+// makeArray builds an array of the given size from the results of f,
+// which must be single values: arrays give #CALC! like in Excel.
+func makeArray(rows int, cols int, f func(i int, j int) (Value, error)) (Value, error) {
+	array := make([][]Value, rows)
+	for i := range array {
+		array[i] = make([]Value, cols)
+		for j := range array[i] {
+			val, err := f(i, j)
+			if err != nil {
+				return Value{}, err
+			}
+			if r, c := val.Dims(); r != 1 || c != 1 {
+				val = Err(ErrCalc)
+			}
+			array[i][j] = val.Scalar()
+		}
+	}
+	return Array(array), nil
+}
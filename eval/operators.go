@@ -0,0 +1,275 @@
+package eval
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+func unaryOp(operator string, operand Value) Value {
+	return lift1(operand, func(v Value) Value {
+		switch operator {
+		case "-":
+			num := toNumber(v)
+			if num.IsError() {
+				return num
+			}
+			return Num(-num.Num)
+		case "%":
+			num := toNumber(v)
+			if num.IsError() {
+				return num
+			}
+			return Num(num.Num / 100)
+		case "+":
+			return v
+		default:
+			return Err(ErrValue)
+		}
+	})
+}
+
+func binaryOp(operator string, left Value, right Value) Value {
+	return lift2(left, right, func(l Value, r Value) Value {
+		switch operator {
+		case "+", "-", "*", "/", "^":
+			return arithmetic(operator, l, r)
+		case "&":
+			lt, rt := toText(l), toText(r)
+			if lt.IsError() {
+				return lt
+			}
+			if rt.IsError() {
+				return rt
+			}
+			return Str(lt.Str + rt.Str)
+		case "=", "<>", "<", "<=", ">", ">=":
+			if l.IsError() {
+				return l
+			}
+			if r.IsError() {
+				return r
+			}
+			cmp := compare(l, r)
+			switch operator {
+			case "=":
+				return Bool(cmp == 0)
+			case "<>":
+				return Bool(cmp != 0)
+			case "<":
+				return Bool(cmp < 0)
+			case "<=":
+				return Bool(cmp <= 0)
+			case ">":
+				return Bool(cmp > 0)
+			default:
+				return Bool(cmp >= 0)
+			}
+		default:
+			return Err(ErrValue)
+		}
+	})
+}
+
+func arithmetic(operator string, l Value, r Value) Value {
+	ln, rn := toNumber(l), toNumber(r)
+	if ln.IsError() {
+		return ln
+	}
+	if rn.IsError() {
+		return rn
+	}
+	a, b := ln.Num, rn.Num
+	switch operator {
+	case "+":
+		return Num(a + b)
+	case "-":
+		return Num(a - b)
+	case "*":
+		return Num(a * b)
+	case "/":
+		if b == 0 {
+			return Err(ErrDiv0)
+		}
+		return Num(a / b)
+	default:
+		if a == 0 && b == 0 {
+			return Err(ErrNum)
+		}
+		if a == 0 && b < 0 {
+			return Err(ErrDiv0)
+		}
+		return Num(math.Pow(a, b))
+	}
+}
+
+// lift1 applies f to every element of an array, or to the value itself if it's a scalar.
+func lift1(v Value, f func(Value) Value) Value {
+	if v.Kind != KindArray {
+		return f(v)
+	}
+	rows, cols := v.Dims()
+	if rows == 1 && cols == 1 {
+		return f(v.Array[0][0])
+	}
+	out := make([][]Value, rows)
+	for i := range out {
+		out[i] = make([]Value, cols)
+		for j := range out[i] {
+			out[i][j] = f(v.Array[i][j])
+		}
+	}
+	return Array(out)
+}
+
+// lift2 applies f pairwise over two values, broadcasting scalars
+// and single rows/columns the way Excel does for array formulas.
+func lift2(a Value, b Value, f func(Value, Value) Value) Value {
+	if a.Kind != KindArray && b.Kind != KindArray {
+		return f(a, b)
+	}
+	aRows, aCols := a.Dims()
+	bRows, bCols := b.Dims()
+	rows, cols := max(aRows, bRows), max(aCols, bCols)
+	if rows == 1 && cols == 1 {
+		return f(a.At(0, 0), b.At(0, 0))
+	}
+	out := make([][]Value, rows)
+	for i := range out {
+		out[i] = make([]Value, cols)
+		for j := range out[i] {
+			out[i][j] = f(a.At(i, j), b.At(i, j))
+		}
+	}
+	return Array(out)
+}
+
+// toNumber coerces a value to a number, following Excel's rules for arithmetic operators:
+// booleans are 0 or 1, empty is 0, and text must look like a number.
+func toNumber(v Value) Value {
+	switch v.Kind {
+	case KindNumber, KindError:
+		return v
+	case KindBool:
+		if v.Bool {
+			return Num(1)
+		}
+		return Num(0)
+	case KindEmpty:
+		return Num(0)
+	case KindString:
+		return parseNumber(v.Str)
+	case KindArray:
+		return toNumber(v.Scalar())
+	}
+	return Err(ErrValue)
+}
+
+func parseNumber(s string) Value {
+	s = strings.TrimSpace(s)
+	percent := strings.HasSuffix(s, "%")
+	s = strings.TrimSuffix(s, "%")
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return Err(ErrValue)
+	}
+	if percent {
+		f /= 100
+	}
+	return Num(f)
+}
+
+// toText coerces a value to text, as the & operator does.
+func toText(v Value) Value {
+	switch v.Kind {
+	case KindString, KindError:
+		return v
+	case KindArray:
+		return toText(v.Scalar())
+	default:
+		return Str(v.String())
+	}
+}
+
+// toBool coerces a value to a boolean, as logical functions do.
+func toBool(v Value) Value {
+	switch v.Kind {
+	case KindBool, KindError:
+		return v
+	case KindNumber:
+		return Bool(v.Num != 0)
+	case KindEmpty:
+		return Bool(false)
+	case KindString:
+		switch strings.ToUpper(v.Str) {
+		case "TRUE":
+			return Bool(true)
+		case "FALSE":
+			return Bool(false)
+		}
+		return Err(ErrValue)
+	case KindArray:
+		return toBool(v.Scalar())
+	}
+	return Err(ErrValue)
+}
+
+// compare orders two scalar values like Excel's comparison operators do:
+// numbers < text < booleans, text is case-insensitive, and an empty
+// value takes the zero value of the other operand's type.
+func compare(a Value, b Value) int {
+	if a.Kind == KindEmpty {
+		a = zeroOf(b)
+	}
+	if b.Kind == KindEmpty {
+		b = zeroOf(a)
+	}
+	if rankA, rankB := typeRank(a), typeRank(b); rankA != rankB {
+		return rankA - rankB
+	}
+	switch a.Kind {
+	case KindNumber:
+		if a.Num < b.Num {
+			return -1
+		}
+		if a.Num > b.Num {
+			return 1
+		}
+		return 0
+	case KindString:
+		return strings.Compare(strings.ToLower(a.Str), strings.ToLower(b.Str))
+	case KindBool:
+		if a.Bool == b.Bool {
+			return 0
+		}
+		if !a.Bool {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+func zeroOf(v Value) Value {
+	switch v.Kind {
+	case KindString:
+		return Str("")
+	case KindBool:
+		return Bool(false)
+	default:
+		return Num(0)
+	}
+}
+
+func typeRank(v Value) int {
+	switch v.Kind {
+	case KindNumber, KindEmpty:
+		return 0
+	case KindString:
+		return 1
+	case KindBool:
+		return 2
+	default:
+		return 3
+	}
+}
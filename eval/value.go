@@ -0,0 +1,245 @@
+package eval
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/usr-ein/excelparser/xl"
+)
+
+// Kind is the type of a Value produced while evaluating a formula.
+type Kind uint8
+
+const (
+	KindEmpty Kind = iota
+	KindNumber
+	KindString
+	KindBool
+	KindError
+	KindArray
+	KindLambda
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindEmpty:
+		return "empty"
+	case KindNumber:
+		return "number"
+	case KindString:
+		return "string"
+	case KindBool:
+		return "bool"
+	case KindError:
+		return "error"
+	case KindArray:
+		return "array"
+	case KindLambda:
+		return "lambda"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrorCode is an Excel error value, such as #DIV/0! or #N/A.
+// Excel errors are regular values: they flow through operators and
+// functions until something like IFERROR catches them.
+type ErrorCode = xl.ErrorCode
+
+// The error codes the evaluator produces, see xl for all of them.
+const (
+	ErrNull  = xl.ErrorNull
+	ErrDiv0  = xl.ErrorDiv0
+	ErrValue = xl.ErrorValue
+	ErrRef   = xl.ErrorRef
+	ErrName  = xl.ErrorName
+	ErrNum   = xl.ErrorNum
+	ErrNA    = xl.ErrorNA
+	ErrCalc  = xl.ErrorCalc
+)
+
+// Value is the result of evaluating a node.
+// Only the field matching Kind is meaningful.
+type Value struct {
+	Kind Kind
+
+	Num  float64
+	Str  string
+	Bool bool
+	Err  ErrorCode
+
+	// Rows of the array, for KindArray.
+	Array [][]Value
+	// If the array was read from a range reference, this is the range.
+	Ref *xl.Range
+
+	// Function defined by LAMBDA, for KindLambda.
+	Lambda *Lambda
+}
+
+var Empty = Value{Kind: KindEmpty}
+
+func Num(f float64) Value {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Err(ErrNum)
+	}
+	return Value{Kind: KindNumber, Num: f}
+}
+
+func Str(s string) Value {
+	return Value{Kind: KindString, Str: s}
+}
+
+func Bool(b bool) Value {
+	return Value{Kind: KindBool, Bool: b}
+}
+
+func Err(code ErrorCode) Value {
+	return Value{Kind: KindError, Err: code}
+}
+
+func Array(rows [][]Value) Value {
+	return Value{Kind: KindArray, Array: rows}
+}
+
+func (v Value) IsError() bool {
+	return v.Kind == KindError
+}
+
+// Dims returns the number of rows and columns of an array value.
+// Scalars are 1x1.
+func (v Value) Dims() (rows int, cols int) {
+	if v.Kind != KindArray {
+		return 1, 1
+	}
+	if len(v.Array) == 0 {
+		return 0, 0
+	}
+	return len(v.Array), len(v.Array[0])
+}
+
+// At returns the element at the given position of an array value.
+// Scalars are broadcast, and out of bounds positions give #N/A
+// like Excel does when it lifts operators over arrays of different sizes.
+func (v Value) At(row int, col int) Value {
+	if v.Kind != KindArray {
+		return v
+	}
+	rows, cols := v.Dims()
+	if rows == 1 && cols == 1 {
+		return v.Array[0][0]
+	}
+	if rows == 1 {
+		row = 0
+	}
+	if cols == 1 {
+		col = 0
+	}
+	if row >= rows || col >= cols {
+		return Err(ErrNA)
+	}
+	return v.Array[row][col]
+}
+
+// Scalar collapses an array to its top-left value.
+func (v Value) Scalar() Value {
+	if v.Kind != KindArray {
+		return v
+	}
+	if rows, cols := v.Dims(); rows == 0 || cols == 0 {
+		return Err(ErrValue)
+	}
+	return v.Array[0][0]
+}
+
+// Flatten returns all the values of an array, row by row.
+// Scalars give a single value.
+func (v Value) Flatten() []Value {
+	if v.Kind != KindArray {
+		return []Value{v}
+	}
+	flat := make([]Value, 0)
+	for _, row := range v.Array {
+		flat = append(flat, row...)
+	}
+	return flat
+}
+
+func (v Value) String() string {
+	switch v.Kind {
+	case KindEmpty:
+		return ""
+	case KindNumber:
+		return formatNumber(v.Num)
+	case KindString:
+		return v.Str
+	case KindBool:
+		if v.Bool {
+			return "TRUE"
+		}
+		return "FALSE"
+	case KindError:
+		return string(v.Err)
+	case KindArray:
+		rows := make([]string, len(v.Array))
+		for i, row := range v.Array {
+			cols := make([]string, len(row))
+			for j, val := range row {
+				cols[j] = val.String()
+			}
+			rows[i] = strings.Join(cols, ",")
+		}
+		return "{" + strings.Join(rows, ";") + "}"
+	case KindLambda:
+		// Like in cells, where lambdas must be called
+		return string(ErrCalc)
+	default:
+		return "unknown"
+	}
+}
+
+// formatNumber formats a number the way Excel's General format would
+// when turning it into text, e.g. for concatenation.
+func formatNumber(f float64) string {
+	if f == math.Trunc(f) && math.Abs(f) < 1e15 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'G', 15, 64)
+}
+
+func fromCVal(c xl.CVal) Value {
+	c = c.Computed()
+	switch c.Type {
+	case xl.CTNumber:
+		return Num(float64(c.ValNumber))
+	case xl.CTString:
+		return Str(c.ValString)
+	case xl.CTBool:
+		return Bool(c.ValBool)
+	case xl.CTError:
+		return Err(c.ValError)
+	default:
+		return Empty
+	}
+}
+
+// ToCVal converts a value into a cell value.
+// Arrays are collapsed to their top-left element, and lambdas give #CALC!.
+func (v Value) ToCVal() xl.CVal {
+	v = v.Scalar()
+	switch v.Kind {
+	case KindNumber:
+		return xl.CVal{Type: xl.CTNumber, ValNumber: float32(v.Num)}
+	case KindString:
+		return xl.CVal{Type: xl.CTString, ValString: v.Str}
+	case KindBool:
+		return xl.CVal{Type: xl.CTBool, ValBool: v.Bool}
+	case KindError:
+		return xl.CVal{Type: xl.CTError, ValError: v.Err}
+	case KindLambda:
+		return xl.CVal{Type: xl.CTError, ValError: ErrCalc}
+	default:
+		return xl.CValEmpty
+	}
+}
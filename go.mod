@@ -5,7 +5,6 @@ go 1.23.3
 require (
 	github.com/bradleyjkemp/cupaloy v2.3.0+incompatible
 	github.com/pkg/errors v0.9.1
-	github.com/xuri/efp v0.0.0-20241211021726-c4e992084aa6
 )
 
 require (
@@ -15,6 +15,8 @@ type ShuntingYard = shuntingyard.ShuntingYardState[Node]
 // PrecedenceMap is a map of binary operators to their precedence.
 // It lets us know which operators should be evaluated first.
 var PrecedenceMap = map[string]int{
+	// range between references, e.g. A1:INDEX(B:B, 2)
+	":": 10,
 	// cell range union and intersect
 	" ": 8,
 	",": 8,
@@ -41,6 +43,8 @@ var PrecedenceMap = map[string]int{
 // True if A OP B == B OP A
 // False if A OP B != B OP A
 var IsCommutative = map[string]bool{
+	// range between references
+	":": true,
 	// cell range union and intersect
 	" ": true,
 	",": false,
@@ -67,18 +71,33 @@ var IsCommutative = map[string]bool{
 // the formula root.
 // The context parameter is used to resolve relative cell references,
 // and contains the current sheet name, and other context information necessary.
+//
+// Errors are always of type *ParseError.
 func BuildTree(ctx Context, tokens []Token) (Node, error) {
 	// named parseFormula in original
+	if !slices.ContainsFunc(tokens, func(token Token) bool { return !token.isTrivia() }) {
+		return nil, toParseError(newParseError(ParseErrorEmptyFormula, len(tokens), nil), len(tokens), tokens)
+	}
+	if i := slices.IndexFunc(tokens, isUnterminatedLiteral); i >= 0 {
+		return nil, toParseError(newParseError(ParseErrorUnterminatedLiteral, i, nil), i, tokens)
+	}
 	stream := NewTokenStream(tokens)
 	shuntingYard := shuntingyard.NewShuntingYardState[Node]()
 
 	if err := parseExpression(ctx, stream, shuntingYard); err != nil {
-		return nil, err
+		return nil, toParseError(err, stream.Position(), tokens)
+	}
+	if !stream.NextIsEnd() {
+		return nil, toParseError(unexpectedToken(stream), stream.Position(), tokens)
 	}
 
 	retVal, ok := shuntingYard.Operands.Top()
 	if !ok {
-		return nil, errors.New("no top operand found after parsing formula")
+		return nil, toParseError(errors.New("no top operand found after parsing formula"), stream.Position(), tokens)
+	}
+	if t := triviaOf(retVal); t != nil {
+		// The whitespace around the formula goes with its root
+		t.outerStart, t.outerEnd = tokens[0].Offset, tokens[len(tokens)-1].end()
 	}
 	return retVal, nil
 }
@@ -99,7 +118,7 @@ func parseExpression(ctx Context, stream TokenStream, shuntingYard ShuntingYard)
 		pos = stream.Position()
 		binaryOperator, err := createBinaryOperator(stream.GetNext().Value)
 		if err != nil {
-			return err
+			return newParseError(ParseErrorInvalidOperator, stream.Position(), err)
 		}
 		if err := pushOperator(binaryOperator, shuntingYard); err != nil {
 			return err
@@ -125,12 +144,15 @@ func parseExpression(ctx Context, stream TokenStream, shuntingYard ShuntingYard)
 }
 
 func parseOperandExpression(ctx Context, stream TokenStream, shuntingYard ShuntingYard) error {
+	start := stream.GetNext().Offset
 	if stream.NextIsTerminal() {
+		pos, code := stream.Position(), terminalErrorCode(stream)
 		operand, err := parseTerminal(ctx, stream)
 		if err != nil {
-			return errors.Wrap(err, "failed to parse terminal")
+			return newParseError(code, pos, err)
 		}
 		shuntingYard.Operands.Push(operand)
+		spanOperand(ctx, stream, shuntingYard, start)
 		// parseTerminal already consumes once so don't need to consume on line below
 		// stream.consume()
 	} else if stream.NextIsOpenParen() {
@@ -144,13 +166,23 @@ func parseOperandExpression(ctx Context, stream TokenStream, shuntingYard Shunti
 			return errors.Wrap(err, "failed to parse subexpression within sentinel")
 		}
 		// close paren
+		if !stream.NextIsCloseParen() {
+			return unexpectedToken(stream)
+		}
 		if err := stream.Consume(); err != nil {
 			return errors.Wrap(err, "failed to consume close paren")
 		}
+		parenthesizeOperand(ctx, stream, shuntingYard, start)
+		if err := parseCalls(ctx, stream, shuntingYard); err != nil {
+			return errors.Wrap(err, "failed to parse call")
+		}
 	} else if stream.NextIsPrefixOperator() {
 		unaryOperator, err := createUnaryOperator(stream.GetNext().Value)
 		if err != nil {
-			return errors.Wrap(err, "failed to create unary operator")
+			return newParseError(ParseErrorInvalidOperator, stream.Position(), err)
+		}
+		if ctx.Lossless {
+			unaryOperator = spannedOperator{Operator: unaryOperator, offset: start}
 		}
 		if err := pushOperator(unaryOperator, shuntingYard); err != nil {
 			return errors.Wrap(err, "failed to push unary operator")
@@ -161,64 +193,132 @@ func parseOperandExpression(ctx Context, stream TokenStream, shuntingYard Shunti
 		if err := parseOperandExpression(ctx, stream, shuntingYard); err != nil {
 			return errors.Wrap(err, "failed to parse operand expression")
 		}
+	} else if stream.NextIsArray() {
+		operand, err := parseArray(stream)
+		if err != nil {
+			return errors.Wrap(err, "failed to parse array")
+		}
+		shuntingYard.Operands.Push(operand)
+		spanOperand(ctx, stream, shuntingYard, start)
 	} else if stream.NextIsFunctionCall() {
 		if err := parseFunctionCall(ctx, stream, shuntingYard); err != nil {
 			return errors.Wrap(err, "failed to parse function call")
 		}
+	} else {
+		// Nothing that starts an operand, e.g. the ) of =1+()
+		return unexpectedToken(stream)
+	}
+	return parsePostfixOperators(stream, shuntingYard)
+}
+
+// parsePostfixOperators applies the postfix operators after the operand
+// on top of the shunting yard, if any, e.g. % in =A1%.
+func parsePostfixOperators(stream TokenStream, shuntingYard ShuntingYard) error {
+	for stream.NextIsPostfixOperator() {
+		operand, ok := shuntingYard.Operands.Pop()
+		if !ok {
+			return errors.New("failed to pop operand of postfix operator")
+		}
+		node := UnaryExpressionNode{Operator: stream.GetNext().Value, Operand: operand}
+		if err := stream.Consume(); err != nil {
+			return errors.Wrap(err, "failed to consume postfix operator")
+		}
+		if t := triviaOf(operand); t != nil {
+			end := stream.GetPrevious().end()
+			node.Trivia = &Trivia{start: t.outerStart, end: end, outerStart: t.outerStart, outerEnd: end}
+		}
+		shuntingYard.Operands.Push(node)
 	}
-	// TODO: Should be error here or should we do nothing?
-	// Original implem does nothing...
 	return nil
 }
 
+// terminalErrorCode returns the error code for a terminal that fails to parse.
+func terminalErrorCode(stream TokenStream) ParseErrorCode {
+	switch {
+	case stream.NextIsNumber():
+		return ParseErrorInvalidNumber
+	case stream.NextIsCell(), stream.NextIsRange(), stream.NextIsStructuredRef(), stream.NextIsRef3D(), stream.NextIsExternalRef(), stream.NextIsSpillRef():
+		return ParseErrorInvalidReference
+	default:
+		return ParseErrorSyntax
+	}
+}
+
 func parseFunctionCall(ctx Context, stream TokenStream, shuntingYard ShuntingYard) error {
-	name := stream.GetNext().Value
+	start := stream.GetNext()
+	name := start.Value
 	// consume start of function call
 	if err := stream.Consume(); err != nil {
 		return errors.Wrap(err, "failed to consume start of function call")
 	}
-	args, err := parseFunctionArgList(ctx, stream, shuntingYard)
+	args, err := parseFunctionArgList(ctx, stream, shuntingYard, name)
 	if err != nil {
 		return errors.Wrap(err, "failed to parse function arg list")
 	}
-	shuntingYard.Operands.Push(FunctionNode{
-		Name:      name,
-		Arguments: args,
-	})
+	if ctx.isBound(name) {
+		// A lambda bound by LET or LAMBDA, e.g. f(3)
+		var callee Node = IdentifierNode{Name: name}
+		if ctx.Lossless {
+			// Its ( isn't part of it
+			end := start.end() - 1
+			callee = withTrivia(callee, &Trivia{start: start.Offset, end: end, outerStart: start.Offset, outerEnd: end})
+		}
+		shuntingYard.Operands.Push(CallNode{
+			Callee:    callee,
+			Arguments: args,
+		})
+	} else {
+		shuntingYard.Operands.Push(FunctionNode{
+			Name:      name,
+			Arguments: args,
+		})
+	}
 
 	// consume end of function call
 	if err := stream.Consume(); err != nil {
 		return errors.Wrap(err, "failed to consume end of function call")
 	}
-	return nil
+	spanOperand(ctx, stream, shuntingYard, start.Offset)
+	return parseCalls(ctx, stream, shuntingYard)
 }
 
-func parseFunctionArgList(ctx Context, stream TokenStream, shuntingYard ShuntingYard) ([]Node, error) {
+// parseFunctionArgList parses the arguments of the function called name.
+// Names bound by LET and LAMBDA are only bound in the arguments after them.
+func parseFunctionArgList(ctx Context, stream TokenStream, shuntingYard ShuntingYard, name string) ([]Node, error) {
+	canBind, isBinding := isBindingForm(name)
 	reverseArgs := make([]Node, 0)
 	if err := withinSentinel(shuntingYard, func() error {
 		// I don't like this JavaScript-y way of
 		// having a closure binding on reverseArgs... oh well
 		arity := 0
-		var pos int
-		for {
-			if stream.NextIsEndOfFunctionCall() {
-				break
-			}
-			if pos == stream.Position() {
-				return errors.New("position didn't change after parsing function argument")
-			}
-			pos = stream.Position()
-			if err := parseExpression(ctx, stream, shuntingYard); err != nil {
+		for !(arity == 0 && stream.NextIsEndOfFunctionCall()) {
+			if stream.NextIsFunctionArgumentSeparator() || stream.NextIsEndOfFunctionCall() {
+				// An argument left out, e.g. the second one of IF(A1,,2)
+				shuntingYard.Operands.Push(EmptyNode{})
+				spanEmpty(ctx, stream, shuntingYard)
+			} else if err := parseExpression(ctx, stream, shuntingYard); err != nil {
 				return errors.Wrap(err, "failed to parse expression in func arg list")
 			}
 
 			arity += 1
 
-			if stream.NextIsFunctionArgumentSeparator() {
-				if err := stream.Consume(); err != nil {
-					return errors.Wrap(err, "failed to consume function argument separator")
+			// Only names followed by other arguments are bound, the last one is the body
+			if isBinding && canBind(arity-1) && stream.NextIsFunctionArgumentSeparator() {
+				var err error
+				if ctx, err = bindArg(ctx, shuntingYard); err != nil {
+					return err
 				}
 			}
+
+			if stream.NextIsEndOfFunctionCall() {
+				break
+			}
+			if !stream.NextIsFunctionArgumentSeparator() {
+				return unexpectedToken(stream)
+			}
+			if err := stream.Consume(); err != nil {
+				return errors.Wrap(err, "failed to consume function argument separator")
+			}
 		}
 
 		for i := 0; i < arity; i++ {
@@ -287,10 +387,15 @@ func popOperator(shuntingYard ShuntingYard) error {
 		if !ok {
 			return errors.New("failed to pop binary operator from stack")
 		}
+		var t *Trivia
+		if leftTrivia := triviaOf(left); leftTrivia != nil {
+			t = spanExpression(leftTrivia.outerStart, right)
+		}
 		shuntingYard.Operands.Push(BinaryExpressionNode{
 			Operator: operator.Symbol(),
 			Left:     left,
 			Right:    right,
+			Trivia:   t,
 		})
 	} else if top.IsUnary() {
 		operand, ok := shuntingYard.Operands.Pop()
@@ -301,9 +406,14 @@ func popOperator(shuntingYard ShuntingYard) error {
 		if !ok {
 			return errors.New("failed to pop unary operator from stack")
 		}
+		var t *Trivia
+		if spanned, ok := operator.(spannedOperator); ok {
+			t = spanExpression(spanned.offset, operand)
+		}
 		shuntingYard.Operands.Push(UnaryExpressionNode{
 			Operator: operator.Symbol(),
 			Operand:  operand,
+			Trivia:   t,
 		})
 	}
 	return nil
@@ -319,6 +429,35 @@ func parseTerminal(ctx Context, stream TokenStream) (Node, error) {
 	if stream.NextIsLogical() {
 		return parseLogical(stream)
 	}
+	if stream.NextIsError() {
+		return parseError(stream)
+	}
+	if stream.NextIsSpillRef() {
+		return parseSpillRef(ctx, stream)
+	}
+	// R1C1 references like RC[2] would look like structured references
+	if ctx.R1C1 && (stream.NextIsCell() || stream.NextIsRange() || stream.NextIsStructuredRef()) && isR1C1Ref(stream.GetNext().Value) {
+		return parseR1C1(ctx, stream)
+	}
+	if stream.NextIsStructuredRef() {
+		return parseStructuredRef(stream)
+	}
+	if stream.NextIsExternalRef() {
+		return parseExternalRef(ctx, stream)
+	}
+	if stream.NextIsRef3D() {
+		return parseRef3D(ctx, stream)
+	}
+	if stream.NextIsName() {
+		name, err := parseName(stream)
+		if err == nil && name.Sheet == "" && ctx.isBound(name.Name) {
+			return IdentifierNode{Name: name.Name}, nil
+		}
+		return name, err
+	}
+	if ctx.R1C1 && (stream.NextIsCell() || stream.NextIsRange()) {
+		return nil, errors.New("A1 reference in R1C1 formula")
+	}
 	if stream.NextIsCell() {
 		return parseCell(ctx, stream)
 	}
@@ -349,28 +488,18 @@ func parseRange(ctx Context, stream TokenStream) (CellRangeNode, error) {
 		return CellRangeNode{}, err
 	}
 
-	leftRight := strings.Split(next.Value, ":")
-	if len(leftRight) != 2 {
-		return CellRangeNode{}, errors.New("invalid range")
-	}
-	start, err := xl.ParseCell(leftRight[0], ctx.CurrentSheet)
+	// Also parses whole columns and rows, e.g. A:B or 1:2
+	cellRange, err := xl.ParseRange(next.Value, ctx.CurrentSheet)
 	if err != nil {
-		return CellRangeNode{}, errors.Wrap(err, "failed to parse start cell")
+		return CellRangeNode{}, errors.Wrap(err, "failed to parse range")
 	}
-	end, err := xl.ParseCell(leftRight[1], start.Sheet)
-	if err != nil {
-		return CellRangeNode{}, errors.Wrap(err, "failed to parse end cell")
-	}
-	end, err = end.Shift(1, 1)
-	if err != nil {
-		return CellRangeNode{}, errors.Wrap(err, "failed to shift end cell")
-	}
-	end.Sheet = start.Sheet
+	start, end := cellRange.Start, cellRange.End
 	// TODO: add test that Sheet2!A1:B2 with current sheet=Sheet1 ends with
 	// start: {A1, Sheet2}, end: {B2, Sheet2} and not
 	// start: {A1, Sheet2}, end: {B2, Sheet1}
 	// ---
 	// Also, Sheet1!A1:Sheet2!B2 is not valid!!
+	// Spans of sheets like Sheet1:Sheet2!A1:B2 are parsed by parseRef3D.
 
 	return CellRangeNode{
 		Start: CellNode{Cell: start},
@@ -378,6 +507,83 @@ func parseRange(ctx Context, stream TokenStream) (CellRangeNode, error) {
 	}, nil
 }
 
+// parseArray parses an array constant like {1,2;3,4}.
+func parseArray(stream TokenStream) (ArrayNode, error) {
+	start := stream.Position()
+	// consume {
+	if err := stream.Consume(); err != nil {
+		return ArrayNode{}, err
+	}
+	if stream.NextIsEndOfArray() {
+		return ArrayNode{}, newParseError(ParseErrorSyntax, start, errors.New("empty array"))
+	}
+	rows := make([][]Node, 0)
+	row := make([]Node, 0)
+	for {
+		elem, err := parseArrayElement(stream)
+		if err != nil {
+			return ArrayNode{}, err
+		}
+		row = append(row, elem)
+		if stream.NextIsFunctionArgumentSeparator() {
+			if err := stream.Consume(); err != nil {
+				return ArrayNode{}, err
+			}
+			continue
+		}
+		if !stream.NextIsArrayRowSeparator() && !stream.NextIsEndOfArray() {
+			return ArrayNode{}, unexpectedToken(stream)
+		}
+		if len(rows) > 0 && len(row) != len(rows[0]) {
+			return ArrayNode{}, newParseError(ParseErrorSyntax, start, errors.New("array rows have different lengths"))
+		}
+		rows = append(rows, row)
+		row = make([]Node, 0)
+		// consume the ; before the next row, or }
+		end := stream.NextIsEndOfArray()
+		if err := stream.Consume(); err != nil {
+			return ArrayNode{}, err
+		}
+		if end {
+			return ArrayNode{Rows: rows}, nil
+		}
+	}
+}
+
+// parseArrayElement parses a constant of an array, which can only be
+// a number, possibly negated, a text, a logical or an error.
+func parseArrayElement(stream TokenStream) (Node, error) {
+	negate := false
+	if stream.NextIsPrefixOperator() && stream.GetNext().Value == "-" {
+		negate = true
+		if err := stream.Consume(); err != nil {
+			return nil, err
+		}
+	}
+	pos := stream.Position()
+	switch {
+	case stream.NextIsNumber():
+		num, err := parseNumber(stream)
+		if err != nil {
+			return nil, newParseError(ParseErrorInvalidNumber, pos, err)
+		}
+		if negate {
+			num.Value = -num.Value
+		}
+		return num, nil
+	case negate:
+		return nil, unexpectedToken(stream)
+	case stream.NextIsText():
+		return parseText(stream)
+	case stream.NextIsLogical():
+		return parseLogical(stream)
+	case stream.NextIsError():
+		return parseError(stream)
+	default:
+		return nil, unexpectedToken(stream)
+	}
+}
+
 func parseText(stream TokenStream) (TextNode, error) {
 	next := stream.GetNext()
 	if err := stream.Consume(); err != nil {
@@ -391,7 +597,19 @@ func parseLogical(stream TokenStream) (LogicalNode, error) {
 	if err := stream.Consume(); err != nil {
 		return LogicalNode{}, errors.Wrap(err, "failed to consume logical token")
 	}
-	return LogicalNode{Value: next.Value == "TRUE"}, nil
+	return LogicalNode{Value: strings.EqualFold(next.Value, "TRUE")}, nil
+}
+
+func parseError(stream TokenStream) (ErrorNode, error) {
+	next := stream.GetNext()
+	code, err := xl.ParseErrorCode(next.Value)
+	if err != nil {
+		return ErrorNode{}, errors.Wrap(err, "failed to parse error")
+	}
+	if err := stream.Consume(); err != nil {
+		return ErrorNode{}, errors.Wrap(err, "failed to consume error token")
+	}
+	return ErrorNode{Code: code}, nil
 }
 
 func parseNumber(stream TokenStream) (NumberNode, error) {
@@ -414,6 +632,8 @@ func parseNumber(stream TokenStream) (NumberNode, error) {
 
 func createUnaryOperator(symbol string) (shuntingyard.Operator, error) {
 	precedenceMap := map[string]int{
+		// implicit intersection
+		"@": 9,
 		// negation
 		"-": 7,
 	}
@@ -130,3 +130,107 @@ func TestBuildtree_RangeStartImplicit(t *testing.T) {
 
 	cupaloy.SnapshotT(t, tree)
 }
+
+func TestBuildtree_Array(t *testing.T) {
+	f := `SUM({1,-2.5;"a",TRUE}*A1:B2)`
+	tokens := Tokenize(f)
+	tree, err := BuildTree(Context{CurrentSheet: "Sheet1"}, tokens)
+	if err != nil {
+		t.Errorf("could not build tree for %s: %v", f, err)
+	}
+	nodeJson := ToNodeJson(tree)
+	cupaloy.SnapshotT(t, nodeJson)
+}
+
+func TestBuildtreeArrayBad(t *testing.T) {
+	formulas := []string{
+		`{1,2;3}`,
+		`{A1,2}`,
+		`{-"a"}`,
+		`{}`,
+	}
+	for _, f := range formulas {
+		tokens := Tokenize(f)
+		_, err := BuildTree(Context{CurrentSheet: "Sheet1"}, tokens)
+		if err == nil {
+			t.Errorf("expected error for %s", f)
+		}
+	}
+}
+
+func TestBuildtree_Error(t *testing.T) {
+	f := `IFERROR(A1, #N/A)+{1,#DIV/0!}`
+	tokens := Tokenize(f)
+	tree, err := BuildTree(Context{CurrentSheet: "Sheet1"}, tokens)
+	if err != nil {
+		t.Errorf("could not build tree for %s: %v", f, err)
+	}
+	nodeJson := ToNodeJson(tree)
+	cupaloy.SnapshotT(t, nodeJson)
+}
+
+func TestBuildtree_Name(t *testing.T) {
+	f := `Revenue*TaxRate+SUM('My sheet'!Costs, Sheet2!A1)`
+	tokens := Tokenize(f)
+	tree, err := BuildTree(Context{CurrentSheet: "Sheet1"}, tokens)
+	if err != nil {
+		t.Errorf("could not build tree for %s: %v", f, err)
+	}
+	nodeJson := ToNodeJson(tree)
+	cupaloy.SnapshotT(t, nodeJson)
+}
+
+func TestBuildtree_StructuredRef(t *testing.T) {
+	f := `SUM(Table1[[#Data],[Sales]:[Cost]])/[@Qty]`
+	tokens := Tokenize(f)
+	tree, err := BuildTree(Context{CurrentSheet: "Sheet1"}, tokens)
+	if err != nil {
+		t.Errorf("could not build tree for %s: %v", f, err)
+	}
+	nodeJson := ToNodeJson(tree)
+	cupaloy.SnapshotT(t, nodeJson)
+}
+
+func TestBuildtree_ExternalRef(t *testing.T) {
+	f := `SUM([Book2.xlsx]Sheet1!A1:B2)+'C:\path\[Book 3.xlsx]Data'!Revenue`
+	tokens := Tokenize(f)
+	tree, err := BuildTree(Context{CurrentSheet: "Sheet1"}, tokens)
+	if err != nil {
+		t.Errorf("could not build tree for %s: %v", f, err)
+	}
+	nodeJson := ToNodeJson(tree)
+	cupaloy.SnapshotT(t, nodeJson)
+}
+
+func TestBuildtree_ImplicitIntersection(t *testing.T) {
+	f := `@A1:A10*2-@INDEX(Sales[Qty], 1)+@Sales[Price]`
+	tokens := Tokenize(f)
+	tree, err := BuildTree(Context{CurrentSheet: "Sheet1"}, tokens)
+	if err != nil {
+		t.Errorf("could not build tree for %s: %v", f, err)
+	}
+	nodeJson := ToNodeJson(tree)
+	cupaloy.SnapshotT(t, nodeJson)
+}
+
+func TestBuildtree_EmptyArguments(t *testing.T) {
+	f := `IF(A1,,2)+VLOOKUP(A1,B:C,2,)`
+	tokens := Tokenize(f)
+	tree, err := BuildTree(Context{CurrentSheet: "Sheet1"}, tokens)
+	if err != nil {
+		t.Errorf("could not build tree for %s: %v", f, err)
+	}
+	nodeJson := ToNodeJson(tree)
+	cupaloy.SnapshotT(t, nodeJson)
+}
+
+func TestBuildtree_Percent(t *testing.T) {
+	f := `-A1%*(B1+1)%+SUM(C1:C2)%%`
+	tokens := Tokenize(f)
+	tree, err := BuildTree(Context{CurrentSheet: "Sheet1"}, tokens)
+	if err != nil {
+		t.Errorf("could not build tree for %s: %v", f, err)
+	}
+	nodeJson := ToNodeJson(tree)
+	cupaloy.SnapshotT(t, nodeJson)
+}
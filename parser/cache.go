@@ -0,0 +1,299 @@
+package parser
+
+import (
+	"container/list"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ParseCache parses formulas, keeping one tree per formula shape: copies of
+// a formula across cells, e.g. =A1*2 in B1 and =A2*2 in B2, share their shape,
+// so only the first one is parsed and the others are shifted from it.
+// It keeps at most a given number of shapes, forgetting the least recently used ones.
+// It is safe for concurrent use.
+//
+// Trees are shared between the calls that return them, and must not be modified.
+type ParseCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// Entries from the most recently used to the least
+	lru   *list.List
+	stats CacheStats
+}
+
+// CacheStats tells how well a ParseCache does.
+type CacheStats struct {
+	// Formulas whose shape was already known
+	Hits int
+	// Formulas that had to be parsed
+	Misses int
+	// Shapes currently kept
+	Entries int
+	// Shapes forgotten to make room for new ones
+	Evictions int
+}
+
+type cacheEntry struct {
+	shape string
+	node  Node
+	// Cell the formula of node is located in
+	host Cell
+}
+
+// NewParseCache returns a cache keeping the trees of at most maxEntries formula shapes,
+// or of every shape if maxEntries is 0 or less.
+func NewParseCache(maxEntries int) *ParseCache {
+	return &ParseCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Parse is like Parse for the formula of host, reusing the tree of a formula
+// of the same shape if there is one. Formulas that fail to parse aren't kept.
+func (c *ParseCache) Parse(formula string, host Cell) (Node, error) {
+	shape, refs := formulaShape(formula, host)
+
+	c.mu.Lock()
+	if elem, ok := c.entries[shape]; ok {
+		c.lru.MoveToFront(elem)
+		entry := elem.Value.(*cacheEntry)
+		c.stats.Hits++
+		c.mu.Unlock()
+		node, err := ShiftNode(entry.node, int(host.Row)-int(entry.host.Row), int(host.Col)-int(entry.host.Col))
+		if err == nil {
+			return node, nil
+		}
+		// Can't happen for a formula written in host, but parsing is always right
+		return Parse(formula, host.Sheet)
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	node, err := Parse(formula, host.Sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	// References the shape missed, e.g. the lax aB1 for B1, would be shifted
+	// on hits though their text doesn't change, and text it took for references,
+	// e.g. the name XFE1, would be shifted into them, so such formulas aren't kept.
+	if !matchRefs(treeRefs(node, nil), refs) {
+		return node, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[shape]; !ok {
+		c.entries[shape] = c.lru.PushFront(&cacheEntry{shape: shape, node: node, host: host})
+		if c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+			oldest := c.lru.Remove(c.lru.Back()).(*cacheEntry)
+			delete(c.entries, oldest.shape)
+			c.stats.Evictions++
+		}
+	}
+	return node, nil
+}
+
+// Stats returns the statistics of the cache so far.
+func (c *ParseCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+// Clear forgets every shape, but not the statistics.
+func (c *ParseCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+var (
+	shapeCellRegex   = regexp.MustCompile(`^(\$?)([A-Z]{1,3})(\$?)([0-9]+)$`)
+	shapeColumnRegex = regexp.MustCompile(`^(\$?)([A-Za-z]{1,3})$`)
+	shapeRowRegex    = regexp.MustCompile(`^(\$?)([0-9]+)$`)
+)
+
+// Marks references in shapes, so that they can't be mistaken for the rest of the formula
+const shapeMark = '\x00'
+
+// shapeRef is a cell formulaShape wrote as an offset, with -1 for what it didn't write,
+// e.g. the row of the whole column A in A:B.
+type shapeRef struct {
+	row, col int
+}
+
+// formulaShape returns the formula of host with its cell references written as
+// offsets from host, like in R1C1 notation, without parsing it, and the cells
+// it wrote that way, counting both ends of ranges.
+// Formulas with the same shape in the same sheet are copies of each other,
+// as long as everything that isn't a reference, strings included, is the same.
+func formulaShape(formula string, host Cell) (string, []shapeRef) {
+	var b strings.Builder
+	b.Grow(len(formula) + len(host.Sheet) + 8)
+	b.WriteString(host.Sheet)
+	b.WriteByte(shapeMark)
+
+	var refs []shapeRef
+	// Whether the last run of identifier characters ended with a colon, e.g. A:B
+	afterColon := false
+	for i := 0; i < len(formula); {
+		ch := formula[i]
+		switch {
+		case ch == '"' || ch == '\'':
+			length, _ := quotedLength(formula[i:], ch)
+			b.WriteString(formula[i : i+length])
+			i += length
+			afterColon = false
+			continue
+		case ch == '[':
+			length := bracketLength(formula[i:])
+			b.WriteString(formula[i : i+length])
+			i += length
+			afterColon = false
+			continue
+		case !isShapeRunChar(ch):
+			b.WriteByte(ch)
+			afterColon = ch == ':'
+			i++
+			continue
+		}
+		start := i
+		for i < len(formula) && isShapeRunChar(formula[i]) {
+			i++
+		}
+		run := formula[start:i]
+		var next byte
+		if i < len(formula) {
+			next = formula[i]
+		}
+		// Function names like LOG10( and sheet names like Q1! or Q1:Q4! look like cells
+		if next == '(' || next == '!' || next == ':' && isSheetSpan(formula[i+1:]) {
+			b.WriteString(run)
+			afterColon = false
+			continue
+		}
+		if ref, ok := writeShapeRun(&b, run, host, afterColon || next == ':'); ok {
+			refs = append(refs, ref)
+		}
+		afterColon = false
+	}
+	return b.String(), refs
+}
+
+// treeRefs appends the cells of a tree to refs, in the order they are written,
+// counting both ends of ranges, like formulaShape does.
+func treeRefs(n Node, refs []shapeRef) []shapeRef {
+	switch node := n.(type) {
+	case CellNode:
+		return append(refs, shapeRef{row: int(node.Cell.Row), col: int(node.Cell.Col)})
+	case SpillRefNode:
+		return append(refs, shapeRef{row: int(node.Cell.Row), col: int(node.Cell.Col)})
+	case CellRangeNode:
+		// The end of a range is past its last cell
+		end := node.End.Cell
+		return append(treeRefs(node.Start, refs), shapeRef{row: int(end.Row) - 1, col: int(end.Col) - 1})
+	case Ref3DNode:
+		return treeRefs(node.Ref, refs)
+	case ExternalRefNode:
+		return treeRefs(node.Ref, refs)
+	}
+	for _, child := range n.Children() {
+		refs = treeRefs(child, refs)
+	}
+	return refs
+}
+
+// matchRefs tells whether the cells of a tree are the ones formulaShape wrote as offsets.
+func matchRefs(tree, shape []shapeRef) bool {
+	if len(tree) != len(shape) {
+		return false
+	}
+	for i, ref := range shape {
+		if ref.row >= 0 && ref.row != tree[i].row || ref.col >= 0 && ref.col != tree[i].col {
+			return false
+		}
+	}
+	return true
+}
+
+// isSheetSpan tells whether s starts with the end of a span of sheets, e.g. Q4! in Q1:Q4!A1.
+func isSheetSpan(s string) bool {
+	i := 0
+	for i < len(s) && isShapeRunChar(s[i]) {
+		i++
+	}
+	return i > 0 && i < len(s) && s[i] == '!'
+}
+
+// writeShapeRun writes a run of identifier characters to a shape, as an offset
+// from host if it is a cell, or a whole column or row next to a colon,
+// in which case it returns that cell.
+func writeShapeRun(b *strings.Builder, run string, host Cell, besideColon bool) (shapeRef, bool) {
+	if m := shapeCellRegex.FindStringSubmatch(run); m != nil {
+		if row, err := strconv.Atoi(m[4]); err == nil {
+			ref := shapeRef{row: row - 1, col: lettersToShapeColumn(m[2])}
+			b.WriteByte(shapeMark)
+			writeShapeOffset(b, "R", ref.row, m[3] == "", int(host.Row))
+			writeShapeOffset(b, "C", ref.col, m[1] == "", int(host.Col))
+			b.WriteByte(shapeMark)
+			return ref, true
+		}
+	}
+	if besideColon {
+		if m := shapeColumnRegex.FindStringSubmatch(run); m != nil {
+			ref := shapeRef{row: -1, col: lettersToShapeColumn(strings.ToUpper(m[2]))}
+			b.WriteByte(shapeMark)
+			writeShapeOffset(b, "C", ref.col, m[1] == "", int(host.Col))
+			b.WriteByte(shapeMark)
+			return ref, true
+		}
+		if m := shapeRowRegex.FindStringSubmatch(run); m != nil {
+			if row, err := strconv.Atoi(m[2]); err == nil {
+				ref := shapeRef{row: row - 1, col: -1}
+				b.WriteByte(shapeMark)
+				writeShapeOffset(b, "R", ref.row, m[1] == "", int(host.Row))
+				b.WriteByte(shapeMark)
+				return ref, true
+			}
+		}
+	}
+	b.WriteString(run)
+	return shapeRef{}, false
+}
+
+func writeShapeOffset(b *strings.Builder, prefix string, index int, rel bool, anchor int) {
+	b.WriteString(prefix)
+	if rel {
+		b.WriteByte('[')
+		b.WriteString(strconv.Itoa(index - anchor))
+		b.WriteByte(']')
+	} else {
+		b.WriteString(strconv.Itoa(index))
+	}
+}
+
+// lettersToShapeColumn converts column letters to a column index, e.g. AA to 26.
+// Out of bounds columns don't matter here, parsing will catch them.
+func lettersToShapeColumn(letters string) int {
+	col := 0
+	for i := 0; i < len(letters); i++ {
+		col = col*26 + int(letters[i]-'A') + 1
+	}
+	return col - 1
+}
+
+// isShapeRunChar tells whether ch can be a part of a reference, a name or a number.
+// Bytes of non-ASCII characters are, since sheet names can have them.
+func isShapeRunChar(ch byte) bool {
+	return ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' ||
+		ch == '_' || ch == '.' || ch == '$' || ch == '\\' || ch == '?' || ch >= 0x80
+}
@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestParseCacheMatchesParse(t *testing.T) {
+	// Formulas written in B2, copied to the other hosts by shifting them
+	formulas := []Formula{
+		`=A1*2+$A$1`,
+		`=SUM(A$1:A1)/COUNT(A:A)`,
+		`=SUM(1:1)+LOG10(B1)`,
+		`="A1"&'Q1 data'!A1&Q1:Q4!C3`,
+		`=[Book2.xlsx]Sheet1!A1+Table1[[#Headers],[A1]]`,
+		`=IF(A1>0, A1 B1:C3, Revenue)`,
+	}
+	origin := Cell{Sheet: "Sheet1", Row: 1, Col: 1}
+	hosts := []Cell{origin, {Sheet: "Sheet1", Row: 5, Col: 1}, {Sheet: "Sheet1", Row: 1, Col: 4}, {Sheet: "Sheet1", Row: 9, Col: 9}}
+	cache := NewParseCache(0)
+	for _, f := range formulas {
+		node, err := Parse(string(f), origin.Sheet)
+		if err != nil {
+			t.Fatalf("could not parse %s: %v", f, err)
+		}
+		for _, host := range hosts {
+			moved, err := MoveNode(node, origin, host)
+			if err != nil {
+				t.Fatalf("could not move %s: %v", f, err)
+			}
+			copied := StringifyNode(moved, host.Sheet)
+			want, err := Parse(string(copied), host.Sheet)
+			if err != nil {
+				t.Fatalf("could not parse %s: %v", copied, err)
+			}
+			got, err := cache.Parse(string(copied), host)
+			if err != nil {
+				t.Errorf("cache failed to parse %s: %v", copied, err)
+				continue
+			}
+			if !got.IsEq(want) {
+				t.Errorf("cache parsed %s in %s as %s; want %s", copied, host.ToAddress(), StringifyNode(got, host.Sheet), StringifyNode(want, host.Sheet))
+			}
+		}
+	}
+	// The same text in other cells isn't a copy, even if the relative reference
+	// is written in a way the shape misses, like the lax aB1 for B1
+	for _, host := range hosts {
+		want, _ := Parse(`=aB1+$A$1`, host.Sheet)
+		got, err := cache.Parse(`=aB1+$A$1`, host)
+		if err != nil || !got.IsEq(want) {
+			t.Errorf("cache parsed =aB1+$A$1 in %s as %v, %v", host.ToAddress(), got, err)
+		}
+	}
+	// Nor is a formula where the shape took a name for a reference, like XFE1 past the last column
+	inputs := []struct {
+		formula string
+		host    Cell
+	}{
+		{`=XFE1+aB1`, Cell{Sheet: "Sheet1", Row: 1, Col: 3}},
+		{`=XFE2+aB1`, Cell{Sheet: "Sheet1", Row: 2, Col: 3}},
+	}
+	for _, input := range inputs {
+		want, _ := Parse(input.formula, input.host.Sheet)
+		got, err := cache.Parse(input.formula, input.host)
+		if err != nil || !got.IsEq(want) {
+			t.Errorf("cache parsed %s in %s as %v, %v", input.formula, input.host.ToAddress(), got, err)
+		}
+	}
+}
+
+func TestParseCacheStats(t *testing.T) {
+	cache := NewParseCache(2)
+	inputs := []struct {
+		formula string
+		row     uint32
+	}{
+		{`=A1*2`, 1}, {`=A2*2`, 2}, {`=A3*2`, 3}, // one shape
+		{`=SUM(A1:A2)`, 3}, {`=1+1`, 0}, // two more, evicting the first
+		{`=A5*2`, 5}, // parsed again
+	}
+	for _, in := range inputs {
+		if _, err := cache.Parse(in.formula, Cell{Sheet: "Sheet1", Row: in.row, Col: 1}); err != nil {
+			t.Fatalf("could not parse %s: %v", in.formula, err)
+		}
+	}
+	if _, err := cache.Parse(`=SUM(`, Cell{Sheet: "Sheet1"}); err == nil {
+		t.Errorf("expected an error for a bad formula")
+	}
+	want := CacheStats{Hits: 2, Misses: 5, Entries: 2, Evictions: 2}
+	if got := cache.Stats(); got != want {
+		t.Errorf("got stats %+v; want %+v", got, want)
+	}
+	cache.Clear()
+	if got := cache.Stats().Entries; got != 0 {
+		t.Errorf("got %d entries after Clear; want 0", got)
+	}
+}
+
+func TestParseCacheConcurrent(t *testing.T) {
+	cache := NewParseCache(16)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(col uint16) {
+			defer wg.Done()
+			for row := uint32(1); row < 200; row++ {
+				host := Cell{Sheet: "Sheet1", Row: row, Col: col}
+				node, err := cache.Parse(`=A1+$B$2*C3`, host)
+				if err != nil {
+					t.Errorf("could not parse: %v", err)
+					return
+				}
+				if want, _ := Parse(`=A1+$B$2*C3`, "Sheet1"); !node.IsEq(want) {
+					t.Errorf("cache parsed =A1+$B$2*C3 in %s as %v", host.ToAddress(), node)
+				}
+			}
+		}(uint16(i))
+	}
+	wg.Wait()
+	if stats := cache.Stats(); stats.Hits+stats.Misses != 8*199 {
+		t.Errorf("got stats %+v; want %d lookups", stats, 8*199)
+	}
+}
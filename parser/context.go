@@ -3,4 +3,46 @@ package parser
 type Context struct {
 	// Sheet the formula is located in
 	CurrentSheet string
+	// Defined names, used by ResolveName. Parsing works without them,
+	// since names stay symbolic in the tree.
+	Names NameResolver
+	// Whether references are written in R1C1 notation, e.g. R[-1]C or R1C1:R10C1,
+	// instead of A1 notation
+	R1C1 bool
+	// Cell the formula is located in, which relative references in R1C1
+	// notation are offsets from. Its sheet defaults to CurrentSheet.
+	Anchor Cell
+	// Dialect the formula is written in, EnUS if nil
+	Dialect *Dialect
+	// Whether nodes keep their Trivia, for StringifyNodeLossless to write them back as written.
+	// Only the Parse functions fill trivia, BuildTree doesn't know the text of the formula.
+	Lossless bool
+
+	// Keys of the names bound by the LET and LAMBDA the formula is in, see IdentifierKey
+	bound map[string]bool
+}
+
+// bind returns the context of the formula within a LET or a LAMBDA binding name.
+func (ctx Context) bind(name string) Context {
+	bound := make(map[string]bool, len(ctx.bound)+1)
+	for key := range ctx.bound {
+		bound[key] = true
+	}
+	bound[IdentifierKey(name)] = true
+	ctx.bound = bound
+	return ctx
+}
+
+// isBound tells whether name is bound by a LET or a LAMBDA the formula is in.
+func (ctx Context) isBound(name string) bool {
+	return ctx.bound[IdentifierKey(name)]
+}
+
+// anchor returns the cell relative R1C1 references are offsets from.
+func (ctx Context) anchor() Cell {
+	anchor := ctx.Anchor
+	if anchor.Sheet == "" {
+		anchor.Sheet = ctx.CurrentSheet
+	}
+	return anchor
 }
@@ -0,0 +1,281 @@
+package parser
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+// Dialect is the way formulas are written in a locale of Excel, e.g. =SOMME(A1;B1)*1,5
+// in French for =SUM(A1,B1)*1.5. Trees are the same whatever the dialect of their formula:
+// function names, logicals and errors are kept in en-US.
+//
+// Dialects must not be modified once used.
+type Dialect struct {
+	// Name of the locale, e.g. fr-FR
+	Locale string
+	// Separates the arguments of functions, e.g. the ; of =SOMME(A1;B1), the references
+	// of unions, e.g. the ; of =SOMME((A1;B1)), and the specifiers of structured references,
+	// e.g. the ; of Tableau1[[#En-têtes];[Ventes]]
+	ArgumentSeparator byte
+	// Separate the values of a row of an array constant, and its rows, e.g. . and ; in {1.2;3.4}
+	ArrayColumnSeparator byte
+	ArrayRowSeparator    byte
+	// Separates the integer part of numbers from their fraction, e.g. the , of 1,5
+	DecimalSeparator byte
+	// Localized names of functions, by their en-US name, e.g. SOMME for SUM.
+	// Functions missing from it keep their en-US name.
+	Functions map[string]string
+	// Localized special items of structured references, by their en-US item, e.g. #Tout for #All.
+	// Items missing from it keep their en-US name.
+	TableItems map[TableItem]string
+	// Localized TRUE and FALSE
+	True  string
+	False string
+	// Localized error literals, by their en-US code, e.g. #NV for #N/A.
+	// Errors missing from it keep their en-US code.
+	Errors map[ErrorCode]string
+
+	once sync.Once
+	// En-US names of the functions, by their upper-case localized name
+	englishFunctions map[string]string
+	// En-US special items of structured references, by their upper-case localized name
+	englishTableItems map[string]TableItem
+	// Characters ending an operand, see isDelimiter
+	delimiters [256]bool
+}
+
+// EnUS is the dialect of formulas in files, and of Parse and StringifyNode.
+var EnUS = &Dialect{
+	Locale:               "en-US",
+	ArgumentSeparator:    ',',
+	ArrayColumnSeparator: ',',
+	ArrayRowSeparator:    ';',
+	DecimalSeparator:     '.',
+	True:                 "TRUE",
+	False:                "FALSE",
+}
+
+// FrFR is the dialect of French versions of Excel.
+var FrFR = &Dialect{
+	Locale:               "fr-FR",
+	ArgumentSeparator:    ';',
+	ArrayColumnSeparator: '.',
+	ArrayRowSeparator:    ';',
+	DecimalSeparator:     ',',
+	Functions: map[string]string{
+		"AND": "ET", "AVERAGE": "MOYENNE", "CONCATENATE": "CONCATENER", "COUNT": "NB", "COUNTA": "NBVAL",
+		"COUNTIF": "NB.SI", "COUNTIFS": "NB.SI.ENS", "DAY": "JOUR", "FILTER": "FILTRE", "HLOOKUP": "RECHERCHEH",
+		"IF": "SI", "IFERROR": "SIERREUR", "INT": "ENT", "ISBLANK": "ESTVIDE", "ISERROR": "ESTERREUR",
+		"ISNUMBER": "ESTNUM", "LEFT": "GAUCHE", "LEN": "NBCAR", "LOWER": "MINUSCULE", "MATCH": "EQUIV",
+		"MID": "STXT", "MONTH": "MOIS", "NOT": "NON", "NOW": "MAINTENANT", "OFFSET": "DECALER", "OR": "OU",
+		"POWER": "PUISSANCE", "PRODUCT": "PRODUIT", "RAND": "ALEA", "RIGHT": "DROITE", "ROUND": "ARRONDI",
+		"ROUNDDOWN": "ARRONDI.INF", "ROUNDUP": "ARRONDI.SUP", "SORT": "TRIER", "SQRT": "RACINE", "SUM": "SOMME",
+		"SUMIF": "SOMME.SI", "SUMIFS": "SOMME.SI.ENS", "SUMPRODUCT": "SOMMEPROD", "TEXT": "TEXTE",
+		"TODAY": "AUJOURDHUI", "TRIM": "SUPPRESPACE", "UPPER": "MAJUSCULE", "VLOOKUP": "RECHERCHEV",
+		"XLOOKUP": "RECHERCHEX", "YEAR": "ANNEE",
+	},
+	TableItems: map[TableItem]string{
+		xl.TableAll: "#Tout", xl.TableData: "#Données", xl.TableHeaders: "#En-têtes",
+		xl.TableTotals: "#Totaux", xl.TableThisRow: "#Cette ligne",
+	},
+	True:  "VRAI",
+	False: "FAUX",
+	Errors: map[ErrorCode]string{
+		xl.ErrorNull:  "#NUL!",
+		xl.ErrorValue: "#VALEUR!",
+		xl.ErrorName:  "#NOM?",
+		xl.ErrorNum:   "#NOMBRE!",
+	},
+}
+
+// DeDE is the dialect of German versions of Excel.
+var DeDE = &Dialect{
+	Locale:               "de-DE",
+	ArgumentSeparator:    ';',
+	ArrayColumnSeparator: '.',
+	ArrayRowSeparator:    ';',
+	DecimalSeparator:     ',',
+	Functions: map[string]string{
+		"AND": "UND", "AVERAGE": "MITTELWERT", "CONCATENATE": "VERKETTEN", "COUNT": "ANZAHL", "COUNTA": "ANZAHL2",
+		"COUNTIF": "ZÄHLENWENN", "COUNTIFS": "ZÄHLENWENNS", "DATE": "DATUM", "DAY": "TAG", "HLOOKUP": "WVERWEIS",
+		"IF": "WENN", "IFERROR": "WENNFEHLER", "INDIRECT": "INDIREKT", "INT": "GANZZAHL", "ISBLANK": "ISTLEER",
+		"ISERROR": "ISTFEHLER", "ISNUMBER": "ISTZAHL", "LEFT": "LINKS", "LEN": "LÄNGE", "LOWER": "KLEIN",
+		"MATCH": "VERGLEICH", "MID": "TEIL", "MOD": "REST", "MONTH": "MONAT", "NA": "NV", "NOT": "NICHT",
+		"NOW": "JETZT", "OFFSET": "BEREICH.VERSCHIEBEN", "OR": "ODER", "POWER": "POTENZ", "PRODUCT": "PRODUKT",
+		"RAND": "ZUFALLSZAHL", "RIGHT": "RECHTS", "ROUND": "RUNDEN", "ROUNDDOWN": "ABRUNDEN",
+		"ROUNDUP": "AUFRUNDEN", "SORT": "SORTIEREN", "SQRT": "WURZEL", "SUM": "SUMME", "SUMIF": "SUMMEWENN",
+		"SUMIFS": "SUMMEWENNS", "SUMPRODUCT": "SUMMENPRODUKT", "TODAY": "HEUTE", "TRIM": "GLÄTTEN",
+		"UNIQUE": "EINDEUTIG", "UPPER": "GROSS", "VLOOKUP": "SVERWEIS", "XLOOKUP": "XVERWEIS", "YEAR": "JAHR",
+	},
+	TableItems: map[TableItem]string{
+		xl.TableAll: "#Alle", xl.TableData: "#Daten", xl.TableHeaders: "#Kopfzeilen",
+		xl.TableTotals: "#Ergebnisse", xl.TableThisRow: "#Diese Zeile",
+	},
+	True:  "WAHR",
+	False: "FALSCH",
+	Errors: map[ErrorCode]string{
+		xl.ErrorValue: "#WERT!",
+		xl.ErrorRef:   "#BEZUG!",
+		xl.ErrorNum:   "#ZAHL!",
+		xl.ErrorNA:    "#NV",
+		xl.ErrorSpill: "#ÜBERLAUF!",
+	},
+}
+
+func (d *Dialect) init() {
+	d.once.Do(func() {
+		d.englishFunctions = make(map[string]string, len(d.Functions))
+		for english, localized := range d.Functions {
+			d.englishFunctions[strings.ToUpper(localized)] = english
+		}
+		d.englishTableItems = make(map[string]TableItem, len(d.TableItems))
+		for english, localized := range d.TableItems {
+			d.englishTableItems[strings.ToUpper(localized)] = english
+		}
+		for _, ch := range []byte(" \t\r\n+-*/^&=<>\"(){}%#") {
+			d.delimiters[ch] = true
+		}
+		d.delimiters[d.ArgumentSeparator] = true
+		d.delimiters[d.ArrayRowSeparator] = true
+	})
+}
+
+// functionName returns the localized name of a function. Its _xlfn. prefix, if any, is only
+// kept when it isn't localized: Excel only writes it in files, e.g. RECHERCHEX for _xlfn.XLOOKUP.
+func (d *Dialect) functionName(name string) string {
+	prefix := ""
+	if len(name) > len(xlfnPrefix) && strings.EqualFold(name[:len(xlfnPrefix)], xlfnPrefix) {
+		prefix, name = name[:len(xlfnPrefix)], name[len(xlfnPrefix):]
+	}
+	if localized, ok := d.Functions[strings.ToUpper(name)]; ok {
+		return localized
+	}
+	return prefix + name
+}
+
+// englishFunctionName returns the en-US name of a function written in the dialect,
+// or name itself if it isn't localized.
+func (d *Dialect) englishFunctionName(name string) string {
+	d.init()
+	prefix := ""
+	if len(name) > len(xlfnPrefix) && strings.EqualFold(name[:len(xlfnPrefix)], xlfnPrefix) {
+		prefix, name = name[:len(xlfnPrefix)], name[len(xlfnPrefix):]
+	}
+	if english, ok := d.englishFunctions[strings.ToUpper(name)]; ok {
+		return prefix + english
+	}
+	return prefix + name
+}
+
+// Prefix of the functions newer than Excel 2007 in files, e.g. _xlfn.XLOOKUP
+const xlfnPrefix = "_xlfn."
+
+// tableItem returns the localized special item of a structured reference.
+func (d *Dialect) tableItem(item TableItem) string {
+	if localized, ok := d.TableItems[item]; ok {
+		return localized
+	}
+	return string(item)
+}
+
+// englishStructuredRef returns a structured reference written in the dialect
+// the way it is written in en-US, e.g. Table1[[#Headers],[Sales]] for Table1[[#En-têtes];[Sales]].
+func (d *Dialect) englishStructuredRef(s string) string {
+	d.init()
+	if d.ArgumentSeparator == ',' && len(d.englishTableItems) == 0 {
+		return s
+	}
+	var b strings.Builder
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '\'' && depth > 0 && i+1 < len(s):
+			// Escapes the next character of a column name
+			b.WriteString(s[i : i+2])
+			i++
+			continue
+		case ch == '[':
+			depth++
+			if end := strings.IndexByte(s[i+1:], ']'); end >= 0 && strings.HasPrefix(s[i+1:], "#") {
+				item := s[i+1 : i+1+end]
+				if english, ok := d.englishTableItems[strings.ToUpper(item)]; ok {
+					item = string(english)
+				}
+				b.WriteByte('[')
+				b.WriteString(item)
+				i += end
+				continue
+			}
+		case ch == ']':
+			depth--
+		case ch == d.ArgumentSeparator && depth == 1:
+			ch = ','
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+// logical returns the localized TRUE or FALSE.
+func (d *Dialect) logical(value bool) string {
+	if value {
+		return d.True
+	}
+	return d.False
+}
+
+// errorLiteral returns the localized error literal of code.
+func (d *Dialect) errorLiteral(code ErrorCode) string {
+	if localized, ok := d.Errors[code]; ok {
+		return localized
+	}
+	return string(code)
+}
+
+// argumentSeparator returns what separates the arguments of functions when writing them.
+func (d *Dialect) argumentSeparator() string {
+	return string(d.ArgumentSeparator) + " "
+}
+
+// operator returns how a binary operator is written: the union is the argument separator.
+func (d *Dialect) operator(op string) string {
+	if op == "," {
+		return string(d.ArgumentSeparator)
+	}
+	return op
+}
+
+// number writes a number with the decimal separator of the dialect.
+func (d *Dialect) number(n NumberNode) string {
+	s := n.String()
+	if d.DecimalSeparator != '.' {
+		s = strings.Replace(s, ".", string(d.DecimalSeparator), 1)
+	}
+	return s
+}
+
+// dialect returns the dialect formulas are written in, en-US by default.
+func (ctx Context) dialect() *Dialect {
+	if ctx.Dialect == nil {
+		return EnUS
+	}
+	return ctx.Dialect
+}
+
+// Sheet formulas are translated in, which can't be the name of an actual sheet
+const translationSheet = "[translation]"
+
+// Translate rewrites a formula written in the dialect from into the dialect to,
+// e.g. =SOMME(A1;B1)*1,5 in FrFR into =SUM(A1, B1)*1.5 in EnUS, through its tree.
+// A nil dialect is EnUS.
+func Translate(formula string, from *Dialect, to *Dialect) (Formula, error) {
+	node, err := ParseWithContext(formula, Context{CurrentSheet: translationSheet, Dialect: from})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse formula")
+	}
+	return StringifyNodeDialect(node, translationSheet, to), nil
+}
@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseDialect(t *testing.T) {
+	testCases := []struct {
+		formula  string
+		dialect  *Dialect
+		expected string
+	}{
+		{`=SOMME(A1;B1)*1,5`, FrFR, `=SUM(A1,B1)*1.5`},
+		{`=WENN(A1>0;1;0)`, DeDE, `=IF(A1>0,1,0)`},
+		{`=wenn(istfehler(A1);falsch;#nv)`, DeDE, `=IF(ISERROR(A1),FALSE,#N/A)`},
+		{`=SI(A1=VRAI;{1,5.2;3.4};#VALEUR!)&1,5E-3`, FrFR, `=IF(A1=TRUE,{1.5,2;3,4},#VALUE!)&1.5E-3`},
+		{`=_xlfn.XVERWEIS(A1;B:B;C:C)+Tabelle2!A1`, DeDE, `=_xlfn.XLOOKUP(A1,B:B,C:C)+Tabelle2!A1`},
+		{`=SOMME((A1;B1))+MaFonction(1;2)`, FrFR, `=SUM((A1,B1))+MaFonction(1,2)`},
+	}
+	for _, tc := range testCases {
+		node, err := ParseWithContext(tc.formula, Context{CurrentSheet: "Sheet1", Dialect: tc.dialect})
+		if err != nil {
+			t.Errorf("could not parse %s: %v", tc.formula, err)
+			continue
+		}
+		expected, err := Parse(tc.expected, "Sheet1")
+		if err != nil {
+			t.Errorf("could not parse %s: %v", tc.expected, err)
+			continue
+		}
+		if !node.IsEq(expected) {
+			t.Errorf("ParseWithContext(%s) = %v; want %v", tc.formula, node, expected)
+		}
+	}
+}
+
+func TestParseDialectErrorOffset(t *testing.T) {
+	_, err := ParseWithContext(`=SOMME(1,5;A1:XFE1)`, Context{CurrentSheet: "Sheet1", Dialect: FrFR})
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Code != ParseErrorInvalidReference || parseErr.Offset != 11 || parseErr.Token != "A1:XFE1" {
+		t.Errorf("got error %v; want an invalid reference at offset 11", err)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	testCases := []struct {
+		formula  string
+		from     *Dialect
+		to       *Dialect
+		expected Formula
+	}{
+		{`=SOMME(A1;B1)*1,5`, FrFR, nil, `=SUM(A1, B1)*1.5`},
+		{`=IF(A1>=0.5,{1.5,2;3,4},#N/A)`, nil, FrFR, `=SI(A1>=0,5; {1,5.2;3.4}; #N/A)`},
+		{`=IFERROR(VLOOKUP(A1,Sheet2!$A:$B,2,FALSE),#VALUE!)`, EnUS, DeDE, `=WENNFEHLER(SVERWEIS(A1; Sheet2!$A:$B; 2; FALSCH); #WERT!)`},
+		{`=WENN(A1>0;1;0)`, DeDE, FrFR, `=SI(A1>0; 1; 0)`},
+		{`=A1:B2 B1:C2+LAMBDA(x,x*2)(3)`, nil, DeDE, `=A1:B2 B1:C2+LAMBDA(x; x*2)(3)`},
+		{`=SUM(Table1[[#Headers],[Sales]:[Cost]])+Table1[#All]`, nil, FrFR, `=SOMME(Table1[[#En-têtes];[Sales]:[Cost]])+Table1[#Tout]`},
+		{`=SOMME(Tableau1[[#En-têtes];[Ventes]])+Tableau1[#tout]`, FrFR, DeDE, `=SUMME(Tableau1[[#Kopfzeilen];[Ventes]])+Tableau1[#Alle]`},
+		{`=Tabelle1[[#Diese Zeile];[a;b]:[c'#]]`, DeDE, nil, `=Tabelle1[@[a;b]:[c'#]]`},
+		{`=_xlfn.XLOOKUP(A1,B:B,C:C)+_xlfn.CONCAT(A1)`, nil, FrFR, `=RECHERCHEX(A1; B:B; C:C)+_xlfn.CONCAT(A1)`},
+		{`=SUM((A1,B1))`, nil, FrFR, `=SOMME((A1;B1))`},
+		{`=SOMME((A1;B1);C1)`, FrFR, nil, `=SUM((A1,B1), C1)`},
+	}
+	for _, tc := range testCases {
+		got, err := Translate(tc.formula, tc.from, tc.to)
+		if err != nil {
+			t.Errorf("could not translate %s: %v", tc.formula, err)
+			continue
+		}
+		if got != tc.expected {
+			t.Errorf("Translate(%s) = %s; want %s", tc.formula, got, tc.expected)
+		}
+	}
+}
+
+func TestTranslateRoundTrip(t *testing.T) {
+	formulas := []Formula{
+		`="say ""hi"""&'O''Brien'!A1`,
+		`=IF('My sheet; 2'!$A$1>0.5, "a;b,c", {1.5,2;3,4})`,
+		`=SUM(Table1[[#Totals],[Unit Price]], Table1[@Qty])`,
+	}
+	for _, formula := range formulas {
+		for _, dialect := range []*Dialect{FrFR, DeDE} {
+			translated, err := Translate(string(formula), EnUS, dialect)
+			if err != nil {
+				t.Errorf("could not translate %s: %v", formula, err)
+				continue
+			}
+			back, err := Translate(string(translated), dialect, EnUS)
+			if err != nil {
+				t.Errorf("could not translate %s back: %v", translated, err)
+				continue
+			}
+			if back != formula {
+				t.Errorf("%s translated to %s is %s back; want %s", formula, dialect.Locale, back, formula)
+			}
+		}
+	}
+}
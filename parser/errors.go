@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// ParseErrorCode tells apart the reasons why a formula couldn't be parsed.
+type ParseErrorCode uint8
+
+const (
+	// The formula is malformed in a way not covered by the other codes
+	ParseErrorSyntax ParseErrorCode = iota
+	// A token appears where it can't, e.g. the ) in =1)
+	ParseErrorUnexpectedToken
+	// The formula ends too early, e.g. =SUM(1,
+	ParseErrorUnexpectedEnd
+	// The formula has no tokens, e.g. =
+	ParseErrorEmptyFormula
+	// A cell or range reference is invalid, e.g. =A1:XFE1
+	ParseErrorInvalidReference
+	// A number can't be parsed
+	ParseErrorInvalidNumber
+	// An operator isn't supported
+	ParseErrorInvalidOperator
+	// A text or a quoted sheet name isn't closed, e.g. ="abc
+	ParseErrorUnterminatedLiteral
+)
+
+func (c ParseErrorCode) String() string {
+	switch c {
+	case ParseErrorSyntax:
+		return "syntax error"
+	case ParseErrorUnexpectedToken:
+		return "unexpected token"
+	case ParseErrorUnexpectedEnd:
+		return "unexpected end of formula"
+	case ParseErrorEmptyFormula:
+		return "empty formula"
+	case ParseErrorInvalidReference:
+		return "invalid reference"
+	case ParseErrorInvalidNumber:
+		return "invalid number"
+	case ParseErrorInvalidOperator:
+		return "invalid operator"
+	case ParseErrorUnterminatedLiteral:
+		return "unterminated literal"
+	default:
+		return "unknown error"
+	}
+}
+
+// ParseError is the error returned by Parse and BuildTree,
+// pointing at the token of the formula where parsing failed.
+type ParseError struct {
+	Code ParseErrorCode
+	// Index of the offending token in the tokens of the formula,
+	// or the number of tokens if the formula ended too early
+	TokenIndex int
+	// Byte offset and length of the offending token in the formula.
+	// At the end of the formula, the length is 0.
+	Offset int
+	Length int
+	// Text of the offending token in the formula
+	Token string
+	// Underlying error, if any
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	msg := e.Code.String()
+	if e.Token != "" {
+		msg += fmt.Sprintf(" %q", e.Token)
+	}
+	msg += fmt.Sprintf(" at offset %d", e.Offset)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+func newParseError(code ParseErrorCode, tokenIndex int, err error) *ParseError {
+	return &ParseError{Code: code, TokenIndex: tokenIndex, Err: err}
+}
+
+// unexpectedToken returns the error for a token that can't appear where the stream is.
+func unexpectedToken(stream TokenStream) *ParseError {
+	if stream.NextIsEnd() {
+		return newParseError(ParseErrorUnexpectedEnd, stream.Position(), nil)
+	}
+	return newParseError(ParseErrorUnexpectedToken, stream.Position(), nil)
+}
+
+// toParseError finds the ParseError in err, or makes a syntax error at the given
+// token if there's none, and sets its position from the tokens.
+func toParseError(err error, tokenIndex int, tokens []Token) *ParseError {
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		parseErr = newParseError(ParseErrorSyntax, tokenIndex, err)
+	}
+	if parseErr.TokenIndex < len(tokens) {
+		token := tokens[parseErr.TokenIndex]
+		parseErr.Offset, parseErr.Length = token.Offset, token.Length
+		parseErr.Token = token.Value
+	} else if len(tokens) > 0 {
+		last := tokens[len(tokens)-1]
+		parseErr.Offset, parseErr.Length = last.Offset+last.Length, 0
+		parseErr.Token = ""
+	}
+	return parseErr
+}
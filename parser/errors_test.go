@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	testCases := []struct {
+		formula string
+		code    ParseErrorCode
+		offset  int
+		token   string
+	}{
+		{`=`, ParseErrorEmptyFormula, 0, ""},
+		{`=1)`, ParseErrorUnexpectedToken, 2, ")"},
+		{`=SUM(1,`, ParseErrorUnexpectedEnd, 7, ""},
+		{`=(A1+5`, ParseErrorUnexpectedEnd, 6, ""},
+		{`=SUM( A1 , A1:XFE1 )`, ParseErrorInvalidReference, 11, "A1:XFE1"},
+		{`="a""b"+'My sheet'!A1:`, ParseErrorInvalidReference, 8, "'My sheet'!A1:"},
+		{`=1+IF(A1,()`, ParseErrorUnexpectedToken, 10, ")"},
+		{`="abc`, ParseErrorUnterminatedLiteral, 1, `"abc`},
+		{`=A1&"say ""hi""`, ParseErrorUnterminatedLiteral, 4, `"say ""hi""`},
+		{`='Sheet`, ParseErrorUnterminatedLiteral, 1, `'Sheet`},
+		{`=SUM(Jan:'Dec!A1)`, ParseErrorUnterminatedLiteral, 5, `Jan:'Dec!A1)`},
+		{`=#FOO'`, ParseErrorUnexpectedToken, 1, `#FOO'`},
+	}
+	for _, tc := range testCases {
+		_, err := Parse(tc.formula, "Sheet1")
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("Parse(%s) returned %v; want a ParseError", tc.formula, err)
+			continue
+		}
+		if parseErr.Code != tc.code || parseErr.Offset != tc.offset || parseErr.Token != tc.token {
+			t.Errorf("Parse(%s) failed with %s at offset %d on %q; want %s at offset %d on %q",
+				tc.formula, parseErr.Code, parseErr.Offset, parseErr.Token, tc.code, tc.offset, tc.token)
+		}
+	}
+}
+
+func TestTokenizeOffsets(t *testing.T) {
+	formula := `=SUM({1,2;3,4}, "x")+@INDEX(A1:A2 A2, 1)%`
+	expected := []string{"SUM(", "{", "1", ",", "2", ";", "3", ",", "4", "}", ",", " ", `"x"`, ")", "+", "@", "INDEX(", "A1:A2", " ", "A2", ",", " ", "1", ")", "%"}
+	tokens := Tokenize(formula)
+	if len(tokens) != len(expected) {
+		t.Fatalf("got %d tokens; want %d", len(tokens), len(expected))
+	}
+	for i, token := range tokens {
+		if got := formula[token.Offset : token.Offset+token.Length]; got != expected[i] {
+			t.Errorf("token %d (%s %s) is %q in the formula; want %q", i, token.Type, token.Value, got, expected[i])
+		}
+	}
+}
+
+func TestTokenizeStructuredRefs(t *testing.T) {
+	formula := `=COUNTA(Table1[[#Headers], [Unit Price]])+[@Qty]&"[a, b]"`
+	expected := []string{"COUNTA(", "Table1[[#Headers], [Unit Price]]", ")", "+", "[@Qty]", "&", `"[a, b]"`}
+	tokens := Tokenize(formula)
+	if len(tokens) != len(expected) {
+		t.Fatalf("got %d tokens; want %d", len(tokens), len(expected))
+	}
+	for i, token := range tokens {
+		if got := formula[token.Offset : token.Offset+token.Length]; got != expected[i] {
+			t.Errorf("token %d (%s %s) is %q in the formula; want %q", i, token.Type, token.Value, got, expected[i])
+		}
+	}
+	if tokens[1].Value != expected[1] {
+		t.Errorf("got token %q; want %q", tokens[1].Value, expected[1])
+	}
+}
@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+// WorkbookResolver loads the workbooks of external references,
+// see xlsx.DirResolver for an implementation.
+type WorkbookResolver interface {
+	// ResolveWorkbook returns the workbook written as [book] in a reference,
+	// path being the directory before it, or "" if none.
+	ResolveWorkbook(path string, book string) (*xl.Workbook, error)
+}
+
+// ExternalRefNode is a reference to another workbook,
+// e.g. [Book2.xlsx]Sheet1!A1 or 'C:\path\[Book.xlsx]Sheet 1'!A1:B2.
+type ExternalRefNode struct {
+	// Directory of the workbook as written, e.g. C:\path\, or "" if none
+	Path string `json:"path,omitempty"`
+	// File name of the workbook, or its index in the external links
+	// of an .xlsx file, e.g. [1]Sheet1!A1
+	Book string `json:"book"`
+	// What is referenced in the workbook: a CellNode, a CellRangeNode or a
+	// NameNode, whose sheet is a sheet of the other workbook
+	Ref     Node `json:"ref"`
+	*Trivia `json:"-"`
+}
+
+func (e ExternalRefNode) Type() NodeType {
+	return NodeTypeExternalRef
+}
+
+func (e ExternalRefNode) IsEq(node Node) bool {
+	if node.Type() != NodeTypeExternalRef {
+		return false
+	}
+	other := node.(ExternalRefNode)
+	return e.Path == other.Path && strings.EqualFold(e.Book, other.Book) && e.Ref.IsEq(other.Ref)
+}
+
+// Children returns nothing, since the reference is to another workbook.
+func (e ExternalRefNode) Children() []Node {
+	return []Node{}
+}
+
+// Sheet returns the sheet of the other workbook the reference is in.
+func (e ExternalRefNode) Sheet() string {
+	switch ref := e.Ref.(type) {
+	case CellNode:
+		return ref.Cell.Sheet
+	case CellRangeNode:
+		return ref.Start.Cell.Sheet
+	case NameNode:
+		return ref.Sheet
+	default:
+		return ""
+	}
+}
+
+var goodBookName = regexp.MustCompile(`^[a-zA-Z0-9_.]+$`)
+
+// String returns the reference as written in a formula, with quotes if needed.
+func (e ExternalRefNode) String() string {
+	return e.stringify(refStyle{dialect: EnUS})
+}
+
+func (e ExternalRefNode) stringify(style refStyle) string {
+	sheet := e.Sheet()
+	prefix := e.Path + "[" + e.Book + "]" + sheet
+	if e.Path != "" || !goodBookName.MatchString(e.Book) || (sheet != "" && xl.QuoteSheetName(sheet) != sheet) {
+		prefix = "'" + strings.ReplaceAll(prefix, "'", "''") + "'"
+	}
+	var ref string
+	if name, ok := e.Ref.(NameNode); ok {
+		ref = name.Name
+	} else {
+		// Leaves the sheet out, since it's in the prefix
+		ref = stringifyNode(e.Ref, -1, style.inSheet(sheet))
+	}
+	return prefix + "!" + ref
+}
+
+// splitExternalRef splits an external reference like C:\path\[Book.xlsx]Sheet1!A1
+// into its path, book, sheet and reference, and false if it isn't one.
+func splitExternalRef(s string) (path string, book string, sheet string, ref string, ok bool) {
+	i := strings.LastIndexByte(s, '!')
+	if i < 0 {
+		return "", "", "", "", false
+	}
+	// Tokenize already dropped the quotes around the prefix
+	prefix := s[:i]
+	open := strings.IndexByte(prefix, '[')
+	end := strings.IndexByte(prefix, ']')
+	if open < 0 || end < open+2 {
+		return "", "", "", "", false
+	}
+	return prefix[:open], prefix[open+1 : end], prefix[end+1:], s[i+1:], true
+}
+
+func parseExternalRef(ctx Context, stream TokenStream) (ExternalRefNode, error) {
+	next := stream.GetNext()
+	path, book, sheet, ref, ok := splitExternalRef(next.Value)
+	if !ok {
+		return ExternalRefNode{}, errors.New("invalid external reference")
+	}
+	node := ExternalRefNode{Path: path, Book: book}
+	switch {
+	case IsValidName(ref):
+		// Names of the whole workbook have no sheet, e.g. [1]!Revenue
+		node.Ref = NameNode{Name: ref, Sheet: sheet}
+	case sheet == "":
+		return ExternalRefNode{}, errors.New("missing sheet in external reference")
+	default:
+		cellOrRange, err := parseRef(ctx, ref, sheet)
+		if err != nil {
+			return ExternalRefNode{}, errors.Wrap(err, "failed to parse external reference")
+		}
+		node.Ref = cellOrRange
+	}
+	if err := stream.Consume(); err != nil {
+		return ExternalRefNode{}, errors.Wrap(err, "failed to consume external reference token")
+	}
+	return node, nil
+}
@@ -0,0 +1,62 @@
+package parser
+
+import "testing"
+
+func TestExternalRef(t *testing.T) {
+	cases := map[Formula]ExternalRefNode{
+		"=[Book2.xlsx]Sheet1!A1": {
+			Book: "Book2.xlsx",
+			Ref:  CellNode{Cell: Cell{Sheet: "Sheet1", RowRel: true, ColRel: true}},
+		},
+		`='C:\path\[Book.xlsx]Sheet 1'!$A$1:B2`: {
+			Path: `C:\path\`,
+			Book: "Book.xlsx",
+			Ref: CellRangeNode{
+				Start: CellNode{Cell: Cell{Sheet: "Sheet 1"}},
+				End:   CellNode{Cell: Cell{Sheet: "Sheet 1", Row: 2, Col: 2, RowRel: true, ColRel: true}},
+			},
+		},
+		"='[My Book.xlsx]Data'!B2": {
+			Book: "My Book.xlsx",
+			Ref:  CellNode{Cell: Cell{Sheet: "Data", Row: 1, Col: 1, RowRel: true, ColRel: true}},
+		},
+		"=[1]Sheet1!Revenue": {
+			Book: "1",
+			Ref:  NameNode{Name: "Revenue", Sheet: "Sheet1"},
+		},
+		"=[1]!Revenue": {
+			Book: "1",
+			Ref:  NameNode{Name: "Revenue"},
+		},
+	}
+	for f, want := range cases {
+		node, err := Parse(string(f), "Summary")
+		if err != nil {
+			t.Errorf("could not parse %s: %v", f, err)
+			continue
+		}
+		if !node.IsEq(want) {
+			t.Errorf("%s: got %+v; want %+v", f, node, want)
+		}
+		if got := StringifyNode(node, "Summary"); got != f {
+			t.Errorf("StringifyNode(%s) = %s", f, got)
+		}
+	}
+}
+
+func TestExternalRefShift(t *testing.T) {
+	got, err := ShiftFormula("=SUM([Book2.xlsx]Sheet1!A1:$B$2)+A1", 1, 2, "Summary")
+	if err != nil {
+		t.Fatalf("ShiftFormula failed with %s", err)
+	}
+	if want := Formula("=SUM([Book2.xlsx]Sheet1!C2:$B$2)+C2"); got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func TestExternalRefNoSheet(t *testing.T) {
+	_, err := Parse("=[Book2.xlsx]!A1", "Sheet1")
+	if err == nil {
+		t.Errorf("expected an error for an external cell without a sheet")
+	}
+}
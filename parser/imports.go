@@ -9,6 +9,9 @@ type RawSheet = xl.RawSheet
 type Workbook = xl.Workbook
 type CVal = xl.CVal
 type Formula = xl.Formula
+type ErrorCode = xl.ErrorCode
+type TableRef = xl.TableRef
+type TableItem = xl.TableItem
 
 type CType = xl.CType
 
@@ -17,3 +20,4 @@ const CTString = xl.CTString
 const CTFormula = xl.CTFormula
 const CTNumber = xl.CTNumber
 const CTBool = xl.CTBool
+const CTError = xl.CTError
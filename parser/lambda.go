@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// IdentifierNode is a name bound by LET or LAMBDA, e.g. x in =LET(x, A1*2, x+x),
+// both where it is bound and where it is used. Unlike a NameNode, it isn't
+// a defined name of the workbook, and only has a meaning within its binding form.
+type IdentifierNode struct {
+	// Name as written, possibly with the _xlpm. prefix of files
+	Name    string `json:"name"`
+	*Trivia `json:"-"`
+}
+
+func (i IdentifierNode) Type() NodeType {
+	return NodeTypeIdentifier
+}
+
+func (i IdentifierNode) IsEq(node Node) bool {
+	if node.Type() != NodeTypeIdentifier {
+		return false
+	}
+	return IdentifierKey(i.Name) == IdentifierKey(node.(IdentifierNode).Name)
+}
+
+func (i IdentifierNode) Children() []Node {
+	return []Node{}
+}
+
+func (i IdentifierNode) String() string {
+	return i.Name
+}
+
+// IdentifierKey returns the key identifiers are looked up by: their upper-case name,
+// without the _xlpm. prefix files write parameters with, e.g. X for _xlpm.x.
+func IdentifierKey(name string) string {
+	name = strings.ToUpper(name)
+	return strings.TrimPrefix(name, "_XLPM.")
+}
+
+// CallNode is a call of a lambda that isn't a function of the library,
+// e.g. =LAMBDA(a, b, a+b)(1, 2), or f(3) in =LET(f, LAMBDA(x, x*2), f(3)).
+type CallNode struct {
+	// What computes to the lambda: a FunctionNode, an IdentifierNode or another CallNode
+	Callee    Node   `json:"callee"`
+	Arguments []Node `json:"arguments"`
+	*Trivia   `json:"-"`
+}
+
+func (c CallNode) Type() NodeType {
+	return NodeTypeCall
+}
+
+func (c CallNode) IsEq(node Node) bool {
+	if node.Type() != NodeTypeCall {
+		return false
+	}
+	other := node.(CallNode)
+	if !c.Callee.IsEq(other.Callee) || len(c.Arguments) != len(other.Arguments) {
+		return false
+	}
+	for i, arg := range c.Arguments {
+		if !arg.IsEq(other.Arguments[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c CallNode) Children() []Node {
+	return append([]Node{c.Callee}, c.Arguments...)
+}
+
+// isBindingForm tells whether the function binds names, and if so which of
+// its arguments can be names: all of LAMBDA's but its body, every other one of LET's.
+func isBindingForm(name string) (func(index int) bool, bool) {
+	switch strings.TrimPrefix(strings.ToUpper(name), "_XLFN.") {
+	case "LET":
+		return func(index int) bool { return index%2 == 0 }, true
+	case "LAMBDA":
+		return func(index int) bool { return true }, true
+	default:
+		return nil, false
+	}
+}
+
+// bindArg turns the name just parsed as an argument of a binding form, on top of the operands,
+// into an identifier, and returns the context of the next arguments, where it is bound.
+func bindArg(ctx Context, shuntingYard ShuntingYard) (Context, error) {
+	arg, ok := shuntingYard.Operands.Pop()
+	if !ok {
+		return ctx, errors.New("failed to pop operand from stack for binding")
+	}
+	var name string
+	switch node := arg.(type) {
+	case NameNode:
+		if node.Sheet != "" {
+			return ctx, errors.Errorf("invalid parameter name %s", node)
+		}
+		name = node.Name
+	case IdentifierNode:
+		// Shadows a name bound by an outer form
+		name = node.Name
+	default:
+		return ctx, errors.New("invalid parameter name")
+	}
+	shuntingYard.Operands.Push(IdentifierNode{Name: name, Trivia: triviaOf(arg)})
+	return ctx.bind(name), nil
+}
+
+// parseCalls parses the calls of the lambda on top of the operands, if any, e.g. (1, 2) in
+// =LAMBDA(a, b, a+b)(1, 2), which Tokenize turns into function tokens without a name.
+func parseCalls(ctx Context, stream TokenStream, shuntingYard ShuntingYard) error {
+	for stream.NextIsCall() {
+		callee, ok := shuntingYard.Operands.Pop()
+		if !ok {
+			return errors.New("failed to pop callee from stack")
+		}
+		var start int
+		if t := triviaOf(callee); t != nil {
+			start = t.outerStart
+		}
+		if err := stream.Consume(); err != nil {
+			return errors.Wrap(err, "failed to consume start of call")
+		}
+		args, err := parseFunctionArgList(ctx, stream, shuntingYard, "")
+		if err != nil {
+			return errors.Wrap(err, "failed to parse call arg list")
+		}
+		shuntingYard.Operands.Push(CallNode{Callee: callee, Arguments: args})
+		if err := stream.Consume(); err != nil {
+			return errors.Wrap(err, "failed to consume end of call")
+		}
+		spanOperand(ctx, stream, shuntingYard, start)
+	}
+	return nil
+}
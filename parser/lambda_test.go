@@ -0,0 +1,69 @@
+package parser
+
+import "testing"
+
+func TestLambdaIdentifiers(t *testing.T) {
+	node, err := Parse("=LET(x, A1*2, LET(y, x+Rate, LAMBDA(x, x*y)(3)))+x", "Sheet1")
+	if err != nil {
+		t.Fatalf("could not parse: %v", err)
+	}
+	idents, names := 0, make([]string, 0)
+	var walk func(Node)
+	walk = func(n Node) {
+		switch n := n.(type) {
+		case IdentifierNode:
+			idents++
+		case NameNode:
+			names = append(names, n.Name)
+		}
+		for _, child := range n.Children() {
+			walk(child)
+		}
+	}
+	walk(node)
+	// x and y where they are bound and used, but not the last x, which is outside of the LET
+	if idents != 6 {
+		t.Errorf("got %d identifiers; want 6", idents)
+	}
+	if len(names) != 2 || names[0] != "Rate" || names[1] != "x" {
+		t.Errorf("got names %v; want [Rate x]", names)
+	}
+}
+
+func TestLambdaStringify(t *testing.T) {
+	formulas := []Formula{
+		"=LET(x, A1*2, x+x)",
+		"=LAMBDA(a, b, a+b)(1, 2)",
+		"=LET(f, LAMBDA(v, v*2), f(3))",
+		"=LAMBDA(x, LAMBDA(y, x+y))(1)(2)",
+		"=MAP(A1:A3, LAMBDA(v, v+1))",
+		"=_xlfn.LET(_xlpm.x, 2, _xlpm.x*3)",
+	}
+	for _, f := range formulas {
+		node, err := Parse(string(f), "Sheet1")
+		if err != nil {
+			t.Errorf("could not parse %s: %v", f, err)
+			continue
+		}
+		if got := StringifyNode(node, "Sheet1"); got != f {
+			t.Errorf("StringifyNode(%s) = %s", f, got)
+		}
+	}
+	if _, err := Parse("=LET(Sheet2!x, 1, 2)", "Sheet1"); err == nil {
+		t.Errorf("LET bound a name with a sheet")
+	}
+}
+
+func TestLambdaShift(t *testing.T) {
+	node, err := Parse("=LET(x, A1, f, LAMBDA(v, v+B2), f(x)+$C$1)", "Sheet1")
+	if err != nil {
+		t.Fatalf("could not parse: %v", err)
+	}
+	shifted, err := ShiftNode(node, 1, 1)
+	if err != nil {
+		t.Fatalf("could not shift: %v", err)
+	}
+	if got, want := StringifyNode(shifted, "Sheet1"), Formula("=LET(x, B2, f, LAMBDA(v, v+C3), f(x)+$C$1)"); got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
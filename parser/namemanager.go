@@ -0,0 +1,225 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+// NameManager defines, renames and deletes the defined names of a workbook,
+// like Excel's Name Manager does.
+// Definitions are checked by parsing them, and renaming a name
+// rewrites the formulas of the workbook using it.
+type NameManager struct {
+	wb *xl.Workbook
+}
+
+func NewNameManager(wb *xl.Workbook) *NameManager {
+	return &NameManager{wb: wb}
+}
+
+// List returns the defined names sorted by name, workbook names first.
+func (m *NameManager) List() []xl.DefinedName {
+	names := slices.Clone(m.wb.Names)
+	slices.SortStableFunc(names, func(a, b xl.DefinedName) int {
+		if c := strings.Compare(strings.ToUpper(a.Name), strings.ToUpper(b.Name)); c != 0 {
+			return c
+		}
+		return strings.Compare(strings.ToUpper(a.Scope), strings.ToUpper(b.Scope))
+	})
+	return names
+}
+
+// Get returns the name defined with the given scope, "" being the workbook.
+// Unlike ResolveName, a sheet name doesn't hide the workbook name.
+func (m *NameManager) Get(name string, scope string) (xl.DefinedName, bool) {
+	i := m.index(name, scope)
+	if i < 0 {
+		return xl.DefinedName{}, false
+	}
+	return m.wb.Names[i], true
+}
+
+// Define adds a defined name to the workbook.
+// The name must be valid and not already defined in the same scope,
+// which must be "" or one of the sheets of the workbook.
+//
+// The definition must parse. References without a sheet are only allowed
+// in names scoped to a sheet, and are taken to be in that sheet.
+func (m *NameManager) Define(def xl.DefinedName) error {
+	if !IsValidName(def.Name) {
+		return errors.Errorf("invalid name %q", def.Name)
+	}
+	if def.Scope != "" {
+		sheet, ok := m.wb.GetSheet(def.Scope)
+		if !ok {
+			return errors.Errorf("no sheet %s to scope %s to", def.Scope, def.Name)
+		}
+		def.Scope = sheet.Name
+	}
+	if m.index(def.Name, def.Scope) >= 0 {
+		return errors.Errorf("%s is already defined", def.Name)
+	}
+	if !strings.HasPrefix(string(def.RefersTo), "=") {
+		def.RefersTo = "=" + def.RefersTo
+	}
+	if _, err := Parse(string(def.RefersTo), def.Scope); err != nil {
+		return errors.Wrapf(err, "invalid definition for %s", def.Name)
+	}
+	m.wb.Names = append(m.wb.Names, def)
+	return m.namesChanged()
+}
+
+// Delete removes the name defined with the given scope.
+// Like in Excel, the formulas still using it then evaluate to #NAME?.
+func (m *NameManager) Delete(name string, scope string) error {
+	i := m.index(name, scope)
+	if i < 0 {
+		return errors.Errorf("%s is not defined", name)
+	}
+	m.wb.Names = slices.Delete(m.wb.Names, i, i+1)
+	return m.namesChanged()
+}
+
+// RenameError is returned by Rename when formulas which may use the renamed name
+// can't be rewritten, e.g. because they don't parse: they are left as is,
+// still using the old name if they did.
+type RenameError struct {
+	Name  string
+	Cells []Cell
+	// Defined names whose definition doesn't parse
+	Definitions []string
+}
+
+func (e *RenameError) Error() string {
+	unparsed := make([]string, 0, len(e.Cells)+len(e.Definitions))
+	for _, c := range e.Cells {
+		unparsed = append(unparsed, string(c.StripDollars().ToAddress()))
+	}
+	unparsed = append(unparsed, e.Definitions...)
+	return fmt.Sprintf("could not rename %s in the formulas of %s", e.Name, strings.Join(unparsed, ", "))
+}
+
+// Rename renames the name defined with the given scope, and rewrites
+// the formulas and definitions using it, as they are written, e.g. only
+// the name changes in =SUM( Revenue ,1E3 ).
+// Formulas that don't parse are left as is, and reported with a *RenameError
+// once the rest is renamed.
+func (m *NameManager) Rename(name string, scope string, newName string) error {
+	i := m.index(name, scope)
+	if i < 0 {
+		return errors.Errorf("%s is not defined", name)
+	}
+	if !IsValidName(newName) {
+		return errors.Errorf("invalid name %q", newName)
+	}
+	// Changing the case of a name is fine
+	if j := m.index(newName, scope); j >= 0 && j != i {
+		return errors.Errorf("%s is already defined", newName)
+	}
+	old := m.wb.Names[i]
+
+	// What refers to the renamed name must be found before renaming it
+	rename := func(sheet string, n NameNode) NameNode {
+		lookup := n.Sheet
+		if lookup == "" {
+			lookup = sheet
+		}
+		if def, ok := m.wb.ResolveName(n.Name, lookup); ok && def == old {
+			n.Name = newName
+		}
+		return n
+	}
+	cells := make(map[xl.Cell]xl.Formula)
+	unparsed := &RenameError{Name: old.Name}
+	for _, sheet := range m.wb.Sheets {
+		for row, vals := range sheet.Content {
+			for col, val := range vals {
+				if val.Type != xl.CTFormula {
+					continue
+				}
+				c := xl.Cell{Sheet: sheet.Name, Row: uint32(row), Col: uint16(col)}
+				f, ok, err := renameIn(val.ValFormula, sheet.Name, old.Name, rename)
+				if err != nil {
+					unparsed.Cells = append(unparsed.Cells, c)
+				} else if ok {
+					cells[c] = f
+				}
+			}
+		}
+	}
+	for j, def := range m.wb.Names {
+		f, ok, err := renameIn(def.RefersTo, def.Scope, old.Name, rename)
+		if err != nil {
+			unparsed.Definitions = append(unparsed.Definitions, def.Name)
+		} else if ok {
+			m.wb.Names[j].RefersTo = f
+		}
+	}
+
+	m.wb.Names[i].Name = newName
+	for c, f := range cells {
+		sheet, _ := m.wb.GetSheet(c.Sheet)
+		sheet.Content[c.Row][c.Col].ValFormula = f
+	}
+	if err := m.namesChanged(); err != nil {
+		return err
+	}
+	if len(unparsed.Cells) > 0 || len(unparsed.Definitions) > 0 {
+		return unparsed
+	}
+	return nil
+}
+
+// index returns the index of the name defined with the given scope, or -1.
+func (m *NameManager) index(name string, scope string) int {
+	return slices.IndexFunc(m.wb.Names, func(def xl.DefinedName) bool {
+		return strings.EqualFold(def.Name, name) && strings.EqualFold(def.Scope, scope)
+	})
+}
+
+func (m *NameManager) namesChanged() error {
+	if m.wb.Calc == nil {
+		return nil
+	}
+	return m.wb.Calc.NamesChanged(m.wb)
+}
+
+// renameIn applies rename to the names of a formula located in the given sheet,
+// and returns the new formula, written like the old one, if any name changed.
+func renameIn(f xl.Formula, sheet string, name string, rename func(string, NameNode) NameNode) (xl.Formula, bool, error) {
+	// Most formulas don't use the name, no need to parse them
+	if !strings.Contains(strings.ToUpper(string(f)), strings.ToUpper(name)) {
+		return "", false, nil
+	}
+	node, err := ParseLossless(string(f), sheet)
+	if err != nil {
+		return "", false, err
+	}
+	changed := false
+	node, err = mapNames(node, func(n NameNode) NameNode {
+		renamed := rename(sheet, n)
+		changed = changed || renamed != n
+		return renamed
+	})
+	if err != nil {
+		return "", false, err
+	}
+	if !changed {
+		return "", false, nil
+	}
+	return StringifyNodeLossless(node, Context{CurrentSheet: sheet}), true, nil
+}
+
+// mapNames returns a copy of the tree where every name is replaced by f(name).
+func mapNames(n Node, f func(NameNode) NameNode) (Node, error) {
+	return Rewrite(n, func(n Node) (Node, error) {
+		if name, ok := n.(NameNode); ok {
+			return f(name), nil
+		}
+		return nil, nil
+	})
+}
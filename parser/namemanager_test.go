@@ -0,0 +1,163 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/usr-ein/excelparser/xl"
+)
+
+func nameManagerWorkbook(t *testing.T) *xl.Workbook {
+	wb := &xl.Workbook{Name: "Book1"}
+	for _, raw := range []xl.RawSheet{
+		{Name: "Sheet1", Content: [][]any{{1, 2, "=SUM(Revenue)*TaxRate"}, {3, "=revenue", "=Sheet2!Local"}}},
+		{Name: "Sheet2", Content: [][]any{{"=Local+TaxRate", "=A1*Local"}}},
+	} {
+		sheet, err := raw.ToSheet()
+		if err != nil {
+			t.Fatalf("ToSheet failed with %s", err)
+		}
+		wb.Sheets = append(wb.Sheets, sheet)
+	}
+	return wb
+}
+
+func TestNameManagerDefine(t *testing.T) {
+	wb := nameManagerWorkbook(t)
+	names := NewNameManager(wb)
+	good := []xl.DefinedName{
+		{Name: "Revenue", RefersTo: "=Sheet1!$A$1:$A$2"},
+		{Name: "TaxRate", RefersTo: "0.2"},
+		{Name: "Local", Scope: "sheet2", RefersTo: "=$B$1"},
+		{Name: "Net", RefersTo: "=SUM(Revenue)*(1-TaxRate)"},
+	}
+	for _, def := range good {
+		if err := names.Define(def); err != nil {
+			t.Errorf("Define(%s) failed with %s", def.Name, err)
+		}
+	}
+	bad := []xl.DefinedName{
+		// Already defined
+		{Name: "REVENUE", RefersTo: "=1"},
+		// Invalid names
+		{Name: "A1", RefersTo: "=1"},
+		{Name: "Tax Rate", RefersTo: "=1"},
+		// No such sheet
+		{Name: "Other", Scope: "Sheet3", RefersTo: "=1"},
+		// Doesn't parse
+		{Name: "Broken", RefersTo: "=SUM(1,"},
+		// No sheet for the reference in a workbook name
+		{Name: "Orphan", RefersTo: "=$A$1"},
+	}
+	for _, def := range bad {
+		if err := names.Define(def); err == nil {
+			t.Errorf("Define(%s) should have failed", def.Name)
+		}
+	}
+
+	list := names.List()
+	expected := []xl.DefinedName{
+		{Name: "Local", Scope: "Sheet2", RefersTo: "=$B$1"},
+		{Name: "Net", RefersTo: "=SUM(Revenue)*(1-TaxRate)"},
+		{Name: "Revenue", RefersTo: "=Sheet1!$A$1:$A$2"},
+		{Name: "TaxRate", RefersTo: "=0.2"},
+	}
+	if len(list) != len(expected) {
+		t.Fatalf("List() = %v; want %v", list, expected)
+	}
+	for i := range expected {
+		if list[i] != expected[i] {
+			t.Errorf("List()[%d] = %v; want %v", i, list[i], expected[i])
+		}
+	}
+
+	if err := names.Delete("taxrate", ""); err != nil {
+		t.Errorf("Delete failed with %s", err)
+	}
+	if _, ok := names.Get("TaxRate", ""); ok {
+		t.Errorf("TaxRate should have been deleted")
+	}
+	if err := names.Delete("Local", ""); err == nil {
+		t.Errorf("Local is scoped to Sheet2, deleting it from the workbook should fail")
+	}
+}
+
+func TestNameManagerRename(t *testing.T) {
+	wb := nameManagerWorkbook(t)
+	names := NewNameManager(wb)
+	for _, def := range []xl.DefinedName{
+		{Name: "Revenue", RefersTo: "=Sheet1!$A$1:$A$2"},
+		{Name: "TaxRate", RefersTo: "=0.2"},
+		{Name: "Local", Scope: "Sheet2", RefersTo: "=TaxRate*2"},
+		// Hides the workbook TaxRate in Sheet2
+		{Name: "TaxRate", Scope: "Sheet2", RefersTo: "=0.1"},
+		{Name: "Net", RefersTo: "=SUM(Revenue)*(1-TaxRate)"},
+	} {
+		if err := names.Define(def); err != nil {
+			t.Fatalf("Define(%s) failed with %s", def.Name, err)
+		}
+	}
+
+	if err := names.Rename("TaxRate", "", "Revenue"); err == nil {
+		t.Errorf("renaming to an existing name should fail")
+	}
+	if err := names.Rename("TaxRate", "", "VAT"); err != nil {
+		t.Fatalf("Rename failed with %s", err)
+	}
+	if err := names.Rename("revenue", "", "Sales"); err != nil {
+		t.Fatalf("Rename failed with %s", err)
+	}
+
+	formulas := map[string]xl.Formula{
+		"Sheet1!C1": "=SUM(Sales)*VAT",
+		"Sheet1!B2": "=Sales",
+		"Sheet1!C2": "=Sheet2!Local",
+		// TaxRate is the one of Sheet2 here, so it stays
+		"Sheet2!A1": "=Local+TaxRate",
+	}
+	for address, want := range formulas {
+		c, _ := xl.ParseCell(address, "")
+		sheet, _ := wb.GetSheet(c.Sheet)
+		if got := sheet.Content[c.Row][c.Col].ValFormula; got != want {
+			t.Errorf("%s = %s; want %s", address, got, want)
+		}
+	}
+	definitions := map[string]xl.Formula{
+		"Net":   "=SUM(Sales)*(1-VAT)",
+		"Local": "=TaxRate*2",
+	}
+	for _, def := range names.List() {
+		if want, ok := definitions[def.Name]; ok && def.RefersTo != want {
+			t.Errorf("%s refers to %s; want %s", def.Name, def.RefersTo, want)
+		}
+	}
+}
+
+func TestNameManagerRenameAsWritten(t *testing.T) {
+	raw := xl.RawSheet{Name: "Sheet1", Content: [][]any{{1, `=SUM( Revenue ,1E3 )&" said ""hi"""`, `=Revenue+)`}}}
+	sheet, err := raw.ToSheet()
+	if err != nil {
+		t.Fatalf("ToSheet failed with %s", err)
+	}
+	wb := &xl.Workbook{Name: "Book1", Sheets: []xl.Sheet{sheet}}
+	names := NewNameManager(wb)
+	if err := names.Define(xl.DefinedName{Name: "Revenue", RefersTo: "=Sheet1!$A$1"}); err != nil {
+		t.Fatalf("Define failed with %s", err)
+	}
+
+	err = names.Rename("Revenue", "", "Sales")
+	var renameErr *RenameError
+	if !errors.As(err, &renameErr) || len(renameErr.Cells) != 1 || renameErr.Cells[0] != (Cell{Sheet: "Sheet1", Row: 0, Col: 2}) {
+		t.Errorf("Rename failed with %v; want the unparsed formula of C1 reported", err)
+	}
+	if _, ok := names.Get("Sales", ""); !ok {
+		t.Errorf("Sales isn't defined after renaming Revenue")
+	}
+	content := wb.Sheets[0].Content
+	if got, want := content[0][1].ValFormula, xl.Formula(`=SUM( Sales ,1E3 )&" said ""hi"""`); got != want {
+		t.Errorf("B1 = %s; want %s", got, want)
+	}
+	if got, want := content[0][2].ValFormula, xl.Formula(`=Revenue+)`); got != want {
+		t.Errorf("C1 = %s; want %s left as is", got, want)
+	}
+}
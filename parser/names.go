@@ -0,0 +1,150 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+var ErrUnknownName = errors.New("unknown name")
+
+// NameResolver looks up defined names, see xl.DefinedNames for an implementation.
+type NameResolver interface {
+	// ResolveName returns the definition of a name as seen from a formula in the given sheet.
+	ResolveName(name string, sheet string) (xl.DefinedName, bool)
+}
+
+// NameNode is a reference to a defined name, e.g. Revenue or Sheet1!Revenue.
+// It stays symbolic in the tree, see ResolveName to get what it stands for.
+type NameNode struct {
+	Name string `json:"name"`
+	// Sheet the name is qualified with, e.g. Sheet1 in Sheet1!Revenue, or "" if none
+	Sheet   string `json:"sheet,omitempty"`
+	*Trivia `json:"-"`
+}
+
+func (n NameNode) Type() NodeType {
+	return NodeTypeName
+}
+
+// IsEq compares names case-insensitively, like Excel does.
+func (n NameNode) IsEq(node Node) bool {
+	if node.Type() != NodeTypeName {
+		return false
+	}
+	other := node.(NameNode)
+	return strings.EqualFold(n.Name, other.Name) && strings.EqualFold(n.Sheet, other.Sheet)
+}
+
+func (n NameNode) Children() []Node {
+	return []Node{}
+}
+
+// String returns the name as written in a formula.
+func (n NameNode) String() string {
+	if n.Sheet == "" {
+		return n.Name
+	}
+	return xl.QuoteSheetName(n.Sheet) + "!" + n.Name
+}
+
+// Names that Excel would read as a cell, e.g. AB12, or as an R1C1 reference, e.g. R2C3 or C
+var (
+	cellLikeName = regexp.MustCompile(`^[A-Za-z]{1,3}[0-9]+$`)
+	r1c1LikeName = regexp.MustCompile(`^([Rr][0-9]*([Cc][0-9]*)?|[Cc][0-9]*)$`)
+)
+
+// IsValidName tells whether a string can be used as a defined name.
+// Like in Excel, names start with a letter, an underscore or a backslash,
+// go on with letters, digits, underscores, periods, backslashes and question marks,
+// and can't look like a cell reference.
+func IsValidName(name string) bool {
+	if name == "" || utf8.RuneCountInString(name) > 255 {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r), r == '_', r == '\\':
+		case i > 0 && (unicode.IsDigit(r) || r == '.' || r == '?'):
+		default:
+			return false
+		}
+	}
+	if r1c1LikeName.MatchString(name) {
+		return false
+	}
+	if cellLikeName.MatchString(name) {
+		// Only the address matters, any sheet will do
+		if _, err := xl.ParseCell(strings.ToUpper(name), "Sheet1"); err == nil {
+			return false
+		}
+	}
+	upper := strings.ToUpper(name)
+	return upper != "TRUE" && upper != "FALSE"
+}
+
+// splitName splits a possibly sheet-qualified name like Sheet1!Revenue
+// into its sheet and its name, and tells whether it is a valid name.
+func splitName(s string) (sheet string, name string, ok bool) {
+	name = s
+	if i := strings.LastIndexByte(s, '!'); i >= 0 {
+		sheet = xl.UnquoteSheetName(s[:i])
+		name = s[i+1:]
+		// Names can't be 3D, e.g. Jan:Dec!Revenue, and names of other
+		// workbooks are external references, e.g. [Book2.xlsx]Sheet1!Revenue
+		if sheet == "" || strings.ContainsAny(sheet, ":[") {
+			return "", "", false
+		}
+	}
+	return sheet, name, IsValidName(name)
+}
+
+// ResolveName parses what a name stands for, as seen from ctx.CurrentSheet
+// unless the name is qualified with a sheet.
+// Names of references resolve to a CellNode or a CellRangeNode, names of
+// constants to a value node, and names of formulas to the root of the formula.
+// Names missing from ctx.Names give an ErrUnknownName error.
+//
+// References in the definition without a sheet are taken to be in the sheet
+// the name is scoped to, or in the sheet it is looked up from.
+func ResolveName(ctx Context, n NameNode) (Node, error) {
+	sheet := n.Sheet
+	if sheet == "" {
+		sheet = ctx.CurrentSheet
+	}
+	if ctx.Names == nil {
+		return nil, errors.Wrap(ErrUnknownName, n.String())
+	}
+	def, ok := ctx.Names.ResolveName(n.Name, sheet)
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownName, n.String())
+	}
+	if def.Scope != "" {
+		sheet = def.Scope
+	}
+	formula := string(def.RefersTo)
+	if !strings.HasPrefix(formula, "=") {
+		formula = "=" + formula
+	}
+	node, err := BuildTree(Context{CurrentSheet: sheet, Names: ctx.Names}, Tokenize(formula))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the definition of %s", n.String())
+	}
+	return node, nil
+}
+
+func parseName(stream TokenStream) (NameNode, error) {
+	next := stream.GetNext()
+	sheet, name, ok := splitName(next.Value)
+	if !ok {
+		return NameNode{}, errors.New("invalid name")
+	}
+	if err := stream.Consume(); err != nil {
+		return NameNode{}, errors.Wrap(err, "failed to consume name token")
+	}
+	return NameNode{Name: name, Sheet: sheet}, nil
+}
@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/usr-ein/excelparser/xl"
+)
+
+func TestIsValidName(t *testing.T) {
+	valid := []string{"Revenue", "TaxRate", "Tax_2023", "_total", `\path`, "a.b?", "ABCD1", "XFE1", "Été"}
+	for _, name := range valid {
+		if !IsValidName(name) {
+			t.Errorf("%s should be a valid name", name)
+		}
+	}
+	invalid := []string{"", "A1", "Tax2023", "xfd1048576", "R", "c", "R1C1", "rc2", "C12", "TRUE", "1abc", "a b", "a-b", "$A"}
+	for _, name := range invalid {
+		if IsValidName(name) {
+			t.Errorf("%s should not be a valid name", name)
+		}
+	}
+}
+
+func TestStringifyName(t *testing.T) {
+	formulas := []Formula{
+		"=Revenue*TaxRate",
+		"=SUM(Sheet2!Costs, 'My sheet'!Costs)",
+		"=IF(Tax_2023>A1, Tax_2023, 0)",
+	}
+	for _, f := range formulas {
+		node, err := Parse(string(f), "Sheet1")
+		if err != nil {
+			t.Fatalf("could not parse %s: %v", f, err)
+		}
+		if got := StringifyNode(node, "Sheet1"); got != f {
+			t.Errorf("got %s; want %s", got, f)
+		}
+	}
+}
+
+func TestResolveName(t *testing.T) {
+	names := xl.DefinedNames{
+		{Name: "TaxRate", RefersTo: "=0.2"},
+		{Name: "TaxRate", Scope: "Sheet2", RefersTo: "=0.1"},
+		{Name: "Revenue", RefersTo: "=Sheet1!$A$1:$A$3"},
+		{Name: "Local", Scope: "Sheet2", RefersTo: "=$B$1"},
+		{Name: "Net", RefersTo: "=SUM(Revenue)*(1-TaxRate)"},
+	}
+	cases := map[string]Node{
+		"TaxRate":        NumberNode{Value: 0.2},
+		"Sheet2!TaxRate": NumberNode{Value: 0.1},
+		"taxrate":        NumberNode{Value: 0.2},
+		"Sheet2!Local":   mustParse(t, "=$B$1", "Sheet2"),
+		"Revenue":        mustParse(t, "=Sheet1!$A$1:$A$3", "Sheet1"),
+		"Net":            mustParse(t, "=SUM(Revenue)*(1-TaxRate)", "Sheet1"),
+	}
+	for formula, want := range cases {
+		name := mustParse(t, "="+formula, "Sheet1").(NameNode)
+		got, err := ResolveName(Context{CurrentSheet: "Sheet1", Names: names}, name)
+		if err != nil {
+			t.Errorf("could not resolve %s: %v", formula, err)
+			continue
+		}
+		if !got.IsEq(want) {
+			t.Errorf("%s resolved to %v; want %v", formula, got, want)
+		}
+	}
+
+	// Local is only visible from Sheet2
+	_, err := ResolveName(Context{CurrentSheet: "Sheet1", Names: names}, NameNode{Name: "Local"})
+	if !errors.Is(err, ErrUnknownName) {
+		t.Errorf("expected ErrUnknownName, got %v", err)
+	}
+	_, err = ResolveName(Context{CurrentSheet: "Sheet1"}, NameNode{Name: "TaxRate"})
+	if !errors.Is(err, ErrUnknownName) {
+		t.Errorf("expected ErrUnknownName without resolver, got %v", err)
+	}
+}
+
+func mustParse(t *testing.T, formula string, sheet string) Node {
+	node, err := Parse(formula, sheet)
+	if err != nil {
+		t.Fatalf("could not parse %s: %v", formula, err)
+	}
+	return node
+}
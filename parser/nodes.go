@@ -1,9 +1,9 @@
 package parser
 
 import (
-	"fmt"
 	"math"
 	"strconv"
+	"strings"
 )
 
 // Node is the interface that all nodes in the AST implement.
@@ -30,10 +30,20 @@ const (
 	NodeTypeNumber
 	NodeTypeText
 	NodeTypeLogical
+	NodeTypeArray
+	NodeTypeError
+	NodeTypeName
+	NodeTypeStructuredRef
+	NodeTypeRef3D
+	NodeTypeExternalRef
+	NodeTypeSpillRef
+	NodeTypeIdentifier
+	NodeTypeCall
+	NodeTypeEmpty
 )
 
 func (NodeType NodeType) IsTerminal() bool {
-	return NodeType == NodeTypeNumber || NodeType == NodeTypeText || NodeType == NodeTypeLogical || NodeType == NodeTypeCell || NodeType == NodeTypeCellRange
+	return NodeType == NodeTypeNumber || NodeType == NodeTypeText || NodeType == NodeTypeLogical || NodeType == NodeTypeCell || NodeType == NodeTypeCellRange || NodeType == NodeTypeArray || NodeType == NodeTypeError || NodeType == NodeTypeName || NodeType == NodeTypeStructuredRef || NodeType == NodeTypeRef3D || NodeType == NodeTypeExternalRef || NodeType == NodeTypeSpillRef || NodeType == NodeTypeIdentifier || NodeType == NodeTypeEmpty
 }
 
 func (nodeType NodeType) String() string {
@@ -54,13 +64,34 @@ func (nodeType NodeType) String() string {
 		return "binExp"
 	case NodeTypeUnaryExpression:
 		return "unaExp"
+	case NodeTypeArray:
+		return "array"
+	case NodeTypeError:
+		return "err"
+	case NodeTypeName:
+		return "name"
+	case NodeTypeStructuredRef:
+		return "structRef"
+	case NodeTypeRef3D:
+		return "ref3D"
+	case NodeTypeExternalRef:
+		return "extRef"
+	case NodeTypeSpillRef:
+		return "spillRef"
+	case NodeTypeIdentifier:
+		return "ident"
+	case NodeTypeCall:
+		return "call"
+	case NodeTypeEmpty:
+		return "empty"
 	default:
 		return "Unknown"
 	}
 }
 
 type CellNode struct {
-	Cell Cell `json:"cell"`
+	Cell    Cell `json:"cell"`
+	*Trivia `json:"-"`
 }
 
 func (c CellNode) Type() NodeType {
@@ -84,8 +115,9 @@ func (c CellNode) Children() []Node {
 
 type CellRangeNode struct {
 	// Make sure that start and end are in the same sheet!
-	Start CellNode `json:"startCell"`
-	End   CellNode `json:"endCell"`
+	Start   CellNode `json:"startCell"`
+	End     CellNode `json:"endCell"`
+	*Trivia `json:"-"`
 }
 
 func (c CellRangeNode) Type() NodeType {
@@ -119,6 +151,7 @@ func (c CellRangeNode) Children() []Node {
 type FunctionNode struct {
 	Name      string `json:"name"`
 	Arguments []Node `json:"arguments"`
+	*Trivia   `json:"-"`
 }
 
 func (f FunctionNode) Type() NodeType {
@@ -150,7 +183,8 @@ func (c FunctionNode) Children() []Node {
 }
 
 type NumberNode struct {
-	Value float64 `json:"value"`
+	Value   float64 `json:"value"`
+	*Trivia `json:"-"`
 }
 
 func (n NumberNode) Type() NodeType {
@@ -170,14 +204,20 @@ func (n NumberNode) Children() []Node {
 
 func (n NumberNode) String() string {
 	num := n.Value
-	if num == math.Trunc(num) {
+	if num == math.Trunc(num) && math.Abs(num) < 1<<53 {
 		return strconv.FormatInt(int64(num), 10)
 	}
-	return fmt.Sprintf("%.4f", num)
+	// Shortest representation that parses back to the same number,
+	// with an exponent like Excel for very large or small numbers, e.g. 1E+20
+	if abs := math.Abs(num); abs >= 1e15 || abs < 1e-9 {
+		return strconv.FormatFloat(num, 'E', -1, 64)
+	}
+	return strconv.FormatFloat(num, 'f', -1, 64)
 }
 
 type TextNode struct {
-	Value string `json:"value"`
+	Value   string `json:"value"`
+	*Trivia `json:"-"`
 }
 
 func (t TextNode) Type() NodeType {
@@ -196,11 +236,13 @@ func (t TextNode) Children() []Node {
 }
 
 func (t TextNode) String() string {
-	return "\"" + t.Value + "\""
+	// Quotes within texts are doubled, e.g. "say ""hi"""
+	return "\"" + strings.ReplaceAll(t.Value, "\"", "\"\"") + "\""
 }
 
 type LogicalNode struct {
-	Value bool `json:"value"`
+	Value   bool `json:"value"`
+	*Trivia `json:"-"`
 }
 
 func (l LogicalNode) Type() NodeType {
@@ -225,10 +267,57 @@ func (l LogicalNode) String() string {
 	return "FALSE"
 }
 
+// ErrorNode is an error literal, e.g. #N/A.
+type ErrorNode struct {
+	Code    ErrorCode `json:"code"`
+	*Trivia `json:"-"`
+}
+
+func (e ErrorNode) Type() NodeType {
+	return NodeTypeError
+}
+
+func (e ErrorNode) IsEq(node Node) bool {
+	if node.Type() != NodeTypeError {
+		return false
+	}
+	return e.Code == node.(ErrorNode).Code
+}
+
+func (e ErrorNode) Children() []Node {
+	return []Node{}
+}
+
+func (e ErrorNode) String() string {
+	return string(e.Code)
+}
+
+// EmptyNode is an argument left out, e.g. the second one of =IF(A1,,2).
+type EmptyNode struct {
+	*Trivia `json:"-"`
+}
+
+func (e EmptyNode) Type() NodeType {
+	return NodeTypeEmpty
+}
+
+func (e EmptyNode) IsEq(node Node) bool {
+	return node.Type() == NodeTypeEmpty
+}
+
+func (e EmptyNode) Children() []Node {
+	return []Node{}
+}
+
+func (e EmptyNode) String() string {
+	return ""
+}
+
 type BinaryExpressionNode struct {
 	Operator string `json:"operator"`
 	Left     Node   `json:"left"`
 	Right    Node   `json:"right"`
+	*Trivia  `json:"-"`
 }
 
 func (b BinaryExpressionNode) Type() NodeType {
@@ -246,9 +335,13 @@ func (b BinaryExpressionNode) Children() []Node {
 	return []Node{b.Left, b.Right}
 }
 
+// UnaryExpressionNode is an operator applied to its operand: - for negation,
+// @ for the implicit intersection of Excel 365, e.g. =@A1:A10, or the postfix %
+// for percentages, e.g. =A1%.
 type UnaryExpressionNode struct {
 	Operator string `json:"operator"`
 	Operand  Node   `json:"operand"`
+	*Trivia  `json:"-"`
 }
 
 func (u UnaryExpressionNode) Type() NodeType {
@@ -265,3 +358,44 @@ func (u UnaryExpressionNode) IsEq(node Node) bool {
 func (u UnaryExpressionNode) Children() []Node {
 	return []Node{u.Operand}
 }
+
+// ArrayNode is an array constant, e.g. {1,2;3,4}.
+// Its rows all have the same length, and only hold numbers, texts, logicals and errors.
+type ArrayNode struct {
+	Rows    [][]Node `json:"rows"`
+	*Trivia `json:"-"`
+}
+
+func (a ArrayNode) Type() NodeType {
+	return NodeTypeArray
+}
+
+func (a ArrayNode) IsEq(node Node) bool {
+	if node.Type() != NodeTypeArray {
+		return false
+	}
+	other := node.(ArrayNode)
+	if len(a.Rows) != len(other.Rows) {
+		return false
+	}
+	for i, row := range a.Rows {
+		if len(row) != len(other.Rows[i]) {
+			return false
+		}
+		for j, elem := range row {
+			if !elem.IsEq(other.Rows[i][j]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Children returns the elements of the array, row by row.
+func (a ArrayNode) Children() []Node {
+	elems := make([]Node, 0)
+	for _, row := range a.Rows {
+		elems = append(elems, row...)
+	}
+	return elems
+}
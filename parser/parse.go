@@ -1,11 +1,59 @@
 package parser
 
+import "github.com/pkg/errors"
+
 // Parse takes a formula string and returns a Node representing
 // the formula root.
 // The currentSheet parameter is used to resolve relative cell references.
+//
+// Errors are of type *ParseError, whose Token is the text of the
+// offending token as written in the formula.
 func Parse(formula string, currentSheet string) (Node, error) {
-	tokens := Tokenize(formula)
-	return BuildTree(Context{
+	return parse(formula, Context{
+		CurrentSheet: currentSheet,
+	})
+}
+
+// ParseR1C1 is like Parse, for formulas written in R1C1 notation like =R[-1]C+RC[2].
+// Relative references are offsets from anchor, the cell the formula is located in,
+// and end up as cells with RowRel or ColRel set, like in A1 notation.
+func ParseR1C1(formula string, anchor Cell) (Node, error) {
+	return parse(formula, Context{
+		CurrentSheet: anchor.Sheet,
+		R1C1:         true,
+		Anchor:       anchor,
+	})
+}
+
+// ParseLossless is like Parse, but nodes keep how they were written, see Trivia,
+// for StringifyNodeLossless to write the formula back the same way, changes aside.
+func ParseLossless(formula string, currentSheet string) (Node, error) {
+	return parse(formula, Context{
 		CurrentSheet: currentSheet,
-	}, tokens)
+		Lossless:     true,
+	})
+}
+
+// ParseWithContext is like Parse, with every option of ctx, e.g. for a formula
+// written in another dialect than en-US:
+//
+//	node, err := ParseWithContext(`=SOMME(A1;B1)*1,5`, Context{CurrentSheet: "Sheet1", Dialect: FrFR})
+func ParseWithContext(formula string, ctx Context) (Node, error) {
+	return parse(formula, ctx)
+}
+
+func parse(formula string, ctx Context) (Node, error) {
+	tokens := TokenizeDialect(formula, ctx.dialect())
+	node, err := BuildTree(ctx, tokens)
+	if err != nil {
+		var parseErr *ParseError
+		if errors.As(err, &parseErr) && parseErr.Offset+parseErr.Length <= len(formula) {
+			parseErr.Token = formula[parseErr.Offset : parseErr.Offset+parseErr.Length]
+		}
+		return nil, err
+	}
+	if ctx.Lossless {
+		fillTrivia(node, formula)
+	}
+	return node, nil
 }
@@ -11,7 +11,7 @@ type NodeJSON struct {
 
 func ToNodeJson(n Node) NodeJSON {
 	switch n.Type() {
-	case NodeTypeNumber, NodeTypeText, NodeTypeLogical, NodeTypeCell, NodeTypeCellRange:
+	case NodeTypeNumber, NodeTypeText, NodeTypeLogical, NodeTypeError, NodeTypeName, NodeTypeStructuredRef, NodeTypeRef3D, NodeTypeExternalRef, NodeTypeSpillRef, NodeTypeIdentifier, NodeTypeEmpty, NodeTypeCell, NodeTypeCellRange:
 		return NodeJSON{
 			Type:  n.Type().String(),
 			Value: getLabel(n),
@@ -26,6 +26,16 @@ func ToNodeJson(n Node) NodeJSON {
 			Type:  n.Type().String() + " " + funcNode.Name,
 			Value: args,
 		}
+	case NodeTypeCall:
+		callNode := n.(CallNode)
+		args := make([]NodeJSON, len(callNode.Arguments))
+		for i, arg := range callNode.Arguments {
+			args[i] = ToNodeJson(arg)
+		}
+		return NodeJSON{
+			Type:  n.Type().String(),
+			Value: append([]NodeJSON{ToNodeJson(callNode.Callee)}, args...),
+		}
 	case NodeTypeBinaryExpression:
 		binNode := n.(BinaryExpressionNode)
 		return NodeJSON{
@@ -41,6 +51,19 @@ func ToNodeJson(n Node) NodeJSON {
 			Type:  n.Type().String() + " " + unaryNode.Operator,
 			Value: ToNodeJson(unaryNode.Operand),
 		}
+	case NodeTypeArray:
+		arrayNode := n.(ArrayNode)
+		rows := make([][]NodeJSON, len(arrayNode.Rows))
+		for i, row := range arrayNode.Rows {
+			rows[i] = make([]NodeJSON, len(row))
+			for j, elem := range row {
+				rows[i][j] = ToNodeJson(elem)
+			}
+		}
+		return NodeJSON{
+			Type:  n.Type().String(),
+			Value: rows,
+		}
 	default:
 		return NodeJSON{
 			Type:  "Unknown",
@@ -61,14 +84,26 @@ func getLabel(node Node) string {
 		return node.(TextNode).Value
 	case NodeTypeLogical:
 		return fmt.Sprintf("%t", node.(LogicalNode).Value)
+	case NodeTypeError:
+		return string(node.(ErrorNode).Code)
+	case NodeTypeName:
+		return node.(NameNode).String()
+	case NodeTypeStructuredRef:
+		return node.(StructuredRefNode).String()
+	case NodeTypeRef3D:
+		return node.(Ref3DNode).String()
+	case NodeTypeExternalRef:
+		return node.(ExternalRefNode).String()
+	case NodeTypeSpillRef:
+		return node.(SpillRefNode).String()
+	case NodeTypeIdentifier:
+		return node.(IdentifierNode).String()
+	case NodeTypeEmpty:
+		return node.(EmptyNode).String()
 	case NodeTypeCell:
 		return string(node.(CellNode).Cell.ToAddress())
 	case NodeTypeCellRange:
-		rightCell, err := node.(CellRangeNode).End.Cell.Shift(-1, -1)
-		if err != nil {
-			rightCell = node.(CellRangeNode).End.Cell
-		}
-		return fmt.Sprintf("%s:%s", node.(CellRangeNode).Start.Cell.ToAddress(), rightCell.ToAddressNoSheet())
+		return node.(CellRangeNode).Range().String()
 	default:
 		return "Unknown node type"
 	}
@@ -0,0 +1,67 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+// isR1C1Ref tells whether a reference token is a cell or a range in R1C1 notation,
+// e.g. R[-1]C, Sheet2!R1C1:R10C1 or C[2].
+func isR1C1Ref(s string) bool {
+	if i := strings.LastIndexByte(s, '!'); i >= 0 {
+		s = s[i+1:]
+	}
+	start, end, isRange := strings.Cut(s, ":")
+	return xl.IsR1C1(start) && (!isRange || xl.IsR1C1(end))
+}
+
+// parseR1C1Ref parses a cell or a range in R1C1 notation into a CellNode or a CellRangeNode,
+// relative to the anchor of ctx, in sheet unless the reference has its own.
+func parseR1C1Ref(ctx Context, s string, sheet string) (Node, error) {
+	anchor := ctx.anchor()
+	if sheet != "" {
+		anchor.Sheet = sheet
+	}
+	if c, err := xl.ParseCellR1C1(s, anchor); err == nil {
+		return CellNode{Cell: c}, nil
+	}
+	r, err := xl.ParseRangeR1C1(s, anchor)
+	if err != nil {
+		return nil, err
+	}
+	return CellRangeNode{Start: CellNode{Cell: r.Start}, End: CellNode{Cell: r.End}}, nil
+}
+
+// parseRef parses the cell or range of a 3D or external reference, located in sheet,
+// in the notation of ctx.
+func parseRef(ctx Context, s string, sheet string) (Node, error) {
+	if ctx.R1C1 {
+		return parseR1C1Ref(ctx, s, sheet)
+	}
+	if strings.Contains(s, ":") {
+		r, err := xl.ParseRange(s, sheet)
+		if err != nil {
+			return nil, err
+		}
+		return CellRangeNode{Start: CellNode{Cell: r.Start}, End: CellNode{Cell: r.End}}, nil
+	}
+	c, err := xl.ParseCell(s, sheet)
+	if err != nil {
+		return nil, err
+	}
+	return CellNode{Cell: c}, nil
+}
+
+func parseR1C1(ctx Context, stream TokenStream) (Node, error) {
+	next := stream.GetNext()
+	node, err := parseR1C1Ref(ctx, next.Value, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse R1C1 reference")
+	}
+	if err := stream.Consume(); err != nil {
+		return nil, errors.Wrap(err, "failed to consume R1C1 reference token")
+	}
+	return node, nil
+}
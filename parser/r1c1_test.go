@@ -0,0 +1,58 @@
+package parser
+
+import "testing"
+
+func TestParseR1C1(t *testing.T) {
+	anchor := Cell{Sheet: "Sheet1", Row: 4, Col: 1} // B5
+	cases := map[Formula]Formula{
+		"=R[-1]C+RC[2]":                     "=B4+D5",
+		"=SUM(R1C1:R10C1)":                  "=SUM($A$1:$A$10)",
+		"=SUM(R[-2]C:R[-1]C)*Sheet2!R1C[1]": "=SUM(B3:B4)*Sheet2!C$1",
+		"=SUM(C[-1]:C)+SUM(R2)":             "=SUM(A:B)+SUM($2:$2)",
+		"=R5C[-1]&'My sheet'!RC":            "=A$5&'My sheet'!B5",
+		"=SUM(Jan:Dec!R[1]C[1])":            "=SUM(Jan:Dec!C6)",
+		"=[Book2.xlsx]Sheet1!R1C1+Revenue":  "=[Book2.xlsx]Sheet1!$A$1+Revenue",
+		"=SUM(Table1[Sales])":               "=SUM(Table1[Sales])",
+	}
+	for f, want := range cases {
+		node, err := ParseR1C1(string(f), anchor)
+		if err != nil {
+			t.Errorf("could not parse %s: %v", f, err)
+			continue
+		}
+		if got := StringifyNode(node, "Sheet1"); got != want {
+			t.Errorf("ParseR1C1(%s) gave %s; want %s", f, got, want)
+		}
+		if got := StringifyNodeR1C1(node, anchor); got != f {
+			t.Errorf("StringifyNodeR1C1(%s) = %s", f, got)
+		}
+	}
+}
+
+func TestParseR1C1_Bad(t *testing.T) {
+	anchor := Cell{Sheet: "Sheet1", Row: 0, Col: 0}
+	for _, f := range []string{"=R[-1]C", "=RC[-1]", "=A1+1", "=R0C1"} {
+		if node, err := ParseR1C1(f, anchor); err == nil {
+			t.Errorf("ParseR1C1(%s) succeeded with %v; want error", f, node)
+		}
+	}
+}
+
+func TestStringifyNodeR1C1_CopiedDown(t *testing.T) {
+	// The same formula copied down reads the same in R1C1 notation
+	formulas := map[Formula]Cell{
+		"=SUM($A$1:A2)*B2": {Sheet: "Sheet1", Row: 1, Col: 2},
+		"=SUM($A$1:A3)*B3": {Sheet: "Sheet1", Row: 2, Col: 2},
+		"=SUM($A$1:A4)*B4": {Sheet: "Sheet1", Row: 3, Col: 2},
+	}
+	want := Formula("=SUM(R1C1:RC[-2])*RC[-1]")
+	for f, host := range formulas {
+		node, err := Parse(string(f), host.Sheet)
+		if err != nil {
+			t.Fatalf("could not parse %s: %v", f, err)
+		}
+		if got := StringifyNodeR1C1(node, host); got != want {
+			t.Errorf("StringifyNodeR1C1(%s, %s) = %s; want %s", f, host.ToAddress(), got, want)
+		}
+	}
+}
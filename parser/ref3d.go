@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+// Ref3DNode is a reference to the same cell or range on a span of sheets,
+// e.g. Jan:Dec!B5 or Sheet1:Sheet3!A1:B2.
+type Ref3DNode struct {
+	FirstSheet string `json:"firstSheet"`
+	LastSheet  string `json:"lastSheet"`
+	// Cell or range referenced on each sheet, as a CellNode or a CellRangeNode in FirstSheet
+	Ref     Node `json:"ref"`
+	*Trivia `json:"-"`
+}
+
+func (r Ref3DNode) Type() NodeType {
+	return NodeTypeRef3D
+}
+
+func (r Ref3DNode) IsEq(node Node) bool {
+	if node.Type() != NodeTypeRef3D {
+		return false
+	}
+	other := node.(Ref3DNode)
+	return strings.EqualFold(r.FirstSheet, other.FirstSheet) &&
+		strings.EqualFold(r.LastSheet, other.LastSheet) &&
+		r.Ref.IsEq(other.Ref)
+}
+
+// Children returns nothing, since the cell or range alone is only
+// a part of the reference.
+func (r Ref3DNode) Children() []Node {
+	return []Node{}
+}
+
+// String returns the reference as written in a formula, e.g. 'Jan 1:Dec'!B5.
+func (r Ref3DNode) String() string {
+	return r.stringify(refStyle{dialect: EnUS})
+}
+
+func (r Ref3DNode) stringify(style refStyle) string {
+	span := r.FirstSheet + ":" + r.LastSheet
+	if xl.QuoteSheetName(r.FirstSheet) != r.FirstSheet || xl.QuoteSheetName(r.LastSheet) != r.LastSheet {
+		span = "'" + strings.ReplaceAll(span, "'", "''") + "'"
+	}
+	return span + "!" + stringifyNode(r.Ref, -1, style.inSheet(r.FirstSheet))
+}
+
+// Range returns the range referenced on each sheet, in FirstSheet.
+func (r Ref3DNode) Range() Range {
+	if r.Ref.Type() == NodeTypeCell {
+		c := r.Ref.(CellNode).Cell
+		return Range{Start: c, End: Cell{Sheet: c.Sheet, Row: c.Row + 1, Col: c.Col + 1, RowRel: c.RowRel, ColRel: c.ColRel}}
+	}
+	return r.Ref.(CellRangeNode).Range()
+}
+
+// Expand returns the range referenced on each sheet of the span,
+// in the order of the sheets of the workbook.
+func (r Ref3DNode) Expand(wb *xl.Workbook) ([]Range, error) {
+	sheets, err := wb.SheetSpan(r.FirstSheet, r.LastSheet)
+	if err != nil {
+		return nil, err
+	}
+	ranges := make([]Range, len(sheets))
+	for i, sheet := range sheets {
+		rng := r.Range()
+		rng.Start.Sheet, rng.End.Sheet = sheet.Name, sheet.Name
+		ranges[i] = rng
+	}
+	return ranges, nil
+}
+
+// split3DRef splits a 3D reference like Sheet1:Sheet3!A1:B2 into its sheets
+// and its cell or range, and false if it isn't one.
+func split3DRef(s string) (first string, last string, ref string, ok bool) {
+	i := strings.LastIndexByte(s, '!')
+	if i < 0 {
+		return "", "", "", false
+	}
+	// Tokenize already dropped the quotes around the sheets
+	first, last, ok = strings.Cut(s[:i], ":")
+	if !ok || first == "" || last == "" || strings.ContainsAny(last, ":!") || strings.Contains(first, "[") {
+		return "", "", "", false
+	}
+	// A range with a sheet on its end, e.g. A1:Sheet2!A5, which we tolerate.
+	// Sheets named like cells would need quotes, which Tokenize dropped, so we can't tell.
+	if _, err := xl.ParseCell(first, last); err == nil {
+		return "", "", "", false
+	}
+	return first, last, s[i+1:], true
+}
+
+func parseRef3D(ctx Context, stream TokenStream) (Ref3DNode, error) {
+	next := stream.GetNext()
+	first, last, ref, ok := split3DRef(next.Value)
+	if !ok {
+		return Ref3DNode{}, errors.New("invalid 3D reference")
+	}
+	cellOrRange, err := parseRef(ctx, ref, first)
+	if err != nil {
+		return Ref3DNode{}, errors.Wrap(err, "failed to parse 3D reference")
+	}
+	node := Ref3DNode{FirstSheet: first, LastSheet: last, Ref: cellOrRange}
+	if err := stream.Consume(); err != nil {
+		return Ref3DNode{}, errors.Wrap(err, "failed to consume 3D reference token")
+	}
+	return node, nil
+}
@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/usr-ein/excelparser/xl"
+)
+
+func TestRef3D(t *testing.T) {
+	cases := map[Formula]string{
+		"=SUM(Jan:Dec!B5)":          "Jan:Dec!B5",
+		"=SUM('Jan 1:Mar'!$A$1:B2)": "'Jan 1:Mar'!$A$1:B2",
+		"=SUM(Sheet1:Sheet3!A:A)":   "Sheet1:Sheet3!A:A",
+		"=SUM('2023:2024'!A1)":      "'2023:2024'!A1",
+	}
+	for f, want := range cases {
+		node, err := Parse(string(f), "Summary")
+		if err != nil {
+			t.Errorf("could not parse %s: %v", f, err)
+			continue
+		}
+		ref, ok := node.(FunctionNode).Arguments[0].(Ref3DNode)
+		if !ok {
+			t.Errorf("%s: expected a Ref3DNode, got %v", f, node.(FunctionNode).Arguments[0])
+			continue
+		}
+		if got := ref.String(); got != want {
+			t.Errorf("%s: got %s; want %s", f, got, want)
+		}
+		if got := StringifyNode(node, "Summary"); got != f {
+			t.Errorf("StringifyNode(%s) = %s", f, got)
+		}
+	}
+}
+
+func TestRef3DExpand(t *testing.T) {
+	wb := &xl.Workbook{Sheets: []xl.Sheet{{Name: "Summary"}, {Name: "Jan"}, {Name: "Feb"}, {Name: "Mar"}}}
+	node, err := Parse("=SUM(Mar:jan!B5:C6)", "Summary")
+	if err != nil {
+		t.Fatalf("could not parse: %v", err)
+	}
+	ranges, err := node.(FunctionNode).Arguments[0].(Ref3DNode).Expand(wb)
+	if err != nil {
+		t.Fatalf("Expand failed with %s", err)
+	}
+	expected := []string{"Jan!B5:C6", "Feb!B5:C6", "Mar!B5:C6"}
+	if len(ranges) != len(expected) {
+		t.Fatalf("got %d ranges; want %d", len(ranges), len(expected))
+	}
+	for i, r := range ranges {
+		if got := r.String(); got != expected[i] {
+			t.Errorf("range %d is %s; want %s", i, got, expected[i])
+		}
+	}
+
+	node, _ = Parse("=SUM(Jan:Apr!B5)", "Summary")
+	if _, err := node.(FunctionNode).Arguments[0].(Ref3DNode).Expand(wb); err == nil {
+		t.Errorf("expected an error for a missing sheet")
+	}
+}
@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// OffSheetError is returned when moving a formula pushes some of
+// its references outside of the sheet, for each cell where it happened.
+// Excel shows #REF! in those cells.
+type OffSheetError struct {
+	Cells []Cell
+}
+
+func (e *OffSheetError) Error() string {
+	addresses := make([]string, len(e.Cells))
+	for i, c := range e.Cells {
+		addresses[i] = string(c.StripDollars().ToAddress())
+	}
+	return fmt.Sprintf("references pushed off the sheet in %s", strings.Join(addresses, ", "))
+}
+
+// ExpandSharedFormula computes the formula of every cell of a shared formula,
+// the way XLSX files store formulas copied over a range: the master formula is
+// written in its anchor cell only, and the other cells of the range use the same
+// formula with relative references moved accordingly.
+//
+// The returned map is keyed by cells with RowRel and ColRel set to false.
+// Cells whose references would be pushed off the sheet are left out of it,
+// and listed in an *OffSheetError.
+func ExpandSharedFormula(master Formula, anchor Cell, ref Range) (map[Cell]Formula, error) {
+	node, err := Parse(string(master), anchor.Sheet)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse master formula")
+	}
+	anchor = anchor.WithDollars()
+
+	formulas := make(map[Cell]Formula)
+	offSheet := make([]Cell, 0)
+	for _, c := range ref.Normalize().Cells() {
+		c = Cell{Sheet: anchor.Sheet, Row: c.Row, Col: c.Col}
+		if c == anchor {
+			// Keep the master formula as it was written
+			formulas[c] = master
+			continue
+		}
+		moved, err := MoveNode(node, anchor, c)
+		if err != nil {
+			offSheet = append(offSheet, c)
+			continue
+		}
+		formulas[c] = StringifyNode(moved, anchor.Sheet)
+	}
+	if len(offSheet) > 0 {
+		return formulas, &OffSheetError{Cells: offSheet}
+	}
+	return formulas, nil
+}
@@ -0,0 +1,86 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/usr-ein/excelparser/xl"
+)
+
+func TestExpandSharedFormula(t *testing.T) {
+	anchor, _ := xl.ParseCell("B2", "Sheet1")
+	ref, _ := xl.ParseRange("B2:C3", "Sheet1")
+	formulas, err := ExpandSharedFormula("=A2*$A$1+SUM(A$1:A2)", anchor, ref)
+	if err != nil {
+		t.Fatalf("ExpandSharedFormula failed with %s", err)
+	}
+	expected := map[string]Formula{
+		"B2": "=A2*$A$1+SUM(A$1:A2)",
+		"C2": "=B2*$A$1+SUM(B$1:B2)",
+		"B3": "=A3*$A$1+SUM(A$1:A3)",
+		"C3": "=B3*$A$1+SUM(B$1:B3)",
+	}
+	if len(formulas) != len(expected) {
+		t.Errorf("got %d formulas; want %d", len(formulas), len(expected))
+	}
+	for address, want := range expected {
+		c, _ := xl.ParseCell(address, "Sheet1")
+		if got := formulas[c.WithDollars()]; got != want {
+			t.Errorf("%s = %s; want %s", address, got, want)
+		}
+	}
+}
+
+func TestExpandSharedFormulaOffSheet(t *testing.T) {
+	anchor, _ := xl.ParseCell("B3", "Sheet1")
+	ref, _ := xl.ParseRange("A1:B3", "Sheet1")
+	formulas, err := ExpandSharedFormula("=A2", anchor, ref)
+	var offSheet *OffSheetError
+	if !errors.As(err, &offSheet) {
+		t.Fatalf("expected an OffSheetError, got %v", err)
+	}
+	// A1, B1, A2 and A3 would reference cells above row 1 or left of column A
+	if len(offSheet.Cells) != 4 {
+		t.Errorf("got %d cells off the sheet; want 4: %s", len(offSheet.Cells), err)
+	}
+	b2, _ := xl.ParseCell("B2", "Sheet1")
+	if got := formulas[b2.WithDollars()]; got != "=A1" {
+		t.Errorf("B2 = %s; want =A1", got)
+	}
+}
+
+func TestExpandSharedFormulaQuotes(t *testing.T) {
+	anchor, _ := xl.ParseCell("B1", "Sheet1")
+	ref, _ := xl.ParseRange("B1:B2", "Sheet1")
+	formulas, err := ExpandSharedFormula(`=IF('O''Brien'!A1=" said ""hi""",A1,"")`, anchor, ref)
+	if err != nil {
+		t.Fatalf("ExpandSharedFormula failed with %s", err)
+	}
+	b2, _ := xl.ParseCell("B2", "Sheet1")
+	want := Formula(`=IF('O''Brien'!A2=" said ""hi""", A2, "")`)
+	if got := formulas[b2.WithDollars()]; got != want {
+		t.Errorf("B2 = %s; want %s", got, want)
+	}
+	if _, err := Parse(string(formulas[b2.WithDollars()]), "Sheet1"); err != nil {
+		t.Errorf("could not parse B2 again: %v", err)
+	}
+}
+
+func TestExpandSharedFormulaLargeNumbers(t *testing.T) {
+	anchor, _ := xl.ParseCell("B1", "Sheet1")
+	ref, _ := xl.ParseRange("B1:B3", "Sheet1")
+	formulas, err := ExpandSharedFormula(`=A1*1E+20-1.5E-12`, anchor, ref)
+	if err != nil {
+		t.Fatalf("ExpandSharedFormula failed with %s", err)
+	}
+	expected := map[string]Formula{
+		"B2": "=A2*1E+20-1.5E-12",
+		"B3": "=A3*1E+20-1.5E-12",
+	}
+	for address, want := range expected {
+		c, _ := xl.ParseCell(address, "Sheet1")
+		if got := formulas[c.WithDollars()]; got != want {
+			t.Errorf("%s = %s; want %s", address, got, want)
+		}
+	}
+}
@@ -16,70 +16,52 @@ func MoveNode(n Node, origin Cell, dest Cell) (Node, error) {
 }
 
 func ShiftNode(n Node, shiftRow int, shiftCol int) (Node, error) {
-	switch n.Type() {
-	case NodeTypeNumber, NodeTypeText, NodeTypeLogical:
-		return n, nil
-	case NodeTypeFunction:
-		fNode := n.(FunctionNode)
-		args := make([]Node, len(fNode.Arguments))
-		for i, arg := range fNode.Arguments {
-			shiftedArg, err := ShiftNode(arg, shiftRow, shiftCol)
-			if err != nil {
-				return nil, err
-			}
-			args[i] = shiftedArg
-		}
-		return FunctionNode{
-			Name:      fNode.Name,
-			Arguments: args,
-		}, nil
-	case NodeTypeBinaryExpression:
-		bNode := n.(BinaryExpressionNode)
-		shiftedLeft, err := ShiftNode(bNode.Left, shiftRow, shiftCol)
-		if err != nil {
+	return Rewrite(n, func(n Node) (Node, error) {
+		return shiftRef(n, shiftRow, shiftCol)
+	})
+}
+
+// shiftRef returns the reference n shifted, or nil if it isn't a reference
+// or it doesn't move, e.g. $A$1, so that Rewrite keeps it.
+func shiftRef(n Node, shiftRow int, shiftCol int) (Node, error) {
+	switch node := n.(type) {
+	case CellNode:
+		cell, err := node.Cell.ShiftIfRel(shiftRow, shiftCol)
+		if err != nil || cell == node.Cell {
 			return nil, err
 		}
-		shiftedRight, err := ShiftNode(bNode.Right, shiftRow, shiftCol)
-		if err != nil {
+		node.Cell = cell
+		return node, nil
+	case SpillRefNode:
+		cell, err := node.Cell.ShiftIfRel(shiftRow, shiftCol)
+		if err != nil || cell == node.Cell {
 			return nil, err
 		}
-		return BinaryExpressionNode{
-			Left:     shiftedLeft,
-			Operator: bNode.Operator,
-			Right:    shiftedRight,
-		}, nil
-	case NodeTypeUnaryExpression:
-		uNode := n.(UnaryExpressionNode)
-		shiftedOperand, err := ShiftNode(uNode.Operand, shiftRow, shiftCol)
-		if err != nil {
+		node.Cell = cell
+		return node, nil
+	case CellRangeNode:
+		shiftedRange, err := node.Range().ShiftIfRel(shiftRow, shiftCol)
+		if err != nil || shiftedRange == node.Range() {
 			return nil, err
 		}
-		return UnaryExpressionNode{
-			Operator: uNode.Operator,
-			Operand:  shiftedOperand,
-		}, nil
-	case NodeTypeCell:
-		cNode := n.(CellNode)
-		shiftedCell, err := cNode.Cell.ShiftIfRel(shiftRow, shiftCol)
-		if err != nil {
+		node.Start, node.End = CellNode{Cell: shiftedRange.Start}, CellNode{Cell: shiftedRange.End}
+		return node, nil
+	case Ref3DNode:
+		ref, err := shiftRef(node.Ref, shiftRow, shiftCol)
+		if err != nil || ref == nil {
 			return nil, err
 		}
-		return CellNode{
-			Cell: shiftedCell,
-		}, nil
-	case NodeTypeCellRange:
-		rNode := n.(CellRangeNode)
-		shiftedRange, err := rNode.Range().ShiftIfRel(shiftRow, shiftCol)
-		if err != nil {
+		node.Ref = ref
+		return node, nil
+	case ExternalRefNode:
+		ref, err := shiftRef(node.Ref, shiftRow, shiftCol)
+		if err != nil || ref == nil {
 			return nil, err
 		}
-		return CellRangeNode{
-			Start: CellNode{Cell: shiftedRange.Start},
-			End:   CellNode{Cell: shiftedRange.End},
-		}, nil
+		node.Ref = ref
+		return node, nil
 	}
-	return nil, errors.New("unknown node type")
-
+	return nil, nil
 }
 
 // Shifts a formula from one cell to another, inside the same sheet.
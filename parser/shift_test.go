@@ -190,3 +190,70 @@ func TestShiftFormulaUnaryParenth(t *testing.T) {
 		return
 	}
 }
+
+func TestShiftFormulaWholeColumnsAndRows(t *testing.T) {
+	f := Formula(`=SUM(A:A)+VLOOKUP(B1, Data!$A:C, 3, 0)+SUM(1:$2)`)
+	shifted, err := ShiftFormula(f, 4, 1, `Sheet1`)
+	if err != nil {
+		t.Errorf("ShiftFormula failed with %s", err)
+		return
+	}
+
+	expected := Formula(`=SUM(B:B)+VLOOKUP(C5, Data!$A:D, 3, 0)+SUM(5:$2)`)
+	if shifted != expected {
+		t.Errorf("ShiftFormula failed, expected %s, got %s", expected, shifted)
+		return
+	}
+}
+
+func TestShiftFormulaArray(t *testing.T) {
+	f := Formula(`=INDEX({1,-2.5;"a",TRUE}, A1, 2)`)
+	shifted, err := ShiftFormula(f, 1, 0, `Sheet1`)
+	if err != nil {
+		t.Errorf("ShiftFormula failed with %s", err)
+		return
+	}
+
+	expected := Formula(`=INDEX({1,-2.5;"a",TRUE}, A2, 2)`)
+	if shifted != expected {
+		t.Errorf("ShiftFormula failed, expected %s, got %s", expected, shifted)
+		return
+	}
+}
+
+func TestShiftFormulaRef3D(t *testing.T) {
+	f := Formula(`=SUM(Jan:Dec!B5)+SUM('Week 1:Week 4'!A$1:$B2)`)
+	shifted, err := ShiftFormula(f, 2, 1, `Sheet1`)
+	if err != nil {
+		t.Errorf("ShiftFormula failed with %s", err)
+		return
+	}
+
+	expected := Formula(`=SUM(Jan:Dec!C7)+SUM('Week 1:Week 4'!B$1:$B4)`)
+	if shifted != expected {
+		t.Errorf("ShiftFormula failed, expected %s, got %s", expected, shifted)
+		return
+	}
+}
+
+func TestShiftNodeKeepsUnmoved(t *testing.T) {
+	node, err := ParseLossless(`=SUM($A$1, Jan:Dec!$B$5, [1]Sheet1!$A$1:$B$2)*A1`, `Sheet1`)
+	if err != nil {
+		t.Errorf("Parse failed with %s", err)
+		return
+	}
+	shifted, err := ShiftNode(node, 1, 1)
+	if err != nil {
+		t.Errorf("ShiftNode failed with %s", err)
+		return
+	}
+
+	// Only the path to A1 is rebuilt
+	sum, shiftedSum := node.(BinaryExpressionNode).Left.(FunctionNode), shifted.(BinaryExpressionNode).Left.(FunctionNode)
+	if &sum.Arguments[0] != &shiftedSum.Arguments[0] {
+		t.Errorf("ShiftNode rebuilt SUM although none of its references moved")
+	}
+	if got := shifted.(BinaryExpressionNode).Right.(CellNode).Cell; got.Row != 1 || got.Col != 1 {
+		t.Errorf("ShiftNode moved A1 to %s; want B2", got.ToAddress())
+	}
+}
@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+// SpillRefNode is a reference to the range a dynamic array formula spills over,
+// written with the # operator after the cell of the formula, e.g. C3# or Sheet2!$A$1#.
+// It stays symbolic in the tree, see xl.Sheet.SpillRange to get its range.
+type SpillRefNode struct {
+	Cell    Cell `json:"cell"`
+	*Trivia `json:"-"`
+}
+
+func (s SpillRefNode) Type() NodeType {
+	return NodeTypeSpillRef
+}
+
+func (s SpillRefNode) IsEq(node Node) bool {
+	if node.Type() != NodeTypeSpillRef {
+		return false
+	}
+	return s.Cell.IsEq(node.(SpillRefNode).Cell)
+}
+
+func (s SpillRefNode) Children() []Node {
+	return []Node{}
+}
+
+func (s SpillRefNode) String() string {
+	return string(s.Cell.ToAddress()) + "#"
+}
+
+// isSpillRef tells whether a reference token is a spill reference, e.g. A1#.
+func isSpillRef(s string) bool {
+	return strings.HasSuffix(s, "#") && !strings.HasSuffix(s, "]#")
+}
+
+func parseSpillRef(ctx Context, stream TokenStream) (SpillRefNode, error) {
+	next := stream.GetNext()
+	ref := strings.TrimSuffix(next.Value, "#")
+	var cell Cell
+	var err error
+	if ctx.R1C1 {
+		cell, err = xl.ParseCellR1C1(ref, ctx.anchor())
+	} else {
+		cell, err = xl.ParseCell(ref, ctx.CurrentSheet)
+	}
+	if err != nil {
+		return SpillRefNode{}, errors.Wrap(err, "failed to parse spill reference")
+	}
+	if err := stream.Consume(); err != nil {
+		return SpillRefNode{}, errors.Wrap(err, "failed to consume spill reference token")
+	}
+	return SpillRefNode{Cell: cell}, nil
+}
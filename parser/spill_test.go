@@ -0,0 +1,80 @@
+package parser
+
+import "testing"
+
+func TestSpillRef(t *testing.T) {
+	cases := map[Formula]string{
+		"=SUM(A1#)":        "Sheet1!A1#",
+		"=Sheet2!$B$2#*2":  "Sheet2!$B$2#",
+		"='My Sheet'!C3#":  "'My Sheet'!C3#",
+		"=COUNTA(A1#, B2)": "Sheet1!A1#",
+	}
+	for f, want := range cases {
+		node, err := Parse(string(f), "Sheet1")
+		if err != nil {
+			t.Errorf("could not parse %s: %v", f, err)
+			continue
+		}
+		spills := collectSpillRefs(node)
+		if len(spills) != 1 {
+			t.Errorf("%s: expected a SpillRefNode, got %v", f, node)
+			continue
+		}
+		if got := spills[0].String(); got != want {
+			t.Errorf("%s: got %s; want %s", f, got, want)
+		}
+		if got := StringifyNode(node, "Sheet1"); got != f {
+			t.Errorf("StringifyNode(%s) = %s", f, got)
+		}
+	}
+}
+
+func TestSpillRefNotErrors(t *testing.T) {
+	for _, f := range []string{"=#REF!", "=IFERROR(A1, #N/A)", "=Sales[#All]", `="A1#"`} {
+		node, err := Parse(f, "Sheet1")
+		if err != nil {
+			t.Errorf("could not parse %s: %v", f, err)
+			continue
+		}
+		if spills := collectSpillRefs(node); len(spills) != 0 {
+			t.Errorf("%s: unexpected spill references %v", f, spills)
+		}
+	}
+	if _, err := Parse("=A1#REF!", "Sheet1"); err == nil {
+		t.Errorf("=A1#REF! parsed, but isn't a formula")
+	}
+}
+
+func TestSpillRefShift(t *testing.T) {
+	node, err := Parse("=SUM(A1#)+$B$2#", "Sheet1")
+	if err != nil {
+		t.Fatalf("could not parse: %v", err)
+	}
+	shifted, err := ShiftNode(node, 2, 1)
+	if err != nil {
+		t.Fatalf("could not shift: %v", err)
+	}
+	if got, want := StringifyNode(shifted, "Sheet1"), Formula("=SUM(B3#)+$B$2#"); got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	anchor := Cell{Sheet: "Sheet1", Row: 4, Col: 1} // B5
+	r1c1, err := ParseR1C1("=SUM(R[-1]C#)", anchor)
+	if err != nil {
+		t.Fatalf("could not parse R1C1: %v", err)
+	}
+	if got, want := StringifyNode(r1c1, "Sheet1"), Formula("=SUM(B4#)"); got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func collectSpillRefs(n Node) []SpillRefNode {
+	res := make([]SpillRefNode, 0)
+	if spill, ok := n.(SpillRefNode); ok {
+		res = append(res, spill)
+	}
+	for _, child := range n.Children() {
+		res = append(res, collectSpillRefs(child)...)
+	}
+	return res
+}
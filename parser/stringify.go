@@ -6,54 +6,193 @@ import (
 )
 
 func StringifyNode(n Node, sheetName string) Formula {
-	return Formula("=" + stringifyNode(n, -1, sheetName))
+	return Formula("=" + stringifyNode(n, -1, refStyle{sheet: sheetName, dialect: EnUS}))
 }
 
-func stringifyNode(n Node, parentPrecedence int, sheetName string) string {
+// StringifyNodeDialect is like StringifyNode, but writes the formula in the given dialect,
+// e.g. =SOMME(A1; B1)*1,5 in FrFR. A nil dialect is EnUS.
+func StringifyNodeDialect(n Node, sheetName string, dialect *Dialect) Formula {
+	if dialect == nil {
+		dialect = EnUS
+	}
+	return Formula("=" + stringifyNode(n, -1, refStyle{sheet: sheetName, dialect: dialect}))
+}
+
+// StringifyNodeR1C1 is like StringifyNode, but writes references in R1C1 notation,
+// with relative rows and columns as offsets from anchor, the cell the formula is located in.
+// Copies of a formula across cells are written the same way, e.g. =R[-1]C+1.
+func StringifyNodeR1C1(n Node, anchor Cell) Formula {
+	return Formula("=" + stringifyNode(n, -1, refStyle{sheet: anchor.Sheet, r1c1: true, anchor: anchor, dialect: EnUS}))
+}
+
+// StringifyNodeLossless is like StringifyNode, but writes the nodes of a formula parsed
+// with ctx.Lossless as they were written, see Trivia, in the sheet, notation and dialect of ctx.
+// Nodes changed since, e.g. shifted cells, are written like StringifyNode does,
+// so a formula only changes where its tree did:
+//
+//	node, err := ParseLossless(`=SUM( A1:A2 ,1E3 )`, "Sheet1")
+//	node, err = ShiftNode(node, 1, 0)
+//	f := StringifyNodeLossless(node, Context{CurrentSheet: "Sheet1"}) // =SUM( A2:A3 ,1E3 )
+func StringifyNodeLossless(n Node, ctx Context) Formula {
+	return Formula("=" + stringifyNode(n, -1, refStyle{
+		sheet:    ctx.CurrentSheet,
+		r1c1:     ctx.R1C1,
+		anchor:   ctx.anchor(),
+		dialect:  ctx.dialect(),
+		lossless: true,
+	}))
+}
+
+// refStyle tells stringifyNode how to write references, and the rest of the formula.
+type refStyle struct {
+	// Sheet the formula is located in, left out of references to it
+	sheet string
+	// Whether to use R1C1 notation, with offsets from anchor
+	r1c1   bool
+	anchor Cell
+	// Dialect to write function names, constants and separators in
+	dialect *Dialect
+	// Whether to write nodes with trivia as they were written
+	lossless bool
+}
+
+// inSheet returns the style of references located in sheet,
+// e.g. the cell of a 3D reference.
+func (style refStyle) inSheet(sheet string) refStyle {
+	style.sheet = sheet
+	style.anchor.Sheet = sheet
+	return style
+}
+
+// needsParens tells whether the operand of a unary expression needs parentheses
+// although it isn't a terminal. Excel writes @INDEX(A:A, 1), -@A1, SUM(A1)% and A1%%
+// without them.
+func needsParens(uNode UnaryExpressionNode) bool {
+	switch operand := uNode.Operand.(type) {
+	case FunctionNode:
+		return uNode.Operator == "-"
+	case UnaryExpressionNode:
+		if uNode.Operator == "%" {
+			return operand.Operator != "%"
+		}
+		return operand.Operator != "@" && operand.Operator != "%"
+	}
+	return true
+}
+
+func stringifyNode(n Node, parentPrecedence int, style refStyle) string {
 	// To solve the "excessive parenthesis" problem, see this:
 	// https://stackoverflow.com/a/58679340/5989906
+	if style.lossless && triviaOf(n) != nil {
+		return stringifyTrivia(n, parentPrecedence, style)
+	}
 	switch n.Type() {
-	case NodeTypeNumber, NodeTypeLogical, NodeTypeText:
+	case NodeTypeNumber:
+		return style.dialect.number(n.(NumberNode))
+	case NodeTypeLogical:
+		return style.dialect.logical(n.(LogicalNode).Value)
+	case NodeTypeError:
+		return style.dialect.errorLiteral(n.(ErrorNode).Code)
+	case NodeTypeStructuredRef:
+		return n.(StructuredRefNode).format(style.dialect.tableItem, string(style.dialect.ArgumentSeparator))
+	case NodeTypeText, NodeTypeName, NodeTypeIdentifier, NodeTypeEmpty:
 		return n.(ValueNode).String()
+	case NodeTypeRef3D:
+		return n.(Ref3DNode).stringify(style)
+	case NodeTypeExternalRef:
+		return n.(ExternalRefNode).stringify(style)
 	case NodeTypeFunction:
 		fNode := n.(FunctionNode)
 		args := make([]string, len(fNode.Arguments))
 		for i, arg := range fNode.Arguments {
-			args[i] = stringifyNode(arg, -1, sheetName)
+			args[i] = stringifyNode(arg, argumentPrecedence(arg), style)
+		}
+		argsWithCommas := strings.Join(args, style.dialect.argumentSeparator())
+		return fmt.Sprintf("%s(%s)", style.dialect.functionName(fNode.Name), argsWithCommas)
+	case NodeTypeCall:
+		cNode := n.(CallNode)
+		callee := stringifyNode(cNode.Callee, -1, style)
+		switch cNode.Callee.Type() {
+		case NodeTypeFunction, NodeTypeIdentifier, NodeTypeCall:
+		default:
+			callee = "(" + callee + ")"
 		}
-		argsWithCommas := strings.Join(args, ", ")
-		return fmt.Sprintf("%s(%s)", fNode.Name, argsWithCommas)
+		args := make([]string, len(cNode.Arguments))
+		for i, arg := range cNode.Arguments {
+			args[i] = stringifyNode(arg, argumentPrecedence(arg), style)
+		}
+		return fmt.Sprintf("%s(%s)", callee, strings.Join(args, style.dialect.argumentSeparator()))
 	case NodeTypeBinaryExpression:
 		bNode := n.(BinaryExpressionNode)
 		// Deals with the precedence of the operators here
-		return stringifyBinaryExp(bNode, parentPrecedence, sheetName)
+		return stringifyBinaryExp(bNode, parentPrecedence, style)
 	case NodeTypeUnaryExpression:
 		uNode := n.(UnaryExpressionNode)
-		if uNode.Operand.Type().IsTerminal() {
+		if uNode.Operator == "%" {
+			// Postfix
+			if uNode.Operand.Type().IsTerminal() || !needsParens(uNode) {
+				return stringifyNode(uNode.Operand, -1, style) + "%"
+			}
+			return fmt.Sprintf("(%s)%%", stringifyNode(uNode.Operand, -1, style))
+		}
+		if uNode.Operand.Type().IsTerminal() || !needsParens(uNode) {
 			return fmt.Sprintf(
 				"%s%s",
 				uNode.Operator,
-				stringifyNode(uNode.Operand, -1, sheetName),
+				stringifyNode(uNode.Operand, -1, style),
 			)
 		}
 		return fmt.Sprintf(
 			"%s(%s)",
 			uNode.Operator,
-			stringifyNode(uNode.Operand, -1, sheetName),
+			stringifyNode(uNode.Operand, -1, style),
 		)
 	case NodeTypeCell:
 		cNode := n.(CellNode)
-		return string(cNode.Cell.ToAddressRel(sheetName))
+		if style.r1c1 {
+			return string(cNode.Cell.ToR1C1(style.anchor))
+		}
+		return string(cNode.Cell.ToAddressRel(style.sheet))
+	case NodeTypeSpillRef:
+		sNode := n.(SpillRefNode)
+		if style.r1c1 {
+			return string(sNode.Cell.ToR1C1(style.anchor)) + "#"
+		}
+		return string(sNode.Cell.ToAddressRel(style.sheet)) + "#"
 	case NodeTypeCellRange:
 		rNode := n.(CellRangeNode)
-		return rNode.Range().StringRel(sheetName)
+		if style.r1c1 {
+			return rNode.Range().StringR1C1(style.anchor)
+		}
+		return rNode.Range().StringRel(style.sheet)
+	case NodeTypeArray:
+		aNode := n.(ArrayNode)
+		rows := make([]string, len(aNode.Rows))
+		for i, row := range aNode.Rows {
+			elems := make([]string, len(row))
+			for j, elem := range row {
+				elems[j] = stringifyNode(elem, argumentPrecedence(elem), style)
+			}
+			rows[i] = strings.Join(elems, string(style.dialect.ArrayColumnSeparator))
+		}
+		return "{" + strings.Join(rows, string(style.dialect.ArrayRowSeparator)) + "}"
 	default:
 		// I know, not great, not terrible...
 		return "ERROR_STRINGIFYING_NODE"
 	}
 }
 
-func stringifyBinaryExp(b BinaryExpressionNode, parentPrecedence int, sheetName string) string {
+// argumentPrecedence returns the precedence an argument of a function or a call,
+// or an element of an array, is written with: unions are within parentheses,
+// e.g. SUM((A1,B1)), so that they aren't taken for several arguments.
+func argumentPrecedence(arg Node) int {
+	if bNode, ok := arg.(BinaryExpressionNode); ok && bNode.Operator == "," {
+		return PrecedenceMap[","] + 1
+	}
+	return -1
+}
+
+func stringifyBinaryExp(b BinaryExpressionNode, parentPrecedence int, style refStyle) string {
 	opPrecedence, ok := PrecedenceMap[b.Operator]
 	if !ok {
 		return "ERROR_STRINGIFYING_BINARY_EXP"
@@ -63,17 +202,17 @@ func stringifyBinaryExp(b BinaryExpressionNode, parentPrecedence int, sheetName
 		return "ERROR_STRINGIFYING_BINARY_EXP"
 	}
 	if !commu {
-		left := stringifyNode(b.Left, opPrecedence, sheetName)
-		right := stringifyNode(b.Right, opPrecedence+1, sheetName)
-		res := left + b.Operator + right
+		left := stringifyNode(b.Left, opPrecedence, style)
+		right := stringifyNode(b.Right, opPrecedence+1, style)
+		res := left + style.dialect.operator(b.Operator) + right
 		if parentPrecedence > opPrecedence {
 			return "(" + res + ")"
 		}
 		return res
 	} else {
-		left := stringifyNode(b.Left, opPrecedence, sheetName)
-		right := stringifyNode(b.Right, opPrecedence, sheetName)
-		res := left + b.Operator + right
+		left := stringifyNode(b.Left, opPrecedence, style)
+		right := stringifyNode(b.Right, opPrecedence, style)
+		res := left + style.dialect.operator(b.Operator) + right
 		if parentPrecedence > opPrecedence {
 			return "(" + res + ")"
 		}
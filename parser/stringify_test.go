@@ -0,0 +1,107 @@
+package parser
+
+import "testing"
+
+func TestStringifyImplicitIntersection(t *testing.T) {
+	formulas := []Formula{
+		"=@A1:A10",
+		"=@Sales[Col]",
+		"=@INDEX(A:A, 1)",
+		"=-@A1:A2*2",
+		"=@'My Sheet'!$B$1:$B$9&\"x\"",
+		"=SUM(@Data!A1:A3, 1)",
+	}
+	for _, f := range formulas {
+		node, err := Parse(string(f), "Sheet1")
+		if err != nil {
+			t.Errorf("could not parse %s: %v", f, err)
+			continue
+		}
+		if got := StringifyNode(node, "Sheet1"); got != f {
+			t.Errorf("StringifyNode(%s) = %s", f, got)
+		}
+	}
+}
+
+func TestStringifyNumbers(t *testing.T) {
+	testCases := map[string]Formula{
+		"=1E20":                  "=1E+20",
+		"=-1E+300*2":             "=-1E+300*2",
+		"=9007199254740991":      "=9007199254740991",
+		"=123456789012345678":    "=1.2345678901234568E+17",
+		"=0.5+1.25E-12":          "=0.5+1.25E-12",
+		"=100000000000000-0.001": "=100000000000000-0.001",
+	}
+	for formula, expected := range testCases {
+		node, err := Parse(formula, "Sheet1")
+		if err != nil {
+			t.Errorf("could not parse %s: %v", formula, err)
+			continue
+		}
+		got := StringifyNode(node, "Sheet1")
+		if got != expected {
+			t.Errorf("StringifyNode(%s) = %s; want %s", formula, got, expected)
+		}
+		if back, err := Parse(string(got), "Sheet1"); err != nil || !back.IsEq(node) {
+			t.Errorf("%s doesn't parse back to %s: %v", got, formula, err)
+		}
+	}
+}
+
+func TestStringifyUnionArguments(t *testing.T) {
+	formulas := []Formula{
+		"=SUM((A1,B1))",
+		"=SUM((A1,B1), C1)",
+		"=LAMBDA(x, SUM(x))((A1,B1))",
+		"=SUM(A1:B2 B1:C2)",
+		"=INDEX((A1:B2,C1:D2), 1, 1, 2)",
+	}
+	for _, f := range formulas {
+		node, err := Parse(string(f), "Sheet1")
+		if err != nil {
+			t.Errorf("could not parse %s: %v", f, err)
+			continue
+		}
+		if got := StringifyNode(node, "Sheet1"); got != f {
+			t.Errorf("StringifyNode(%s) = %s", f, got)
+		}
+	}
+
+	// A union made an argument gets parentheses
+	union := BinaryExpressionNode{Operator: ",", Left: CellNode{Cell: Cell{Sheet: "Sheet1"}}, Right: CellNode{Cell: Cell{Sheet: "Sheet1", Col: 1}}}
+	node, err := ParseLossless(`=SUM( A1 )`, "Sheet1")
+	if err != nil {
+		t.Fatalf("could not parse: %v", err)
+	}
+	fNode := node.(FunctionNode)
+	fNode.Arguments = []Node{union}
+	if got, want := StringifyNodeLossless(fNode, Context{CurrentSheet: "Sheet1"}), Formula(`=SUM( ($A$1,$B$1) )`); got != want {
+		t.Errorf("StringifyNodeLossless = %s; want %s", got, want)
+	}
+}
+
+func TestStringifyEmptyArgumentsAndPercent(t *testing.T) {
+	testCases := map[string]Formula{
+		`=IF(A1,,2)`:           `=IF(A1, , 2)`,
+		`=VLOOKUP(A1,B:C,2,)`:  `=VLOOKUP(A1, B:C, 2, )`,
+		`=F(,)`:                `=F(, )`,
+		`=-A1%`:                `=-A1%`,
+		`=(A1+1)%*SUM(B1:B2)%`: `=(A1+1)%*SUM(B1:B2)%`,
+		`=A1%%`:                `=A1%%`,
+		`=(-A1)%`:              `=(-A1)%`,
+	}
+	for formula, want := range testCases {
+		node, err := Parse(formula, "Sheet1")
+		if err != nil {
+			t.Errorf("could not parse %s: %v", formula, err)
+			continue
+		}
+		got := StringifyNode(node, "Sheet1")
+		if got != want {
+			t.Errorf("StringifyNode(%s) = %s; want %s", formula, got, want)
+		}
+		if reparsed, err := Parse(string(got), "Sheet1"); err != nil || !reparsed.IsEq(node) {
+			t.Errorf("%s doesn't parse back to %s: %v", got, formula, err)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+// StructuredRefNode is a structured reference to a table,
+// e.g. Table1[Sales], [@Qty] or Table1[[#Headers],[Sales]:[Cost]].
+// It stays symbolic in the tree, see xl.Tables.Resolve to get its range.
+type StructuredRefNode struct {
+	TableRef
+	*Trivia `json:"-"`
+}
+
+func (s StructuredRefNode) Type() NodeType {
+	return NodeTypeStructuredRef
+}
+
+func (s StructuredRefNode) IsEq(node Node) bool {
+	if node.Type() != NodeTypeStructuredRef {
+		return false
+	}
+	return s.TableRef.IsEq(node.(StructuredRefNode).TableRef)
+}
+
+func (s StructuredRefNode) Children() []Node {
+	return []Node{}
+}
+
+// String returns the reference the way Excel writes it,
+// e.g. with @ for #This Row and without brackets around simple column names.
+func (s StructuredRefNode) String() string {
+	return s.format(func(item TableItem) string { return string(item) }, ",")
+}
+
+// format writes the reference like String does, with the given names
+// of special items and separator between its specifiers.
+func (s StructuredRefNode) format(itemName func(TableItem) string, separator string) string {
+	r := s.TableRef
+	columns := ""
+	if r.StartColumn != "" {
+		columns = "[" + escapeColumn(r.StartColumn) + "]"
+		if r.EndColumn != "" && !strings.EqualFold(r.EndColumn, r.StartColumn) {
+			columns += ":[" + escapeColumn(r.EndColumn) + "]"
+		}
+	}
+	// A single column can go without its own brackets
+	single := r.StartColumn != "" && !strings.Contains(columns, ":") && isSimpleColumn(r.StartColumn)
+
+	var inner string
+	switch {
+	case len(r.Items) == 1 && r.Items[0] == xl.TableThisRow:
+		if single {
+			inner = "@" + escapeColumn(r.StartColumn)
+		} else {
+			inner = "@" + columns
+		}
+	case len(r.Items) == 0 && single:
+		inner = escapeColumn(r.StartColumn)
+	case len(r.Items) == 0:
+		inner = columns
+	case len(r.Items) == 1 && columns == "":
+		inner = itemName(r.Items[0])
+	default:
+		parts := make([]string, 0, len(r.Items)+1)
+		for _, item := range r.Items {
+			parts = append(parts, "["+itemName(item)+"]")
+		}
+		if columns != "" {
+			parts = append(parts, columns)
+		}
+		inner = strings.Join(parts, separator)
+	}
+	return r.Table + "[" + inner + "]"
+}
+
+// Characters that column names can only have between brackets,
+// e.g. Table1[[Unit Price]] but Table1[Price]
+const columnSpecials = " \t\r\n,:.[]#'\"{}$^&*+=-<>/"
+
+func isSimpleColumn(column string) bool {
+	return !strings.ContainsAny(column, columnSpecials)
+}
+
+// escapeColumn escapes the characters of a column name that have a meaning
+// in structured references with a ', e.g. Notes '[old'].
+func escapeColumn(column string) string {
+	var b strings.Builder
+	for _, r := range column {
+		if strings.ContainsRune("[]#'", r) {
+			b.WriteByte('\'')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func unescapeColumn(column string) string {
+	var b strings.Builder
+	for i := 0; i < len(column); i++ {
+		if column[i] == '\'' && i+1 < len(column) {
+			i++
+		}
+		b.WriteByte(column[i])
+	}
+	return b.String()
+}
+
+// isStructuredRef tells whether a reference token is a structured reference,
+// which ends with a bracket unlike references to other workbooks, e.g. [Book.xlsx]Sheet1!A1.
+func isStructuredRef(s string) bool {
+	i := strings.IndexByte(s, '[')
+	return i >= 0 && strings.HasSuffix(s, "]") && bracketLength(s[i:]) == len(s)-i
+}
+
+// ParseStructuredRef parses a structured reference like Table1[[#Headers],[Sales]:[Cost]].
+func ParseStructuredRef(s string) (TableRef, error) {
+	if !isStructuredRef(s) {
+		return TableRef{}, errors.New("not a structured reference")
+	}
+	i := strings.IndexByte(s, '[')
+	ref := TableRef{Table: s[:i]}
+	if ref.Table != "" && !IsValidName(ref.Table) {
+		return TableRef{}, errors.Errorf("invalid table name %q", ref.Table)
+	}
+	inner := strings.TrimSpace(s[i+1 : len(s)-1])
+	switch {
+	case inner == "":
+	case strings.HasPrefix(inner, "@"):
+		ref.Items = []TableItem{xl.TableThisRow}
+		rest := strings.TrimSpace(inner[1:])
+		if strings.HasPrefix(rest, "[") {
+			items, start, end, err := parseSpecifiers(rest)
+			if err != nil {
+				return TableRef{}, err
+			}
+			if len(items) > 0 {
+				return TableRef{}, errors.New("@ can't be used with other items")
+			}
+			ref.StartColumn, ref.EndColumn = start, end
+		} else {
+			ref.StartColumn = unescapeColumn(rest)
+		}
+	case strings.HasPrefix(inner, "#"):
+		item, err := xl.ParseTableItem(inner)
+		if err != nil {
+			return TableRef{}, err
+		}
+		ref.Items = []TableItem{item}
+	case strings.HasPrefix(inner, "["):
+		items, start, end, err := parseSpecifiers(inner)
+		if err != nil {
+			return TableRef{}, err
+		}
+		ref.Items, ref.StartColumn, ref.EndColumn = items, start, end
+	default:
+		ref.StartColumn = unescapeColumn(inner)
+	}
+	return ref, nil
+}
+
+// parseSpecifiers parses a list of bracketed items and columns like [#Headers],[Sales]:[Cost],
+// where the columns come last.
+func parseSpecifiers(s string) (items []TableItem, start string, end string, err error) {
+	pos := 0
+	// Reads the next bracketed specifier, without its brackets
+	next := func() (string, error) {
+		pos += len(s[pos:]) - len(strings.TrimLeft(s[pos:], " "))
+		if pos >= len(s) || s[pos] != '[' {
+			return "", errors.New("expected [")
+		}
+		length := bracketLength(s[pos:])
+		if s[pos+length-1] != ']' {
+			return "", errors.New("unclosed [")
+		}
+		spec := strings.TrimSpace(s[pos+1 : pos+length-1])
+		pos += length
+		pos += len(s[pos:]) - len(strings.TrimLeft(s[pos:], " "))
+		return spec, nil
+	}
+	for {
+		spec, err := next()
+		if err != nil {
+			return nil, "", "", err
+		}
+		if start != "" {
+			return nil, "", "", errors.New("columns must come last")
+		}
+		if strings.HasPrefix(spec, "#") {
+			item, err := xl.ParseTableItem(spec)
+			if err != nil {
+				return nil, "", "", err
+			}
+			items = append(items, item)
+		} else {
+			start = unescapeColumn(spec)
+			if pos < len(s) && s[pos] == ':' {
+				pos++
+				spec, err := next()
+				if err != nil {
+					return nil, "", "", err
+				}
+				end = unescapeColumn(spec)
+			}
+		}
+		if pos >= len(s) {
+			return items, start, end, nil
+		}
+		if s[pos] != ',' {
+			return nil, "", "", errors.Errorf("unexpected %q", s[pos])
+		}
+		pos++
+	}
+}
+
+func parseStructuredRef(stream TokenStream) (StructuredRefNode, error) {
+	next := stream.GetNext()
+	ref, err := ParseStructuredRef(next.Value)
+	if err != nil {
+		return StructuredRefNode{}, errors.Wrap(err, "failed to parse structured reference")
+	}
+	if err := stream.Consume(); err != nil {
+		return StructuredRefNode{}, errors.Wrap(err, "failed to consume structured reference token")
+	}
+	return StructuredRefNode{TableRef: ref}, nil
+}
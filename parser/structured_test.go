@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/usr-ein/excelparser/xl"
+)
+
+func TestParseStructuredRef(t *testing.T) {
+	cases := map[string]TableRef{
+		"Table1[]":                           {Table: "Table1"},
+		"Table1[Sales]":                      {Table: "Table1", StartColumn: "Sales"},
+		"[@Qty]":                             {Items: []TableItem{xl.TableThisRow}, StartColumn: "Qty"},
+		"Table1[@]":                          {Table: "Table1", Items: []TableItem{xl.TableThisRow}},
+		"Table1[#all]":                       {Table: "Table1", Items: []TableItem{xl.TableAll}},
+		"Table1[[#This Row],[Sales]]":        {Table: "Table1", Items: []TableItem{xl.TableThisRow}, StartColumn: "Sales"},
+		"Table1[@[Unit Price]]":              {Table: "Table1", Items: []TableItem{xl.TableThisRow}, StartColumn: "Unit Price"},
+		"Table1[[Sales]:[Cost]]":             {Table: "Table1", StartColumn: "Sales", EndColumn: "Cost"},
+		"Table1[[#Headers], [Sales]:[Cost]]": {Table: "Table1", Items: []TableItem{xl.TableHeaders}, StartColumn: "Sales", EndColumn: "Cost"},
+		"Table1[[#Data],[#Totals]]":          {Table: "Table1", Items: []TableItem{xl.TableData, xl.TableTotals}},
+		"Table1[Notes '[old']]":              {Table: "Table1", StartColumn: "Notes [old]"},
+	}
+	for s, want := range cases {
+		got, err := ParseStructuredRef(s)
+		if err != nil {
+			t.Errorf("ParseStructuredRef(%s) failed with %s", s, err)
+			continue
+		}
+		if !got.IsEq(want) {
+			t.Errorf("ParseStructuredRef(%s) = %+v; want %+v", s, got, want)
+		}
+	}
+
+	bad := []string{"Table1", "Table1[#Nope]", "Table1[[Sales],[#Data]]", "Table1[@[#Data]]", "A1[Sales]", "Table1[[Sales]"}
+	for _, s := range bad {
+		if _, err := ParseStructuredRef(s); err == nil {
+			t.Errorf("ParseStructuredRef(%s) should have failed", s)
+		}
+	}
+}
+
+func TestStringifyStructuredRef(t *testing.T) {
+	cases := map[Formula]Formula{
+		"=SUM(Table1[Sales])":                        "=SUM(Table1[Sales])",
+		"=[@Qty]*[@Price]":                           "=[@Qty]*[@Price]",
+		"=Table1[@[Unit Price]]+1":                   "=Table1[@[Unit Price]]+1",
+		"=COUNTA(Table1[[#Headers],[Sales]:[Cost]])": "=COUNTA(Table1[[#Headers],[Sales]:[Cost]])",
+		"=Table1[[#This Row],[Sales]]":               "=Table1[@Sales]",
+		"=ROWS(Table1[#All])":                        "=ROWS(Table1[#All])",
+		"=Table1[[Sales]]":                           "=Table1[Sales]",
+		"=Table1['#Items]":                           "=Table1[['#Items]]",
+		`=IF([@Qty]>0, "a,[b", "")`:                  `=IF([@Qty]>0, "a,[b", "")`,
+	}
+	for f, want := range cases {
+		node, err := Parse(string(f), "Sheet1")
+		if err != nil {
+			t.Errorf("could not parse %s: %v", f, err)
+			continue
+		}
+		if got := StringifyNode(node, "Sheet1"); got != want {
+			t.Errorf("StringifyNode(%s) = %s; want %s", f, got, want)
+		}
+	}
+}
@@ -1,20 +1,469 @@
 package parser
 
-import "github.com/xuri/efp"
+import (
+	"strings"
 
-// Tokenizes a formula string into a slice of tokens,
-// for later parsing into a tree.
+	"github.com/usr-ein/excelparser/xl"
+)
+
+// Tokenize splits a formula into tokens, for later parsing into a tree.
+// The = at the start of the formula is optional.
+//
+// Tokens cover the whole formula but its leading =, whitespace included, and their
+// Offset and Length point at their text in the formula. Their Value is what they
+// stand for: the content of texts without their quotes, references without the
+// quotes around their sheets, e.g. My sheet!A1 for 'My sheet'!A1, the names of
+// functions without their (. Spaces between two operands are the intersection
+// operator, whose value is a single space, see PrecedenceMap.
 func Tokenize(formula string) []Token {
-	parser := efp.ExcelParser()
-	rawTokens := parser.Parse(formula)
+	return TokenizeDialect(formula, EnUS)
+}
+
+// TokenizeDialect is like Tokenize, for a formula written in the given dialect.
+// Values are the same as in en-US, e.g. SUM for the function SOMME( in FrFR,
+// 1.5 for the number 1,5, or , for the argument separator ;.
+func TokenizeDialect(formula string, dialect *Dialect) []Token {
+	dialect.init()
+	t := tokenizer{
+		formula: formula,
+		dialect: dialect,
+		tokens:  make([]Token, 0, len(formula)/3+1),
+	}
+	if strings.HasPrefix(formula, "=") {
+		t.pos = 1
+	}
+	for t.pos < len(formula) {
+		t.scan()
+	}
+	return t.tokens
+}
+
+type tokenizer struct {
+	formula string
+	dialect *Dialect
+	pos     int
+	tokens  []Token
+	// Types of the tokens opening the functions, subexpressions and arrays around pos
+	open []TokenType
+}
+
+// scan adds the token starting at pos.
+func (t *tokenizer) scan() {
+	ch := t.formula[t.pos]
+	switch {
+	case isSpace(ch):
+		end := t.pos + 1
+		for end < len(t.formula) && isSpace(t.formula[end]) {
+			end++
+		}
+		t.emit(TokenTypeWhitespace, TokenSubtypeNone, t.formula[t.pos:end], end-t.pos)
+	case ch == '"':
+		t.scanText()
+	case ch == '#':
+		t.scanError()
+	case ch == '(':
+		// Parentheses right after a call or a parenthesized expression hold
+		// the arguments of a lambda call, e.g. =LAMBDA(a, b, a+b)(1, 2)
+		if n := len(t.tokens); n > 0 && isClosing(t.tokens[n-1]) {
+			t.push(TokenTypeFunction, "", 1)
+		} else {
+			t.push(TokenTypeSubexpression, "", 1)
+		}
+	case ch == ')':
+		t.pop(TokenTypeSubexpression, ")")
+	case ch == '{':
+		t.push(TokenTypeArray, "{", 1)
+	case ch == '}':
+		t.pop(TokenTypeArray, "}")
+	case ch == t.dialect.ArrayRowSeparator && t.top() == TokenTypeArray:
+		t.emit(TokenTypeArrayRow, TokenSubtypeNone, ";", 1)
+	case ch == t.dialect.ArrayColumnSeparator && t.top() == TokenTypeArray:
+		t.emit(TokenTypeArgument, TokenSubtypeNone, ",", 1)
+	case ch == t.dialect.ArgumentSeparator:
+		if t.top() == TokenTypeFunction {
+			t.emit(TokenTypeArgument, TokenSubtypeNone, ",", 1)
+		} else {
+			t.emit(TokenTypeOperatorInfix, TokenSubtypeUnion, ",", 1)
+		}
+	case ch == '%':
+		t.emit(TokenTypeOperatorPostfix, TokenSubtypeNone, "%", 1)
+	case ch == '@':
+		t.emit(TokenTypeOperatorPrefix, TokenSubtypeNone, "@", 1)
+	case isOperatorChar(ch):
+		t.scanOperator()
+	case t.isDelimiter(ch):
+		// The separator of array rows outside of arrays
+		t.emit(TokenTypeUnknown, TokenSubtypeNone, t.formula[t.pos:t.pos+1], 1)
+	default:
+		t.scanOperand()
+	}
+}
+
+// emit adds a token of the given length at pos, and moves past it.
+func (t *tokenizer) emit(ttype TokenType, subtype TokenSubtype, value string, length int) {
+	token := Token{Type: ttype, Subtype: subtype, Value: value, Offset: t.pos, Length: length}
+	// Whitespace between two operands is the intersection operator, e.g. A1:B2 B1:C2
+	if n := len(t.tokens); n >= 2 && t.tokens[n-1].Type == TokenTypeWhitespace && endsOperand(t.tokens[n-2]) && startsOperand(token) {
+		space := &t.tokens[n-1]
+		space.Type, space.Subtype, space.Value = TokenTypeOperatorInfix, TokenSubtypeIntersection, " "
+	}
+	t.tokens = append(t.tokens, token)
+	t.pos += length
+}
+
+func (t *tokenizer) top() TokenType {
+	if len(t.open) == 0 {
+		return TokenTypeEnd
+	}
+	return t.open[len(t.open)-1]
+}
+
+// push opens a function, a subexpression or an array.
+func (t *tokenizer) push(ttype TokenType, value string, length int) {
+	t.open = append(t.open, ttype)
+	t.emit(ttype, TokenSubtypeStart, value, length)
+}
+
+// pop closes what the ) or } at pos closes. Unbalanced ones are left
+// to the parser to complain about, as the end of a subexpression or an array.
+func (t *tokenizer) pop(ttype TokenType, value string) {
+	top := t.top()
+	if top == ttype || ttype == TokenTypeSubexpression && top == TokenTypeFunction {
+		ttype = top
+		t.open = t.open[:len(t.open)-1]
+	}
+	t.emit(ttype, TokenSubtypeStop, value, 1)
+}
+
+func (t *tokenizer) scanText() {
+	length, closed := quotedLength(t.formula[t.pos:], '"')
+	if !closed {
+		t.emit(TokenTypeUnknown, TokenSubtypeNone, t.formula[t.pos:], length)
+		return
+	}
+	value := t.formula[t.pos+1 : t.pos+length]
+	if strings.HasSuffix(value, `"`) {
+		value = value[:len(value)-1]
+	}
+	if strings.Contains(value, `""`) {
+		value = strings.ReplaceAll(value, `""`, `"`)
+	}
+	t.emit(TokenTypeOperand, TokenSubtypeText, value, length)
+}
+
+// scanError adds the error literal at pos, e.g. #N/A, or an unknown token
+// for what follows the # if it isn't one.
+func (t *tokenizer) scanError() {
+	rest := t.formula[t.pos:]
+	length := 0
+	var value ErrorCode
+	for _, code := range xl.ErrorCodes {
+		literal := t.dialect.errorLiteral(code)
+		if len(literal) > length && len(rest) >= len(literal) && strings.EqualFold(rest[:len(literal)], literal) {
+			value, length = code, len(literal)
+		}
+	}
+	if length > 0 {
+		t.emit(TokenTypeOperand, TokenSubtypeError, string(value), length)
+		return
+	}
+	length = 1
+	for length < len(rest) && !t.isDelimiter(rest[length]) {
+		length++
+	}
+	t.emit(TokenTypeUnknown, TokenSubtypeNone, rest[:length], length)
+}
+
+func (t *tokenizer) scanOperator() {
+	if op := t.formula[t.pos:min(t.pos+2, len(t.formula))]; op == "<>" || op == "<=" || op == ">=" {
+		t.emit(TokenTypeOperatorInfix, TokenSubtypeComparison, op, 2)
+		return
+	}
+	op := t.formula[t.pos : t.pos+1]
+	switch op {
+	case "+", "-":
+		n := len(t.tokens) - 1
+		for n >= 0 && t.tokens[n].Type == TokenTypeWhitespace {
+			n--
+		}
+		switch {
+		case n >= 0 && (endsOperand(t.tokens[n]) || t.tokens[n].Type == TokenTypeOperatorPostfix):
+			t.emit(TokenTypeOperatorInfix, TokenSubtypeMath, op, 1)
+		case op == "-":
+			t.emit(TokenTypeOperatorPrefix, TokenSubtypeNone, op, 1)
+		default:
+			t.emit(TokenTypeNoop, TokenSubtypeNone, op, 1)
+		}
+	case "&":
+		t.emit(TokenTypeOperatorInfix, TokenSubtypeConcatenation, op, 1)
+	case "=", "<", ">":
+		t.emit(TokenTypeOperatorInfix, TokenSubtypeComparison, op, 1)
+	default:
+		t.emit(TokenTypeOperatorInfix, TokenSubtypeMath, op, 1)
+	}
+}
+
+// scanOperand adds the number, logical or reference at pos, e.g. 1.5E+3, TRUE,
+// 'My sheet'!A1:B2, Table1[[#Headers],[Sales]] or A1#, or the start of a
+// function call if it is followed by a (.
+func (t *tokenizer) scanOperand() {
+	start, end := t.pos, t.pos
+	quoted := false
+	// Last colon outside of quotes and brackets
+	colon := -1
+loop:
+	for end < len(t.formula) {
+		ch := t.formula[end]
+		switch {
+		case ch == '\'':
+			length, closed := quotedLength(t.formula[end:], '\'')
+			if !closed {
+				t.emit(TokenTypeUnknown, TokenSubtypeNone, t.formula[start:], len(t.formula)-start)
+				return
+			}
+			quoted = true
+			end += length
+		case ch == '[':
+			end += bracketLength(t.formula[end:])
+		case ch == '#':
+			// The spill operator ends the reference, anything else is an error literal
+			if end > start && isSpillOperator(t.formula, end, rune(t.formula[end-1])) {
+				end++
+			}
+			break loop
+		case (ch == '+' || ch == '-') && isExponentPrefix(t.formula[start:end], t.dialect.DecimalSeparator):
+			end++
+		case ch == t.dialect.ArrayColumnSeparator && t.top() == TokenTypeArray:
+			break loop
+		case t.isDelimiter(ch):
+			break loop
+		default:
+			if ch == ':' {
+				colon = end
+			}
+			end++
+		}
+	}
+	raw := t.formula[start:end]
+	if end < len(t.formula) && t.formula[end] == '(' {
+		// Function names don't have colons: the colon is the range operator
+		// between the operand before it and the function, e.g. A1:INDEX(B:B, 2)
+		if colon > start && colon < end-1 {
+			t.emitOperand(t.formula[start:colon], quoted)
+			t.emit(TokenTypeOperatorInfix, TokenSubtypeRange, ":", 1)
+			raw = t.formula[colon+1 : end]
+		}
+		t.push(TokenTypeFunction, t.dialect.englishFunctionName(raw), len(raw)+1)
+		return
+	}
+	t.emitOperand(raw, quoted)
+}
+
+// emitOperand adds the number, logical or reference raw at pos, quoted if it has
+// quoted sheets, see scanOperand.
+func (t *tokenizer) emitOperand(raw string, quoted bool) {
+	d := t.dialect
+	switch {
+	case isNumberLiteral(raw, d.DecimalSeparator):
+		t.emit(TokenTypeOperand, TokenSubtypeNumber, strings.Replace(raw, string(d.DecimalSeparator), ".", 1), len(raw))
+	case strings.EqualFold(raw, d.True):
+		t.emit(TokenTypeOperand, TokenSubtypeLogical, "TRUE", len(raw))
+	case strings.EqualFold(raw, d.False):
+		t.emit(TokenTypeOperand, TokenSubtypeLogical, "FALSE", len(raw))
+	default:
+		value := raw
+		if quoted {
+			value = unquoteSheets(raw)
+		}
+		if isStructuredRef(value) {
+			value = d.englishStructuredRef(value)
+		}
+		t.emit(TokenTypeOperand, referenceSubtype(value), value, len(raw))
+	}
+}
+
+// referenceSubtype tells what kind of reference value is, looking at it like the parser does:
+// it is the first of a spill reference, a structured reference, an external
+// reference, a 3D reference, a name, a range or a cell it can be.
+func referenceSubtype(value string) TokenSubtype {
+	switch {
+	case isSpillRef(value):
+		return TokenSubtypeSpillRef
+	case isStructuredRef(value):
+		return TokenSubtypeStructuredRef
+	}
+	if _, _, _, _, ok := splitExternalRef(value); ok {
+		return TokenSubtypeExternalRef
+	}
+	if _, _, _, ok := split3DRef(value); ok {
+		return TokenSubtypeRef3D
+	}
+	if _, _, ok := splitName(value); ok {
+		return TokenSubtypeName
+	}
+	if strings.Contains(value, ":") {
+		return TokenSubtypeRange
+	}
+	return TokenSubtypeCell
+}
+
+// unquoteSheets drops the quotes around the sheets of a reference, e.g. 'My sheet'!A1
+// or 'C:\[Book 1.xlsx]Jan'!A1, unescaping the quotes doubled within them.
+func unquoteSheets(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '\'':
+			length, _ := quotedLength(s[i:], '\'')
+			inner := strings.TrimSuffix(s[i+1:i+length], "'")
+			b.WriteString(strings.ReplaceAll(inner, "''", "'"))
+			i += length
+		case '[':
+			length := bracketLength(s[i:])
+			b.WriteString(s[i : i+length])
+			i += length
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String()
+}
+
+// endsOperand tells whether the token ends an operand, after which
+// + and - are binary operators, and whitespace an intersection.
+func endsOperand(token Token) bool {
+	return token.Type == TokenTypeOperand || token.Subtype == TokenSubtypeStop &&
+		(token.Type == TokenTypeFunction || token.Type == TokenTypeSubexpression || token.Type == TokenTypeArray)
+}
+
+// startsOperand tells whether the token starts an operand.
+func startsOperand(token Token) bool {
+	return token.Type == TokenTypeOperand || token.Subtype == TokenSubtypeStart ||
+		token.Type == TokenTypeOperatorPrefix && token.Value == "@"
+}
+
+// isClosing tells whether the token ends a function call or a parenthesized expression.
+func isClosing(token Token) bool {
+	return (token.Type == TokenTypeFunction || token.Type == TokenTypeSubexpression) && token.Subtype == TokenSubtypeStop
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n'
+}
+
+func isOperatorChar(ch byte) bool {
+	return strings.IndexByte("+-*/^&=<>", ch) >= 0
+}
+
+// isDelimiter tells whether ch ends an operand.
+func (t *tokenizer) isDelimiter(ch byte) bool {
+	return t.dialect.delimiters[ch]
+}
+
+// isNumberLiteral tells whether s is a number as written in formulas, e.g. 12, .5 or 1.5E-3,
+// with the given decimal separator.
+func isNumberLiteral(s string, decimal byte) bool {
+	i, digits := 0, 0
+	for i < len(s) && isDigit(s[i]) {
+		i, digits = i+1, digits+1
+	}
+	if i < len(s) && s[i] == decimal {
+		i++
+		for i < len(s) && isDigit(s[i]) {
+			i, digits = i+1, digits+1
+		}
+	}
+	if digits == 0 {
+		return false
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		if i == len(s) {
+			return false
+		}
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+	}
+	return i == len(s)
+}
+
+// isExponentPrefix tells whether s is a number up to the E of its exponent, e.g. 1.5E,
+// in which case a + or - after it is the sign of the exponent.
+func isExponentPrefix(s string, decimal byte) bool {
+	n := len(s)
+	return n > 1 && (s[n-1] == 'e' || s[n-1] == 'E') && isNumberLiteral(s[:n-1], decimal)
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+// isSpillOperator tells whether the # at i in formula follows a reference, e.g. A1#,
+// rather than starting an error like #REF!, prev being the character before it.
+func isSpillOperator(formula string, i int, prev rune) bool {
+	if !(prev >= 'A' && prev <= 'Z' || prev >= 'a' && prev <= 'z' || prev >= '0' && prev <= '9' || prev == '$') {
+		return false
+	}
+	for _, code := range xl.ErrorCodes {
+		if len(formula)-i >= len(code) && strings.EqualFold(formula[i:i+len(code)], string(code)) {
+			return false
+		}
+	}
+	return true
+}
+
+// quotedLength returns the length of the quoted string at the start of s,
+// where quotes are escaped by doubling them, and whether it is closed:
+// if it isn't, it goes to the end of s.
+func quotedLength(s string, quote byte) (int, bool) {
+	if len(s) == 0 || s[0] != quote {
+		return 0, false
+	}
+	for i := 1; i < len(s); i++ {
+		if s[i] != quote {
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1, true
+	}
+	return len(s), false
+}
+
+// isUnterminatedLiteral tells whether a token is a text or a reference with a quoted sheet
+// that isn't closed, which the tokenizer leaves as an unknown token going to the end of the formula.
+// Other unknown tokens are error literals, starting with #, or a single delimiter.
+func isUnterminatedLiteral(token Token) bool {
+	if token.Type != TokenTypeUnknown || token.Value == "" {
+		return false
+	}
+	return token.Value[0] == '"' || token.Value[0] != '#' && strings.ContainsRune(token.Value, '\'')
+}
 
-	tokens := make([]Token, len(rawTokens))
-	for i, rawToken := range rawTokens {
-		tokens[i] = Token{
-			Type:    rawToken.TType,
-			Subtype: rawToken.TSubType,
-			Value:   rawToken.TValue,
+// bracketLength returns the length of the bracketed part at the start of s,
+// e.g. [Book.xlsx] or [[#Headers],[Sales]], where ' escapes the next character.
+func bracketLength(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
 		}
 	}
-	return tokens
+	return len(s)
 }
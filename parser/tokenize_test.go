@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTokenizeKinds(t *testing.T) {
+	testCases := []struct {
+		formula  string
+		expected []string
+	}{
+		{`=1.5E+3-'My ''s'!A1:B2%`, []string{
+			"Operand Number 1.5E+3", "OperatorInfix Math -", "Operand Range My 's!A1:B2", "OperatorPostfix  %",
+		}},
+		{`=+ -A1 & "a""b"`, []string{
+			"Noop  +", "Whitespace   ", "OperatorPrefix  -", "Operand Cell A1", "Whitespace   ", "OperatorInfix Concatenation &",
+			"Whitespace   ", "Operand Text a\"b",
+		}},
+		{`=SUM(A1:B2 B1, (C1,C2))<>#N/A`, []string{
+			"Function Start SUM", "Operand Range A1:B2", "OperatorInfix Intersection  ", "Operand Cell B1", "Argument  ,",
+			"Whitespace   ", "Subexpression Start ", "Operand Cell C1", "OperatorInfix Union ,", "Operand Cell C2",
+			"Subexpression Stop )", "Function Stop )", "OperatorInfix Comparison <>", "Operand Error #N/A",
+		}},
+		{`{1,-2;TRUE,#div/0!}`, []string{
+			"Array Start {", "Operand Number 1", "Argument  ,", "OperatorPrefix  -", "Operand Number 2", "ArrayRow  ;",
+			"Operand Logical TRUE", "Argument  ,", "Operand Error #DIV/0!", "Array Stop }",
+		}},
+		{`=Sales[[#Headers],[Qty]]+A1#+@Revenue+Jan:Dec!B5+[Book2.xlsx]Sheet1!A1`, []string{
+			"Operand StructuredRef Sales[[#Headers],[Qty]]", "OperatorInfix Math +", "Operand SpillRef A1#",
+			"OperatorInfix Math +", "OperatorPrefix  @", "Operand Name Revenue", "OperatorInfix Math +",
+			"Operand Ref3D Jan:Dec!B5", "OperatorInfix Math +", "Operand ExternalRef [Book2.xlsx]Sheet1!A1",
+		}},
+		{`=LAMBDA(x, x)(1)#FOO`, []string{
+			"Function Start LAMBDA", "Operand Name x", "Argument  ,", "Whitespace   ", "Operand Name x", "Function Stop )",
+			"Function Start ", "Operand Number 1", "Function Stop )", "Unknown  #FOO",
+		}},
+		{`=A1:INDEX(B:B,2)+'My sheet'!C1:D1:INDEX(E:E,2)`, []string{
+			"Operand Cell A1", "OperatorInfix Range :", "Function Start INDEX", "Operand Range B:B", "Argument  ,",
+			"Operand Number 2", "Function Stop )", "OperatorInfix Math +", "Operand Range My sheet!C1:D1", "OperatorInfix Range :",
+			"Function Start INDEX", "Operand Range E:E", "Argument  ,", "Operand Number 2", "Function Stop )",
+		}},
+	}
+	for _, tc := range testCases {
+		tokens := Tokenize(tc.formula)
+		got := make([]string, len(tokens))
+		for i, token := range tokens {
+			got[i] = fmt.Sprintf("%s %s %s", token.Type, token.Subtype, token.Value)
+		}
+		if strings.Join(got, "\n") != strings.Join(tc.expected, "\n") {
+			t.Errorf("Tokenize(%s) = %q; want %q", tc.formula, got, tc.expected)
+		}
+	}
+}
+
+func TestTokenizeCoversFormula(t *testing.T) {
+	for _, formula := range tokenizeCorpus {
+		pos := strings.Index(formula, "=") + 1
+		for _, token := range Tokenize(formula) {
+			if token.Offset != pos || token.Length <= 0 {
+				t.Errorf("Tokenize(%s) has token %q at %d+%d; want it at %d", formula, token.Value, token.Offset, token.Length, pos)
+				break
+			}
+			pos += token.Length
+		}
+		if pos != len(formula) {
+			t.Errorf("Tokenize(%s) stops at %d; want %d", formula, pos, len(formula))
+		}
+	}
+}
+
+// Formulas like the ones found in workbooks
+var tokenizeCorpus = []string{
+	`=A1+5`,
+	`=(SUM(A1:B1, A2:B2)+A5+3232-A15)/B90/321.0+MONTH("January")`,
+	`=IF(AND($B$2>0,C3<>""),VLOOKUP(C3,'Price list'!$A$2:$D$500,4,FALSE),"n/a")`,
+	`=SUMIFS(Sales[Amount],Sales[Region],$A2,Sales[[#This Row],[Year]],B$1)`,
+	`=IFERROR(INDEX(Data!$B:$B,MATCH(1,(Data!$A:$A=E5)*(Data!$C:$C>=F5),0)),#N/A)`,
+	`=SUM(Jan:Dec!B5)/COUNT([Budget.xlsx]Summary!$C$3:$C$14)*1.5E-2`,
+	`=LET(x, A1*2, f, LAMBDA(v, v+x), f(3))`,
+	`=SORT(FILTER(A2:C100, B2:B100 > 10), 2, -1) & " " & TEXT(TODAY(), "yyyy-mm-dd")`,
+	`={1,2,3;4,5,6}*@A1:A3+D1#`,
+	`=ROUND(SUMPRODUCT((MONTH(Orders[Date])=3)*Orders[Qty]*Orders[Price]),2)%`,
+}
+
+func BenchmarkTokenize(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for _, formula := range tokenizeCorpus {
+			Tokenize(formula)
+		}
+	}
+}
@@ -2,24 +2,180 @@ package parser
 
 import (
 	"errors"
-	"strings"
 )
 
 // https://github.com/psalaets/excel-formula-ast/blob/master/lib/token-stream.js
 
+// TokenType is the kind of a token of a formula, see Tokenize.
+type TokenType uint8
+
+const (
+	// The end of the formula, only found past the last token of a TokenStream
+	TokenTypeEnd TokenType = iota
+	// A value or a reference, told apart by the subtype
+	TokenTypeOperand
+	// The start of a function call like SUM(, or of the arguments of a lambda call,
+	// and the ) ending it
+	TokenTypeFunction
+	// A parenthesis around a subexpression like (A1+1)
+	TokenTypeSubexpression
+	// A brace around an array constant like {1,2;3,4}
+	TokenTypeArray
+	// The comma between the arguments of a function, or the values of an array row
+	TokenTypeArgument
+	// The semicolon between the rows of an array constant
+	TokenTypeArrayRow
+	TokenTypeOperatorPrefix
+	TokenTypeOperatorInfix
+	TokenTypeOperatorPostfix
+	// Spaces and line breaks that aren't the intersection operator
+	TokenTypeWhitespace
+	// The unary + of =+A1, which doesn't do anything
+	TokenTypeNoop
+	// Text that can't be made sense of, e.g. the #FOO of =#FOO
+	TokenTypeUnknown
+)
+
+func (t TokenType) String() string {
+	switch t {
+	case TokenTypeEnd:
+		return "End"
+	case TokenTypeOperand:
+		return "Operand"
+	case TokenTypeFunction:
+		return "Function"
+	case TokenTypeSubexpression:
+		return "Subexpression"
+	case TokenTypeArray:
+		return "Array"
+	case TokenTypeArgument:
+		return "Argument"
+	case TokenTypeArrayRow:
+		return "ArrayRow"
+	case TokenTypeOperatorPrefix:
+		return "OperatorPrefix"
+	case TokenTypeOperatorInfix:
+		return "OperatorInfix"
+	case TokenTypeOperatorPostfix:
+		return "OperatorPostfix"
+	case TokenTypeWhitespace:
+		return "Whitespace"
+	case TokenTypeNoop:
+		return "Noop"
+	case TokenTypeUnknown:
+		return "Unknown"
+	default:
+		return "Invalid"
+	}
+}
+
+// TokenSubtype refines the type of a token, see Tokenize.
+type TokenSubtype uint8
+
+const (
+	TokenSubtypeNone TokenSubtype = iota
+	// Opening and closing tokens of functions, subexpressions and arrays
+	TokenSubtypeStart
+	TokenSubtypeStop
+	// Operands
+	TokenSubtypeText
+	TokenSubtypeNumber
+	TokenSubtypeLogical
+	TokenSubtypeError
+	TokenSubtypeCell
+	TokenSubtypeRange
+	TokenSubtypeName
+	TokenSubtypeStructuredRef
+	TokenSubtypeRef3D
+	TokenSubtypeExternalRef
+	TokenSubtypeSpillRef
+	// Infix operators
+	TokenSubtypeMath
+	TokenSubtypeConcatenation
+	TokenSubtypeComparison
+	TokenSubtypeIntersection
+	TokenSubtypeUnion
+)
+
+func (s TokenSubtype) String() string {
+	switch s {
+	case TokenSubtypeNone:
+		return ""
+	case TokenSubtypeStart:
+		return "Start"
+	case TokenSubtypeStop:
+		return "Stop"
+	case TokenSubtypeText:
+		return "Text"
+	case TokenSubtypeNumber:
+		return "Number"
+	case TokenSubtypeLogical:
+		return "Logical"
+	case TokenSubtypeError:
+		return "Error"
+	case TokenSubtypeCell:
+		return "Cell"
+	case TokenSubtypeRange:
+		return "Range"
+	case TokenSubtypeName:
+		return "Name"
+	case TokenSubtypeStructuredRef:
+		return "StructuredRef"
+	case TokenSubtypeRef3D:
+		return "Ref3D"
+	case TokenSubtypeExternalRef:
+		return "ExternalRef"
+	case TokenSubtypeSpillRef:
+		return "SpillRef"
+	case TokenSubtypeMath:
+		return "Math"
+	case TokenSubtypeConcatenation:
+		return "Concatenation"
+	case TokenSubtypeComparison:
+		return "Comparison"
+	case TokenSubtypeIntersection:
+		return "Intersection"
+	case TokenSubtypeUnion:
+		return "Union"
+	default:
+		return "Invalid"
+	}
+}
+
 type Token struct {
-	Type    string
-	Subtype string
-	Value   string
+	Type    TokenType
+	Subtype TokenSubtype
+	// Value of the token, e.g. the unescaped content of a text without its quotes,
+	// or the name of a function without its (
+	Value string
+	// Byte offset and length of the token in the formula, see Tokenize
+	Offset int
+	Length int
+}
+
+// isTrivia tells whether the token doesn't matter to the tree of the formula.
+func (t Token) isTrivia() bool {
+	return t.Type == TokenTypeWhitespace || t.Type == TokenTypeNoop
+}
+
+// end returns the byte offset of the end of the token in the formula.
+func (t Token) end() int {
+	return t.Offset + t.Length
 }
 
 type TokenStream interface {
 	Consume() error
 	GetNext() Token
-	NextIs(ttype string, tsubtype string) bool
+	GetPrevious() Token
+	NextIs(ttype TokenType, tsubtype TokenSubtype) bool
 	NextIsOpenParen() bool
+	NextIsCloseParen() bool
 	NextIsTerminal() bool
 	NextIsFunctionCall() bool
+	NextIsCall() bool
+	NextIsArray() bool
+	NextIsArrayRowSeparator() bool
+	NextIsEndOfArray() bool
 	NextIsFunctionArgumentSeparator() bool
 	NextIsEndOfFunctionCall() bool
 	NextIsBinaryOperator() bool
@@ -27,12 +183,21 @@ type TokenStream interface {
 	NextIsPostfixOperator() bool
 	NextIsRange() bool
 	NextIsCell() bool
+	NextIsName() bool
+	NextIsStructuredRef() bool
+	NextIsRef3D() bool
+	NextIsExternalRef() bool
+	NextIsSpillRef() bool
 	NextIsNumber() bool
 	NextIsText() bool
 	NextIsLogical() bool
+	NextIsError() bool
+	NextIsEnd() bool
 	Position() int
 }
 
+// TokenStreamImpl goes through the tokens of a formula, skipping whitespace
+// and no-op tokens. Positions are indexes in the tokens it was made from.
 type TokenStreamImpl struct {
 	tokens   []Token
 	position int
@@ -42,10 +207,12 @@ func NewTokenStream(tokens []Token) TokenStream {
 	tokensArr := make([]Token, len(tokens)+1)
 	copy(tokensArr, tokens)
 	tokensArr[len(tokens)] = Token{}
-	return &TokenStreamImpl{
+	ts := &TokenStreamImpl{
 		tokens:   tokensArr,
 		position: 0,
 	}
+	ts.skipTrivia()
+	return ts
 }
 
 func (ts *TokenStreamImpl) Consume() error {
@@ -53,73 +220,149 @@ func (ts *TokenStreamImpl) Consume() error {
 	if ts.position >= len(ts.tokens) {
 		return errors.New("invalid syntax")
 	}
+	ts.skipTrivia()
 	return nil
 }
 
+func (ts *TokenStreamImpl) skipTrivia() {
+	for ts.position < len(ts.tokens)-1 && ts.tokens[ts.position].isTrivia() {
+		ts.position++
+	}
+}
+
 func (ts *TokenStreamImpl) GetNext() Token {
 	return ts.tokens[ts.position]
 }
 
-func (ts *TokenStreamImpl) NextIs(ttype string, tsubtype string) bool {
+// GetPrevious returns the last token consumed, skipping whitespace and no-op tokens,
+// or the end token if none was.
+func (ts *TokenStreamImpl) GetPrevious() Token {
+	for i := ts.position - 1; i >= 0; i-- {
+		if !ts.tokens[i].isTrivia() {
+			return ts.tokens[i]
+		}
+	}
+	return Token{}
+}
+
+// NextIs tells whether the next token has the given type and subtype,
+// any subtype matching TokenSubtypeNone.
+func (ts *TokenStreamImpl) NextIs(ttype TokenType, tsubtype TokenSubtype) bool {
 	if ts.GetNext().Type != ttype {
 		return false
 	}
-	if tsubtype != "" && ts.GetNext().Subtype != tsubtype {
+	if tsubtype != TokenSubtypeNone && ts.GetNext().Subtype != tsubtype {
 		return false
 	}
 	return true
 }
 
 func (ts *TokenStreamImpl) NextIsOpenParen() bool {
-	return ts.NextIs("Subexpression", "Start")
+	return ts.NextIs(TokenTypeSubexpression, TokenSubtypeStart)
+}
+
+func (ts *TokenStreamImpl) NextIsCloseParen() bool {
+	return ts.NextIs(TokenTypeSubexpression, TokenSubtypeStop)
 }
 
 func (ts *TokenStreamImpl) NextIsTerminal() bool {
-	return ts.NextIsNumber() || ts.NextIsText() || ts.NextIsRange() || ts.NextIsCell() || ts.NextIsLogical()
+	return ts.NextIs(TokenTypeOperand, TokenSubtypeNone)
 }
 
 func (ts *TokenStreamImpl) NextIsFunctionCall() bool {
-	return ts.NextIs("Function", "Start")
+	return ts.NextIs(TokenTypeFunction, TokenSubtypeStart) && !ts.NextIsCall()
+}
+
+// NextIsCall returns true at the start of the arguments of a lambda call,
+// e.g. (1, 2) in LAMBDA(a, b, a+b)(1, 2), which Tokenize turns into a function without a name.
+func (ts *TokenStreamImpl) NextIsCall() bool {
+	return ts.NextIs(TokenTypeFunction, TokenSubtypeStart) && ts.GetNext().Value == ""
+}
+
+func (ts *TokenStreamImpl) NextIsArray() bool {
+	return ts.NextIs(TokenTypeArray, TokenSubtypeStart)
+}
+
+func (ts *TokenStreamImpl) NextIsArrayRowSeparator() bool {
+	return ts.NextIs(TokenTypeArrayRow, TokenSubtypeNone)
+}
+
+func (ts *TokenStreamImpl) NextIsEndOfArray() bool {
+	return ts.NextIs(TokenTypeArray, TokenSubtypeStop)
 }
 
 func (ts *TokenStreamImpl) NextIsFunctionArgumentSeparator() bool {
-	return ts.NextIs("Argument", "")
+	return ts.NextIs(TokenTypeArgument, TokenSubtypeNone)
 }
 
 func (ts *TokenStreamImpl) NextIsEndOfFunctionCall() bool {
-	return ts.NextIs("Function", "Stop")
+	return ts.NextIs(TokenTypeFunction, TokenSubtypeStop)
 }
 
 func (ts *TokenStreamImpl) NextIsBinaryOperator() bool {
-	return ts.NextIs("OperatorInfix", "")
+	return ts.NextIs(TokenTypeOperatorInfix, TokenSubtypeNone)
 }
 
 func (ts *TokenStreamImpl) NextIsPrefixOperator() bool {
-	return ts.NextIs("OperatorPrefix", "")
+	return ts.NextIs(TokenTypeOperatorPrefix, TokenSubtypeNone)
 }
 
 func (ts *TokenStreamImpl) NextIsPostfixOperator() bool {
-	return ts.NextIs("OperatorPostfix", "")
+	return ts.NextIs(TokenTypeOperatorPostfix, TokenSubtypeNone)
 }
 
 func (ts *TokenStreamImpl) NextIsRange() bool {
-	return ts.NextIs("Operand", "Range") && strings.Contains(ts.GetNext().Value, ":")
+	return ts.NextIs(TokenTypeOperand, TokenSubtypeRange)
 }
 
 func (ts *TokenStreamImpl) NextIsCell() bool {
-	return ts.NextIs("Operand", "Range") && !strings.Contains(ts.GetNext().Value, ":")
+	return ts.NextIs(TokenTypeOperand, TokenSubtypeCell)
+}
+
+// NextIsName returns true for a defined name, e.g. Revenue or Sheet1!Revenue.
+func (ts *TokenStreamImpl) NextIsName() bool {
+	return ts.NextIs(TokenTypeOperand, TokenSubtypeName)
+}
+
+// NextIsStructuredRef returns true for a structured reference, e.g. Table1[Sales].
+func (ts *TokenStreamImpl) NextIsStructuredRef() bool {
+	return ts.NextIs(TokenTypeOperand, TokenSubtypeStructuredRef)
+}
+
+// NextIsRef3D returns true for a reference to a span of sheets, e.g. Jan:Dec!B5.
+func (ts *TokenStreamImpl) NextIsRef3D() bool {
+	return ts.NextIs(TokenTypeOperand, TokenSubtypeRef3D)
+}
+
+// NextIsExternalRef returns true for a reference to another workbook, e.g. [Book2.xlsx]Sheet1!A1.
+func (ts *TokenStreamImpl) NextIsExternalRef() bool {
+	return ts.NextIs(TokenTypeOperand, TokenSubtypeExternalRef)
+}
+
+// NextIsSpillRef returns true for a reference to the spill range of a formula, e.g. A1#.
+func (ts *TokenStreamImpl) NextIsSpillRef() bool {
+	return ts.NextIs(TokenTypeOperand, TokenSubtypeSpillRef)
 }
 
 func (ts *TokenStreamImpl) NextIsNumber() bool {
-	return ts.NextIs("Operand", "Number")
+	return ts.NextIs(TokenTypeOperand, TokenSubtypeNumber)
 }
 
 func (ts *TokenStreamImpl) NextIsText() bool {
-	return ts.NextIs("Operand", "Text")
+	return ts.NextIs(TokenTypeOperand, TokenSubtypeText)
 }
 
 func (ts *TokenStreamImpl) NextIsLogical() bool {
-	return ts.NextIs("Operand", "Logical")
+	return ts.NextIs(TokenTypeOperand, TokenSubtypeLogical)
+}
+
+func (ts *TokenStreamImpl) NextIsError() bool {
+	return ts.NextIs(TokenTypeOperand, TokenSubtypeError)
+}
+
+// NextIsEnd returns true once all the tokens were consumed.
+func (ts *TokenStreamImpl) NextIsEnd() bool {
+	return ts.position >= len(ts.tokens)-1
 }
 
 func (ts *TokenStreamImpl) Position() int {
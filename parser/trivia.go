@@ -0,0 +1,276 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/usr-ein/excelparser/parser/shuntingyard"
+)
+
+// Trivia is how a node of a formula parsed losslessly was written, besides its children,
+// see Context.Lossless: whitespace, casing, redundant parentheses and the spelling
+// of numbers like 1E3 or .5. StringifyNodeLossless writes nodes back as they were written
+// while they keep their operator, function name or value.
+type Trivia struct {
+	// Redundant parentheses around the node, with the whitespace within them,
+	// e.g. "( " and " )" for ( A1 ). The trivia of the root holds the whitespace around the formula.
+	Leading  string
+	Trailing string
+	// Text of the node around its children: before the first one, between them and after the last one,
+	// e.g. "SUM( ", " ; ", " )" for SUM( A1 ; B1 ). Terminals have a single piece, their text.
+	Pieces []string
+
+	// Byte offsets of the node in its formula, without and with its parentheses, set while parsing
+	start, end, outerStart, outerEnd int
+	// Shape of the node when it was parsed, see shape
+	shape string
+}
+
+func (t *Trivia) trivia() *Trivia {
+	return t
+}
+
+// triviaOf returns the trivia of n, nil if it doesn't have any.
+func triviaOf(n Node) *Trivia {
+	if node, ok := n.(interface{ trivia() *Trivia }); ok {
+		return node.trivia()
+	}
+	return nil
+}
+
+// withTrivia returns a copy of n with the given trivia.
+func withTrivia(n Node, t *Trivia) Node {
+	switch node := n.(type) {
+	case CellNode:
+		node.Trivia = t
+		return node
+	case CellRangeNode:
+		node.Trivia = t
+		return node
+	case FunctionNode:
+		node.Trivia = t
+		return node
+	case BinaryExpressionNode:
+		node.Trivia = t
+		return node
+	case UnaryExpressionNode:
+		node.Trivia = t
+		return node
+	case NumberNode:
+		node.Trivia = t
+		return node
+	case TextNode:
+		node.Trivia = t
+		return node
+	case LogicalNode:
+		node.Trivia = t
+		return node
+	case ArrayNode:
+		node.Trivia = t
+		return node
+	case ErrorNode:
+		node.Trivia = t
+		return node
+	case NameNode:
+		node.Trivia = t
+		return node
+	case StructuredRefNode:
+		node.Trivia = t
+		return node
+	case Ref3DNode:
+		node.Trivia = t
+		return node
+	case ExternalRefNode:
+		node.Trivia = t
+		return node
+	case SpillRefNode:
+		node.Trivia = t
+		return node
+	case IdentifierNode:
+		node.Trivia = t
+		return node
+	case CallNode:
+		node.Trivia = t
+		return node
+	case EmptyNode:
+		node.Trivia = t
+		return node
+	}
+	return n
+}
+
+// shape returns what the trivia of n was written for: the operator or the function name
+// of the nodes with children, and the value of terminals.
+func shape(n Node) string {
+	switch node := n.(type) {
+	case FunctionNode:
+		return node.Name
+	case BinaryExpressionNode:
+		return node.Operator
+	case UnaryExpressionNode:
+		return node.Operator
+	case CallNode:
+		return ""
+	}
+	return stringifyNode(n, -1, refStyle{dialect: EnUS})
+}
+
+// spannedOperator is an operator of a formula parsed losslessly,
+// with the offset it is written at.
+type spannedOperator struct {
+	shuntingyard.Operator
+	offset int
+}
+
+// spanOperand records that the operand on top of the shunting yard is written
+// from the offset start to the end of the last token consumed, when parsing losslessly.
+func spanOperand(ctx Context, stream TokenStream, shuntingYard ShuntingYard, start int) {
+	if !ctx.Lossless {
+		return
+	}
+	operand, ok := shuntingYard.Operands.Pop()
+	if !ok {
+		return
+	}
+	end := stream.GetPrevious().end()
+	shuntingYard.Operands.Push(withTrivia(operand, &Trivia{start: start, end: end, outerStart: start, outerEnd: end}))
+}
+
+// spanEmpty records that the empty argument on top of the shunting yard is written
+// right before the next token, when parsing losslessly.
+func spanEmpty(ctx Context, stream TokenStream, shuntingYard ShuntingYard) {
+	if !ctx.Lossless {
+		return
+	}
+	operand, ok := shuntingYard.Operands.Pop()
+	if !ok {
+		return
+	}
+	offset := stream.GetNext().Offset
+	shuntingYard.Operands.Push(withTrivia(operand, &Trivia{start: offset, end: offset, outerStart: offset, outerEnd: offset}))
+}
+
+// parenthesizeOperand records that the operand on top of the shunting yard is within parentheses
+// written from the offset start to the end of the last token consumed, when parsing losslessly.
+func parenthesizeOperand(ctx Context, stream TokenStream, shuntingYard ShuntingYard, start int) {
+	if !ctx.Lossless {
+		return
+	}
+	operand, ok := shuntingYard.Operands.Top()
+	if !ok {
+		return
+	}
+	if t := triviaOf(operand); t != nil {
+		t.outerStart, t.outerEnd = start, stream.GetPrevious().end()
+	}
+}
+
+// spanExpression returns the trivia of an expression written from the offset start
+// to the end of its last operand, nil if that operand wasn't parsed losslessly.
+func spanExpression(start int, last Node) *Trivia {
+	t := triviaOf(last)
+	if t == nil {
+		return nil
+	}
+	return &Trivia{start: start, end: t.outerEnd, outerStart: start, outerEnd: t.outerEnd}
+}
+
+// fillTrivia sets the text of the trivia of the tree of formula from their offsets.
+func fillTrivia(n Node, formula string) {
+	t := triviaOf(n)
+	if t == nil || t.outerStart > t.start || t.start > t.end || t.end > t.outerEnd || t.outerEnd > len(formula) {
+		return
+	}
+	t.Leading = formula[t.outerStart:t.start]
+	t.Trailing = formula[t.end:t.outerEnd]
+	t.shape = shape(n)
+	if n.Type().IsTerminal() {
+		t.Pieces = []string{formula[t.start:t.end]}
+		return
+	}
+	pieces := make([]string, 0, len(n.Children())+1)
+	pos := t.start
+	for _, child := range n.Children() {
+		childTrivia := triviaOf(child)
+		if childTrivia == nil || childTrivia.outerStart < pos || childTrivia.outerEnd > t.end {
+			return
+		}
+		fillTrivia(child, formula)
+		pieces = append(pieces, formula[pos:childTrivia.outerStart])
+		pos = childTrivia.outerEnd
+	}
+	t.Pieces = append(pieces, formula[pos:t.end])
+}
+
+// stringifyTrivia writes n, which has trivia, as it was written. Its pieces are only used
+// while it keeps the shape it was parsed with, and its children are written with their own trivia.
+func stringifyTrivia(n Node, parentPrecedence int, style refStyle) string {
+	t := triviaOf(n)
+	// Parentheses are only added when the node doesn't have its own
+	parenthesized := strings.Contains(t.Leading, "(")
+	var body string
+	switch unchanged := t.shape == shape(n); {
+	case unchanged && n.Type().IsTerminal() && len(t.Pieces) == 1:
+		body = t.Pieces[0]
+	case unchanged && !n.Type().IsTerminal() && len(t.Pieces) == len(n.Children())+1:
+		var sb strings.Builder
+		for i, child := range n.Children() {
+			sb.WriteString(t.Pieces[i])
+			sb.WriteString(stringifyNode(child, childPrecedence(n, i), style))
+		}
+		sb.WriteString(t.Pieces[len(t.Pieces)-1])
+		body = sb.String()
+	case n.Type().IsTerminal() && len(t.Pieces) == 1 && sameSheets(t.shape, shape(n)) && isReference(n):
+		// Moved since it was parsed: its cells are written like StringifyNode does,
+		// after its sheets as they were written
+		moved := stringifyNode(withTrivia(n, nil), -1, style)
+		body = t.Pieces[0][:strings.LastIndexByte(t.Pieces[0], '!')+1] + moved[strings.LastIndexByte(moved, '!')+1:]
+	default:
+		// Changed since it was parsed, written like StringifyNode does
+		if parenthesized {
+			parentPrecedence = -1
+		}
+		return t.Leading + stringifyNode(withTrivia(n, nil), parentPrecedence, style) + t.Trailing
+	}
+	if bNode, ok := n.(BinaryExpressionNode); ok && !parenthesized && parentPrecedence > PrecedenceMap[bNode.Operator] {
+		return "(" + t.Leading + body + t.Trailing + ")"
+	}
+	return t.Leading + body + t.Trailing
+}
+
+// isReference tells whether n is a reference to cells, which may be moved.
+func isReference(n Node) bool {
+	switch n.(type) {
+	case CellNode, CellRangeNode, SpillRefNode, Ref3DNode, ExternalRefNode:
+		return true
+	}
+	return false
+}
+
+// sameSheets tells whether two shapes of references are in the same sheets,
+// which are written before their last !, e.g. Jan:Dec! in Jan:Dec!B5.
+func sameSheets(a, b string) bool {
+	return a[:strings.LastIndexByte(a, '!')+1] == b[:strings.LastIndexByte(b, '!')+1]
+}
+
+// childPrecedence returns the precedence the i-th child of n is written with,
+// like stringifyBinaryExp does.
+func childPrecedence(n Node, i int) int {
+	switch node := n.(type) {
+	case BinaryExpressionNode:
+		precedence := PrecedenceMap[node.Operator]
+		if i == 1 && !IsCommutative[node.Operator] {
+			return precedence + 1
+		}
+		return precedence
+	case UnaryExpressionNode:
+		// Binary expressions are always within parentheses in unary ones
+		return PrecedenceMap[","] + 1
+	case FunctionNode, ArrayNode:
+		return argumentPrecedence(n.Children()[i])
+	case CallNode:
+		if i > 0 {
+			return argumentPrecedence(n.Children()[i])
+		}
+	}
+	return -1
+}
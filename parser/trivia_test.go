@@ -0,0 +1,118 @@
+package parser
+
+import "testing"
+
+func TestStringifyNodeLosslessRoundTrip(t *testing.T) {
+	formulas := append([]string{
+		`= ( A1 + .5 ) * -( B2 )  `,
+		`=sum( A1:A2 ,1E3 )+iferror(A1,#n/a)&true`,
+		`=((A1))+(((1)))`,
+		`=A1:B2  B1:C2+@ A1:A2+50 %`,
+		`={1, 2;3,4} &"a""b"`,
+		`=Sheet1!$A$1+'Sheet 2'!A1+Jan:Dec!B5`,
+		`=LET(x, 1, f, LAMBDA(v, v+x), f( 3 ))+LAMBDA(a,a) (2)`,
+		`=SUM((A1,B1))`,
+		`=-A1 % *( B1+1 )%+IF( A1, ,2 )&VLOOKUP(A1,B:C,2,)`,
+		`=SUM(A1:INDEX( B:B ,2 ))`,
+	}, tokenizeCorpus...)
+	for _, formula := range formulas {
+		expected, err := Parse(formula, "Sheet1")
+		if err != nil {
+			t.Errorf("could not parse %s: %v", formula, err)
+			continue
+		}
+		node, err := ParseLossless(formula, "Sheet1")
+		if err != nil {
+			t.Errorf("could not parse %s: %v", formula, err)
+			continue
+		}
+		if got := StringifyNodeLossless(node, Context{CurrentSheet: "Sheet1"}); got != Formula(formula) {
+			t.Errorf("StringifyNodeLossless(%s) = %s", formula, got)
+		}
+		if !node.IsEq(expected) {
+			t.Errorf("ParseLossless(%s) = %v; want %v", formula, node, expected)
+		}
+	}
+}
+
+func TestStringifyNodeLosslessContext(t *testing.T) {
+	testCases := []struct {
+		formula string
+		ctx     Context
+	}{
+		{`=SOMME( A1 ;1,5 )*VRAI`, Context{CurrentSheet: "Sheet1", Dialect: FrFR}},
+		{`=R[-1]C +  RC[2]`, Context{CurrentSheet: "Sheet1", R1C1: true, Anchor: Cell{Sheet: "Sheet1", Row: 4, Col: 4}}},
+	}
+	for _, tc := range testCases {
+		ctx := tc.ctx
+		ctx.Lossless = true
+		node, err := ParseWithContext(tc.formula, ctx)
+		if err != nil {
+			t.Errorf("could not parse %s: %v", tc.formula, err)
+			continue
+		}
+		if got := StringifyNodeLossless(node, tc.ctx); got != Formula(tc.formula) {
+			t.Errorf("StringifyNodeLossless(%s) = %s", tc.formula, got)
+		}
+	}
+}
+
+func TestShiftNodeLossless(t *testing.T) {
+	testCases := []struct {
+		formula  string
+		expected Formula
+	}{
+		{`=SUM( A1:A2 ,1E3 )`, `=SUM( A2:A3 ,1E3 )`},
+		{`=( $A$1 + B$1 )*.5`, `=( $A$1 + B$1 )*.5`},
+		{`=IF(  A1>0 , Sheet2!C1 , "" )`, `=IF(  A2>0 , Sheet2!C2 , "" )`},
+		{`=sum(A1#, @Jan:Dec!B5)`, `=sum(A2#, @Jan:Dec!B6)`},
+		// Moved references keep their sheets as they were written
+		{`=Sheet1!$A1`, `=Sheet1!$A2`},
+		{`=SUM( 'Sheet1'!A1 )`, `=SUM( 'Sheet1'!A2 )`},
+		{`='O''Brien'!A1+B2`, `='O''Brien'!A2+B3`},
+		{`=[1]Sheet1!A1:B$2*Sheet2!A:A`, `=[1]Sheet1!A2:B$2*Sheet2!A:A`},
+	}
+	for _, tc := range testCases {
+		node, err := ParseLossless(tc.formula, "Sheet1")
+		if err != nil {
+			t.Errorf("could not parse %s: %v", tc.formula, err)
+			continue
+		}
+		shifted, err := ShiftNode(node, 1, 0)
+		if err != nil {
+			t.Errorf("could not shift %s: %v", tc.formula, err)
+			continue
+		}
+		if got := StringifyNodeLossless(shifted, Context{CurrentSheet: "Sheet1"}); got != tc.expected {
+			t.Errorf("StringifyNodeLossless(ShiftNode(%s)) = %s; want %s", tc.formula, got, tc.expected)
+		}
+	}
+}
+
+func TestStringifyNodeLosslessChanged(t *testing.T) {
+	node, err := ParseLossless(`= A1 * ( B1 )`, "Sheet1")
+	if err != nil {
+		t.Fatalf("could not parse: %v", err)
+	}
+	bNode := node.(BinaryExpressionNode)
+	sum := BinaryExpressionNode{Operator: "+", Left: NumberNode{Value: 1}, Right: NumberNode{Value: 2}}
+
+	testCases := []struct {
+		node     Node
+		expected Formula
+	}{
+		// A new child is written normalized, within parentheses if needed
+		{BinaryExpressionNode{Operator: "*", Left: sum, Right: bNode.Right, Trivia: bNode.Trivia}, `= (1+2) * ( B1 )`},
+		{BinaryExpressionNode{Operator: "*", Left: bNode.Left, Right: sum, Trivia: bNode.Trivia}, `= A1 * (1+2)`},
+		// A changed operator writes the node normalized, with the trivia of its children
+		{BinaryExpressionNode{Operator: "-", Left: bNode.Left, Right: bNode.Right, Trivia: bNode.Trivia}, `= A1-( B1 )`},
+		// A child written without parentheses gets them if needed
+		{BinaryExpressionNode{Operator: "/", Left: sum, Right: node}, `=(1+2)/( A1 * ( B1 ))`},
+		{UnaryExpressionNode{Operator: "-", Operand: node}, `=-( A1 * ( B1 ))`},
+	}
+	for _, tc := range testCases {
+		if got := StringifyNodeLossless(tc.node, Context{CurrentSheet: "Sheet1"}); got != tc.expected {
+			t.Errorf("StringifyNodeLossless(%v) = %s; want %s", tc.node, got, tc.expected)
+		}
+	}
+}
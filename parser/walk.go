@@ -0,0 +1,136 @@
+package parser
+
+import "github.com/pkg/errors"
+
+// Visitor visits the nodes of a tree with Walk.
+type Visitor interface {
+	// Enter is called with a node before its children, which are skipped if it returns false
+	Enter(n Node) bool
+	// Leave is called with a node after its children, even if they were skipped
+	Leave(n Node)
+}
+
+// Walk goes through the tree of n depth first, calling v.Enter with each node before its children,
+// in the order of Children, and v.Leave after them. The references of 3D and external references
+// aren't children of them, and aren't visited.
+func Walk(n Node, v Visitor) {
+	if v.Enter(n) {
+		for _, child := range n.Children() {
+			Walk(child, v)
+		}
+	}
+	v.Leave(n)
+}
+
+// inspector is a visitor only entering nodes, see Inspect.
+type inspector func(Node) bool
+
+func (f inspector) Enter(n Node) bool {
+	return f(n)
+}
+
+func (f inspector) Leave(Node) {}
+
+// Inspect goes through the tree of n depth first, calling f with each node before its children,
+// which are skipped if it returns false, e.g. to count the cells of a formula outside of functions:
+//
+//	Inspect(node, func(n Node) bool {
+//		if n.Type() == NodeTypeCell {
+//			cells++
+//		}
+//		return n.Type() != NodeTypeFunction
+//	})
+func Inspect(n Node, f func(Node) bool) {
+	Walk(n, inspector(f))
+}
+
+// Rewrite returns the tree of n with each node replaced by f(node), bottom up: f is called with
+// each node once its children were rewritten. f returns nil to keep a node as is, which spares
+// rebuilding the nodes above it, so only the paths to the changed nodes are rebuilt, keeping
+// their trivia. The references of 3D and external references aren't children of them,
+// and aren't rewritten.
+//
+// The first error returned by f stops the rewrite, and is returned.
+func Rewrite(n Node, f func(Node) (Node, error)) (Node, error) {
+	rewritten, err := rewrite(n, f)
+	if err != nil {
+		return nil, err
+	}
+	if rewritten == nil {
+		return n, nil
+	}
+	return rewritten, nil
+}
+
+// rewrite returns the rewritten tree of n, nil if nothing changed in it.
+func rewrite(n Node, f func(Node) (Node, error)) (Node, error) {
+	children := n.Children()
+	var rewrittenChildren []Node
+	for i, child := range children {
+		rewritten, err := rewrite(child, f)
+		if err != nil {
+			return nil, err
+		}
+		if rewritten == nil {
+			continue
+		}
+		if rewrittenChildren == nil {
+			rewrittenChildren = make([]Node, len(children))
+			copy(rewrittenChildren, children)
+		}
+		rewrittenChildren[i] = rewritten
+	}
+	if rewrittenChildren == nil {
+		return f(n)
+	}
+	rebuilt, err := withChildren(n, rewrittenChildren)
+	if err != nil {
+		return nil, err
+	}
+	replaced, err := f(rebuilt)
+	if err != nil || replaced != nil {
+		return replaced, err
+	}
+	return rebuilt, nil
+}
+
+// withChildren returns a copy of n with the given children, in the order of Children.
+func withChildren(n Node, children []Node) (Node, error) {
+	switch node := n.(type) {
+	case FunctionNode:
+		node.Arguments = children
+		return node, nil
+	case BinaryExpressionNode:
+		if len(children) != 2 {
+			return nil, errors.New("binary expression needs 2 children")
+		}
+		node.Left, node.Right = children[0], children[1]
+		return node, nil
+	case UnaryExpressionNode:
+		if len(children) != 1 {
+			return nil, errors.New("unary expression needs 1 child")
+		}
+		node.Operand = children[0]
+		return node, nil
+	case CallNode:
+		if len(children) == 0 {
+			return nil, errors.New("call needs a callee")
+		}
+		node.Callee, node.Arguments = children[0], children[1:]
+		return node, nil
+	case ArrayNode:
+		rows := make([][]Node, len(node.Rows))
+		for i, row := range node.Rows {
+			if len(children) < len(row) {
+				return nil, errors.New("array needs as many children as elements")
+			}
+			rows[i], children = children[:len(row)], children[len(row):]
+		}
+		node.Rows = rows
+		return node, nil
+	}
+	if len(children) != 0 {
+		return nil, errors.Errorf("%s node has no children", n.Type())
+	}
+	return n, nil
+}
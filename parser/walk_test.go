@@ -0,0 +1,136 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// recorder is a visitor recording the types of the nodes it enters and leaves.
+type recorder struct {
+	events []string
+	skip   NodeType
+}
+
+func (r *recorder) Enter(n Node) bool {
+	r.events = append(r.events, "+"+n.Type().String())
+	return n.Type() != r.skip
+}
+
+func (r *recorder) Leave(n Node) {
+	r.events = append(r.events, "-"+n.Type().String())
+}
+
+func TestWalk(t *testing.T) {
+	node, err := Parse(`=SUM(A1, -2)*LAMBDA(x, x)(3)`, "Sheet1")
+	if err != nil {
+		t.Fatalf("could not parse: %v", err)
+	}
+	testCases := []struct {
+		skip     NodeType
+		expected string
+	}{
+		{NodeTypeText, "+binExp +func +cell -cell +unaExp +num -num -unaExp -func +call +func +ident -ident +ident -ident -func +num -num -call -binExp"},
+		{NodeTypeFunction, "+binExp +func -func +call +func -func +num -num -call -binExp"},
+	}
+	for _, tc := range testCases {
+		r := &recorder{skip: tc.skip}
+		Walk(node, r)
+		if got := strings.Join(r.events, " "); got != tc.expected {
+			t.Errorf("Walk skipping %s = %s; want %s", tc.skip, got, tc.expected)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	node, err := Parse(`=A1+SUM(B1:B2, C1)+{1,2}`, "Sheet1")
+	if err != nil {
+		t.Fatalf("could not parse: %v", err)
+	}
+	var types []string
+	Inspect(node, func(n Node) bool {
+		types = append(types, n.Type().String())
+		return n.Type() != NodeTypeFunction
+	})
+	if got, expected := strings.Join(types, " "), "binExp binExp cell func array num num"; got != expected {
+		t.Errorf("Inspect = %s; want %s", got, expected)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	double := func(n Node) (Node, error) {
+		if num, ok := n.(NumberNode); ok {
+			num.Value *= 2
+			return num, nil
+		}
+		return nil, nil
+	}
+	testCases := []struct {
+		formula  string
+		expected Formula
+	}{
+		{`=SUM(1, A1)+-2*{3,4;5,6}`, `=SUM(2, A1)+-4*{6,8;10,12}`},
+		{`=LAMBDA(x, x+1)(A1)`, `=LAMBDA(x, x+2)(A1)`},
+		{`=A1&"a"`, `=A1&"a"`},
+	}
+	for _, tc := range testCases {
+		node, err := Parse(tc.formula, "Sheet1")
+		if err != nil {
+			t.Errorf("could not parse %s: %v", tc.formula, err)
+			continue
+		}
+		rewritten, err := Rewrite(node, double)
+		if err != nil {
+			t.Errorf("could not rewrite %s: %v", tc.formula, err)
+			continue
+		}
+		if got := StringifyNode(rewritten, "Sheet1"); got != tc.expected {
+			t.Errorf("Rewrite(%s) = %s; want %s", tc.formula, got, tc.expected)
+		}
+	}
+}
+
+func TestRewriteChangedPaths(t *testing.T) {
+	node, err := Parse(`=SUM(A1, 1)+MAX(B1, C1)`, "Sheet1")
+	if err != nil {
+		t.Fatalf("could not parse: %v", err)
+	}
+	rewritten, err := Rewrite(node, func(n Node) (Node, error) {
+		if n.Type() == NodeTypeNumber {
+			return NumberNode{Value: 2}, nil
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("could not rewrite: %v", err)
+	}
+	left := node.(BinaryExpressionNode).Left.(FunctionNode)
+	right := node.(BinaryExpressionNode).Right.(FunctionNode)
+	rewrittenLeft := rewritten.(BinaryExpressionNode).Left.(FunctionNode)
+	rewrittenRight := rewritten.(BinaryExpressionNode).Right.(FunctionNode)
+	if &rewrittenLeft.Arguments[0] == &left.Arguments[0] {
+		t.Errorf("Rewrite kept the arguments of SUM although one changed")
+	}
+	if &rewrittenRight.Arguments[0] != &right.Arguments[0] {
+		t.Errorf("Rewrite rebuilt the arguments of MAX although none changed")
+	}
+	if got, expected := StringifyNode(node, "Sheet1"), Formula(`=SUM(A1, 1)+MAX(B1, C1)`); got != expected {
+		t.Errorf("Rewrite changed its tree to %s; want %s", got, expected)
+	}
+}
+
+func TestRewriteError(t *testing.T) {
+	node, err := Parse(`=SUM(A1, B1)`, "Sheet1")
+	if err != nil {
+		t.Fatalf("could not parse: %v", err)
+	}
+	errStop := errors.New("stop")
+	calls := 0
+	_, err = Rewrite(node, func(n Node) (Node, error) {
+		calls++
+		return nil, errStop
+	})
+	if !errors.Is(err, errStop) || calls != 1 {
+		t.Errorf("Rewrite = %v after %d calls; want %v after 1 call", err, calls, errStop)
+	}
+}
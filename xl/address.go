@@ -64,11 +64,7 @@ func (c Cell) ToAddress() Address {
 	if !c.ColRel {
 		col = "$" + col
 	}
-	sheetName := c.Sheet
-	if shouldQuoteSheetName(sheetName) {
-		sheetName = "'" + sheetName + "'"
-	}
-	address := sheetName + "!" + col + row
+	address := QuoteSheetName(c.Sheet) + "!" + col + row
 
 	// Leap of faith
 	return Address(address)
@@ -78,16 +74,32 @@ func (c Cell) ToAddress() Address {
 var goodSheetName = regexp.MustCompile(`^[^\d.][a-zA-Z0-9_]*$`)
 
 func shouldQuoteSheetName(sheetName string) bool {
-	return !goodSheetName.MatchString(sheetName)
+	return !goodSheetName.MatchString(sheetName) || strings.Contains(sheetName, "'")
+}
+
+// QuoteSheetName returns a sheet name as written before the ! of a reference,
+// between quotes if needed, e.g. 'My sheet', where its own quotes are doubled.
+func QuoteSheetName(sheetName string) string {
+	if shouldQuoteSheetName(sheetName) {
+		return "'" + strings.ReplaceAll(sheetName, "'", "''") + "'"
+	}
+	return sheetName
+}
+
+// UnquoteSheetName returns the name of a sheet written before the ! of a reference,
+// without its quotes if it has any, and with its doubled quotes made single again.
+func UnquoteSheetName(s string) string {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	return s
 }
 
 func splitAddress(address Address) (SplitAddress, error) {
 	split := strings.Split(string(address), "!")
 
 	if len(split) > 1 {
-		sheet := split[0]
-		sheet = strings.TrimPrefix(sheet, "'")
-		sheet = strings.TrimSuffix(sheet, "'")
+		sheet := UnquoteSheetName(split[0])
 
 		if sheet == "" {
 			return SplitAddress{}, errors.New("missing sheet name")
@@ -19,3 +19,23 @@ func TestParseAddress(t *testing.T) {
 		}
 	}
 }
+
+func TestQuoteSheetName(t *testing.T) {
+	testCases := []struct {
+		sheet    string
+		expected string
+	}{
+		{"Sheet1", "Sheet1"},
+		{"My sheet", "'My sheet'"},
+		{"O'Brien", "'O''Brien'"},
+	}
+	for _, tc := range testCases {
+		quoted := QuoteSheetName(tc.sheet)
+		if quoted != tc.expected {
+			t.Errorf("QuoteSheetName(%s) = %s; want %s", tc.sheet, quoted, tc.expected)
+		}
+		if unquoted := UnquoteSheetName(quoted); unquoted != tc.sheet {
+			t.Errorf("UnquoteSheetName(%s) = %s; want %s", quoted, unquoted, tc.sheet)
+		}
+	}
+}
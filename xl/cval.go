@@ -45,13 +45,15 @@ import (
 //	}
 //
 // aka, an empty cell has a computed number value of 4! This is because of the formula =A1:B2 spilling into D4.
+// The sheet records the spill, see Sheet.Spill.
 type CVal struct {
 	Type CType `json:"-"`
 
 	ValString string `json:"str,omitempty"`
 	// We don't need the precision of float64
-	ValNumber float32 `json:"num,omitempty"`
-	ValBool   bool    `json:"bool,omitempty"`
+	ValNumber float32   `json:"num,omitempty"`
+	ValBool   bool      `json:"bool,omitempty"`
+	ValError  ErrorCode `json:"err,omitempty"`
 
 	// If a formula, this is the formula string
 	ValFormula Formula `json:"formula,omitempty"`
@@ -71,6 +73,7 @@ const (
 	CTFormula
 	CTNumber
 	CTBool
+	CTError
 )
 
 func (c CType) String() string {
@@ -85,6 +88,8 @@ func (c CType) String() string {
 		return "number"
 	case CTBool:
 		return "bool"
+	case CTError:
+		return "error"
 	default:
 		return "unknown"
 	}
@@ -97,6 +102,7 @@ func (c CVal) Computed() CVal {
 			ValString:    c.ValString,
 			ValNumber:    c.ValNumber,
 			ValBool:      c.ValBool,
+			ValError:     c.ValError,
 			HasComputed:  false,
 			ComputedType: CTEmpty,
 		}
@@ -104,6 +110,17 @@ func (c CVal) Computed() CVal {
 	return c
 }
 
+// SetComputed records the computed value of a formula, e.g. after evaluating it.
+// The computed value must not be a formula itself.
+func (c *CVal) SetComputed(computed CVal) {
+	c.HasComputed = true
+	c.ComputedType = computed.Type
+	c.ValString = computed.ValString
+	c.ValNumber = computed.ValNumber
+	c.ValBool = computed.ValBool
+	c.ValError = computed.ValError
+}
+
 func makeContent(raw [][]any, computed [][]any) ([][]CVal, error) {
 	if !isRectangular(raw) {
 		return nil, errors.New("content is not rectangular")
@@ -138,6 +155,11 @@ func makeContent(raw [][]any, computed [][]any) ([][]CVal, error) {
 	return content, nil
 }
 
+// Text is a value of RawSheet that is always a text. Strings are read like
+// Excel reads what is typed in a cell: TRUE is a boolean and =A1 a formula,
+// whereas Text("TRUE") and Text("=A1") are texts, e.g. the text cells of files.
+type Text string
+
 func makeCellVal(raw any, computed any) (CVal, error) {
 	if raw == nil {
 		return CVal{Type: CTEmpty}, nil
@@ -165,27 +187,38 @@ func makeCellVal(raw any, computed any) (CVal, error) {
 			if computed == nil {
 				return formulaCVal, nil
 			} else {
-				computedCVal, err := makeCellVal(computed, nil)
+				computedCVal, err := makeComputedVal(computed)
 				if err != nil || computedCVal.Type == CTFormula {
 					return formulaCVal, nil
 				}
-				formulaCVal.HasComputed = true
-				formulaCVal.ComputedType = computedCVal.Type
-				formulaCVal.ValString = computedCVal.ValString
-				formulaCVal.ValNumber = computedCVal.ValNumber
-				formulaCVal.ValBool = computedCVal.ValBool
-
+				formulaCVal.SetComputed(computedCVal)
 				return formulaCVal, nil
 			}
 		}
 		return CVal{Type: CTString, ValString: val}, nil
+	case Text:
+		return CVal{Type: CTString, ValString: string(val)}, nil
 	case bool:
 		return CVal{Type: CTBool, ValBool: val}, nil
+	case ErrorCode:
+		return CVal{Type: CTError, ValError: val}, nil
 	default:
 		return CVal{}, errors.New("unknown cell type")
 	}
 }
 
+// makeComputedVal is makeCellVal for the computed value of a formula, which can also be
+// an error written as text, e.g. #N/A. Errors in the content are ErrorCode values, since
+// a text like #N/A is just text there.
+func makeComputedVal(computed any) (CVal, error) {
+	if s, ok := computed.(string); ok {
+		if code, err := ParseErrorCode(s); err == nil {
+			return CVal{Type: CTError, ValError: code}, nil
+		}
+	}
+	return makeCellVal(computed, nil)
+}
+
 func (cell CVal) String() string {
 	switch cell.Type {
 	case CTString:
@@ -207,6 +240,8 @@ func (cell CVal) String() string {
 		} else {
 			return "false"
 		}
+	case CTError:
+		return string(cell.ValError)
 	case CTEmpty:
 		return "nil"
 	}
@@ -223,6 +258,8 @@ func (cell CVal) ToValue() any {
 		return cell.ValNumber
 	case CTBool:
 		return cell.ValBool
+	case CTError:
+		return cell.ValError
 	case CTEmpty:
 		return nil
 	}
@@ -0,0 +1,74 @@
+package xl
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrorCode is an Excel error value, such as #DIV/0! or #N/A.
+// Like in Excel, errors are values that cells can hold, so ErrorCode
+// is also a Go error for when it needs to be reported as one.
+type ErrorCode string
+
+const (
+	ErrorNull        ErrorCode = "#NULL!"
+	ErrorDiv0        ErrorCode = "#DIV/0!"
+	ErrorValue       ErrorCode = "#VALUE!"
+	ErrorRef         ErrorCode = "#REF!"
+	ErrorName        ErrorCode = "#NAME?"
+	ErrorNum         ErrorCode = "#NUM!"
+	ErrorNA          ErrorCode = "#N/A"
+	ErrorGettingData ErrorCode = "#GETTING_DATA"
+	ErrorSpill       ErrorCode = "#SPILL!"
+	ErrorCalc        ErrorCode = "#CALC!"
+	ErrorField       ErrorCode = "#FIELD!"
+	ErrorBlocked     ErrorCode = "#BLOCKED!"
+	ErrorConnect     ErrorCode = "#CONNECT!"
+	ErrorBusy        ErrorCode = "#BUSY!"
+	ErrorUnknown     ErrorCode = "#UNKNOWN!"
+	ErrorExternal    ErrorCode = "#EXTERNAL!"
+	ErrorPython      ErrorCode = "#PYTHON!"
+)
+
+// ErrorCodes lists every Excel error code.
+var ErrorCodes = []ErrorCode{
+	ErrorNull, ErrorDiv0, ErrorValue, ErrorRef, ErrorName, ErrorNum, ErrorNA,
+	ErrorGettingData, ErrorSpill, ErrorCalc, ErrorField, ErrorBlocked,
+	ErrorConnect, ErrorBusy, ErrorUnknown, ErrorExternal, ErrorPython,
+}
+
+// ParseErrorCode returns the error code written as s, case-insensitively like Excel does.
+func ParseErrorCode(s string) (ErrorCode, error) {
+	for _, code := range ErrorCodes {
+		if strings.EqualFold(s, string(code)) {
+			return code, nil
+		}
+	}
+	return "", errors.New("unknown error code")
+}
+
+func (e ErrorCode) Error() string {
+	return string(e)
+}
+
+func (e ErrorCode) String() string {
+	return string(e)
+}
+
+func (e *ErrorCode) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s == "" {
+		*e = ""
+		return nil
+	}
+	code, err := ParseErrorCode(s)
+	if err != nil {
+		return err
+	}
+	*e = code
+	return nil
+}
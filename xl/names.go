@@ -0,0 +1,37 @@
+package xl
+
+import "strings"
+
+// DefinedName is a name given to a reference, a constant or a formula,
+// like the ones of Excel's Name Manager.
+type DefinedName struct {
+	Name string `json:"name"`
+	// Sheet the name is scoped to, or "" for a name scoped to the workbook
+	Scope string `json:"scope,omitempty"`
+	// What the name stands for, e.g. =Sheet1!$A$1:$A$10, =0.2 or =SUM(Sheet1!$B:$B)
+	RefersTo Formula `json:"refersTo"`
+}
+
+// DefinedNames is a list of defined names.
+type DefinedNames []DefinedName
+
+// ResolveName returns the definition of a name as seen from a formula in the given sheet.
+// Like in Excel, names are matched case-insensitively, and a name scoped to the sheet
+// hides the workbook name with the same name.
+func (d DefinedNames) ResolveName(name string, sheet string) (DefinedName, bool) {
+	var global *DefinedName
+	for i := range d {
+		if !strings.EqualFold(d[i].Name, name) {
+			continue
+		}
+		if d[i].Scope == "" {
+			global = &d[i]
+		} else if sheet != "" && strings.EqualFold(d[i].Scope, sheet) {
+			return d[i], true
+		}
+	}
+	if global == nil {
+		return DefinedName{}, false
+	}
+	return *global, true
+}
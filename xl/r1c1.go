@@ -0,0 +1,204 @@
+package xl
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rows and columns in R1C1 notation: R2 is row 2, R[-1] the row above and R the same row.
+var /* const */ r1c1Regex = regexp.MustCompile(`^(?:R(\[-?\d+\]|\d+)?)?(?:C(\[-?\d+\]|\d+)?)?$`)
+
+// r1c1Part is a parsed row or column of an R1C1 reference.
+type r1c1Part struct {
+	present bool
+	index   int
+	rel     bool
+}
+
+// IsR1C1 tells whether s is a cell, a whole row or a whole column in R1C1 notation,
+// e.g. R1C1, R[-1]C, R2 or C[3], without a sheet.
+func IsR1C1(s string) bool {
+	return s != "" && r1c1Regex.MatchString(strings.ToUpper(s))
+}
+
+// parseR1C1 parses the row and column of a local R1C1 reference, relative to anchor.
+func parseR1C1(s string, anchor Cell) (row r1c1Part, col r1c1Part, err error) {
+	upper := strings.ToUpper(s)
+	m := r1c1Regex.FindStringSubmatch(upper)
+	if s == "" || m == nil {
+		return row, col, errors.New("incompatible format")
+	}
+	row.present = strings.HasPrefix(upper, "R")
+	col.present = strings.Contains(upper, "C")
+	row.index, row.rel, err = r1c1Index(m[1], int(anchor.Row))
+	if err != nil {
+		return row, col, err
+	}
+	col.index, col.rel, err = r1c1Index(m[2], int(anchor.Col))
+	if err != nil {
+		return row, col, err
+	}
+	if row.present && (row.index < 0 || row.index >= MAX_ROWS) {
+		return row, col, errors.New("invalid row number")
+	}
+	if col.present && (col.index < 0 || col.index >= MAX_COLS) {
+		return row, col, errors.New("invalid column number")
+	}
+	return row, col, nil
+}
+
+// r1c1Index returns the 0-based index written after R or C,
+// e.g. 2 for R3, or anchor-1 for R[-1].
+func r1c1Index(s string, anchor int) (int, bool, error) {
+	if s == "" {
+		return anchor, true, nil
+	}
+	if strings.HasPrefix(s, "[") {
+		offset, err := strconv.Atoi(s[1 : len(s)-1])
+		if err != nil {
+			return 0, false, err
+		}
+		return anchor + offset, true, nil
+	}
+	index, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false, err
+	}
+	return index - 1, false, nil
+}
+
+// ParseCellR1C1 parses a cell in R1C1 notation, e.g. R1C1, R[-1]C[2] or Sheet2!RC[1].
+// Relative rows and columns are offsets from anchor, and the cell is
+// in the anchor's sheet unless it has its own.
+func ParseCellR1C1(s string, anchor Cell) (Cell, error) {
+	split, err := splitAddress(Address(s))
+	if err != nil {
+		return Cell{}, err
+	}
+	row, col, err := parseR1C1(string(split.LocalAddress), anchor)
+	if err != nil {
+		return Cell{}, err
+	}
+	if !row.present || !col.present {
+		return Cell{}, errors.New("not a cell")
+	}
+	sheet := split.Sheet
+	if sheet == "" {
+		sheet = anchor.Sheet
+	}
+	if sheet == "" {
+		return Cell{}, errors.New("missing sheet prefix and fallback sheet name")
+	}
+	return Cell{Sheet: sheet, Row: uint32(row.index), Col: uint16(col.index), RowRel: row.rel, ColRel: col.rel}, nil
+}
+
+// ParseRangeR1C1 parses a range in R1C1 notation, relative to anchor like ParseCellR1C1.
+// Besides ranges of cells like R1C1:R[2]C, it parses whole rows and columns,
+// e.g. R1:R3 or C[-1], which like in A1 notation have absolute columns and rows.
+func ParseRangeR1C1(s string, anchor Cell) (Range, error) {
+	startStr, endStr, isRange := strings.Cut(s, ":")
+	if !isRange {
+		endStr = startStr
+	}
+	startSplit, err := splitAddress(Address(startStr))
+	if err != nil {
+		return Range{}, err
+	}
+	// Like with A1 ranges, a sheet name on the end is ignored
+	endSplit, err := splitAddress(Address(endStr))
+	if err != nil {
+		return Range{}, err
+	}
+	sheet := startSplit.Sheet
+	if sheet == "" {
+		sheet = anchor.Sheet
+	}
+	if sheet == "" {
+		return Range{}, errors.New("missing sheet prefix and fallback sheet name")
+	}
+	startStr, endStr = string(startSplit.LocalAddress), string(endSplit.LocalAddress)
+	startRow, startCol, errStart := parseR1C1(startStr, anchor)
+	endRow, endCol, errEnd := parseR1C1(endStr, anchor)
+	if errors.Join(errStart, errEnd) != nil {
+		return Range{}, errors.New("incompatible format")
+	}
+	switch {
+	case startRow.present && startCol.present && endRow.present && endCol.present:
+		if !isRange {
+			return Range{}, errors.New("not a range")
+		}
+		return Range{
+			Start: Cell{Sheet: sheet, Row: uint32(startRow.index), Col: uint16(startCol.index), RowRel: startRow.rel, ColRel: startCol.rel},
+			End:   Cell{Sheet: sheet, Row: uint32(endRow.index + 1), Col: uint16(endCol.index + 1), RowRel: endRow.rel, ColRel: endCol.rel},
+		}, nil
+	case !startCol.present && !endCol.present:
+		return Range{
+			Start: Cell{Sheet: sheet, Row: uint32(startRow.index), Col: 0, RowRel: startRow.rel, ColRel: false},
+			End:   Cell{Sheet: sheet, Row: uint32(endRow.index + 1), Col: MAX_COLS, RowRel: endRow.rel, ColRel: false},
+		}, nil
+	case !startRow.present && !endRow.present:
+		return Range{
+			Start: Cell{Sheet: sheet, Row: 0, Col: uint16(startCol.index), RowRel: false, ColRel: startCol.rel},
+			End:   Cell{Sheet: sheet, Row: MAX_ROWS, Col: uint16(endCol.index + 1), RowRel: false, ColRel: endCol.rel},
+		}, nil
+	default:
+		return Range{}, errors.New("incompatible format")
+	}
+}
+
+// ToR1C1 turns the cell into an address in R1C1 notation, with relative rows
+// and columns written as offsets from anchor, e.g. R[-1]C or Sheet2!R1C[2].
+// The sheet is left out if it is the anchor's.
+func (c Cell) ToR1C1(anchor Cell) Address {
+	address := rowToR1C1(c.Row, c.RowRel, anchor) + colToR1C1(c.Col, c.ColRel, anchor)
+	if c.Sheet != anchor.Sheet {
+		address = QuoteSheetName(c.Sheet) + "!" + address
+	}
+	return Address(address)
+}
+
+// StringR1C1 turns the range into a string in R1C1 notation, see Cell.ToR1C1.
+// Whole rows and columns spanning a single one are written alone, e.g. R2 or C[-1].
+func (r Range) StringR1C1(anchor Cell) string {
+	var start, end string
+	switch {
+	case r.isWrittenWholeRow():
+		start = rowToR1C1(r.Start.Row, r.Start.RowRel, anchor)
+		end = rowToR1C1(r.End.Row-1, r.End.RowRel, anchor)
+	case r.isWrittenWholeColumn():
+		start = colToR1C1(r.Start.Col, r.Start.ColRel, anchor)
+		end = colToR1C1(r.End.Col-1, r.End.ColRel, anchor)
+	default:
+		start = rowToR1C1(r.Start.Row, r.Start.RowRel, anchor) + colToR1C1(r.Start.Col, r.Start.ColRel, anchor)
+		end = rowToR1C1(r.End.Row-1, r.End.RowRel, anchor) + colToR1C1(r.End.Col-1, r.End.ColRel, anchor)
+	}
+	s := start + ":" + end
+	if start == end && (r.isWrittenWholeRow() || r.isWrittenWholeColumn()) {
+		s = start
+	}
+	if r.Start.Sheet != anchor.Sheet {
+		s = QuoteSheetName(r.Start.Sheet) + "!" + s
+	}
+	return s
+}
+
+func rowToR1C1(row uint32, rel bool, anchor Cell) string {
+	return r1c1Label("R", int(row), rel, int(anchor.Row))
+}
+
+func colToR1C1(col uint16, rel bool, anchor Cell) string {
+	return r1c1Label("C", int(col), rel, int(anchor.Col))
+}
+
+func r1c1Label(prefix string, index int, rel bool, anchor int) string {
+	switch {
+	case !rel:
+		return prefix + strconv.Itoa(index+1)
+	case index == anchor:
+		return prefix
+	default:
+		return prefix + "[" + strconv.Itoa(index-anchor) + "]"
+	}
+}
@@ -0,0 +1,69 @@
+package xl
+
+import "testing"
+
+func TestParseCellR1C1(t *testing.T) {
+	anchor := Cell{Sheet: "Sheet1", Row: 4, Col: 1} // B5
+	cases := map[string]Cell{
+		"R1C1":          {Sheet: "Sheet1", Row: 0, Col: 0},
+		"RC":            {Sheet: "Sheet1", Row: 4, Col: 1, RowRel: true, ColRel: true},
+		"R[-1]C[2]":     {Sheet: "Sheet1", Row: 3, Col: 3, RowRel: true, ColRel: true},
+		"r2c[-1]":       {Sheet: "Sheet1", Row: 1, Col: 0, ColRel: true},
+		"Sheet2!R[1]C5": {Sheet: "Sheet2", Row: 5, Col: 4, RowRel: true},
+	}
+	for s, want := range cases {
+		got, err := ParseCellR1C1(s, anchor)
+		if err != nil {
+			t.Errorf("ParseCellR1C1(%s) failed with %s", s, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseCellR1C1(%s) = %+v; want %+v", s, got, want)
+		}
+	}
+	for _, s := range []string{"", "R", "C2", "R0C1", "RC[-2]", "R[-5]C", "A1", "R1C1:R2C2"} {
+		if got, err := ParseCellR1C1(s, anchor); err == nil {
+			t.Errorf("ParseCellR1C1(%s) = %+v; want error", s, got)
+		}
+	}
+}
+
+func TestRangeR1C1(t *testing.T) {
+	anchor := Cell{Sheet: "Sheet1", Row: 4, Col: 1} // B5
+	cases := map[string]string{
+		"R1C1:R[5]C":         "$A$1:B10",
+		"R2":                 "$2:$2",
+		"R[-1]:R":            "4:5",
+		"C[-1]:C3":           "A:$C",
+		"Sheet2!C":           "Sheet2!B:B",
+		"R1C1:Data!R2C2":     "$A$1:$B$2",
+		"R[-4]C:R[1048571]C": "B1:B1048576",
+	}
+	for s, want := range cases {
+		r, err := ParseRangeR1C1(s, anchor)
+		if err != nil {
+			t.Errorf("ParseRangeR1C1(%s) failed with %s", s, err)
+			continue
+		}
+		if got := r.StringRel("Sheet1"); got != want {
+			t.Errorf("ParseRangeR1C1(%s) = %s; want %s", s, got, want)
+		}
+		if back, err := ParseRangeR1C1(r.StringR1C1(anchor), anchor); err != nil || back != r {
+			t.Errorf("ParseRangeR1C1(%s) doesn't round trip through %s", s, r.StringR1C1(anchor))
+		}
+	}
+}
+
+func TestToR1C1(t *testing.T) {
+	anchor := Cell{Sheet: "Sheet1", Row: 4, Col: 1}
+	cases := map[Address]Cell{
+		"R[-4]C[-1]":    {Sheet: "Sheet1", Row: 0, Col: 0, RowRel: true, ColRel: true},
+		"R1C":           {Sheet: "Sheet1", Row: 0, Col: 1, ColRel: true},
+		"'My sheet'!RC": {Sheet: "My sheet", Row: 4, Col: 1, RowRel: true, ColRel: true},
+	}
+	for want, c := range cases {
+		if got := c.ToR1C1(anchor); got != want {
+			t.Errorf("%+v.ToR1C1() = %s; want %s", c, got, want)
+		}
+	}
+}
@@ -2,7 +2,8 @@ package xl
 
 import (
 	"errors"
-	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -15,21 +16,79 @@ type Range struct {
 func (r Range) String() string {
 	// Turns the range into a string.
 	// Always includes the sheet name at the beginning address.
-	end := string(r.End.ToAddress())
-	endNoSheet := strings.TrimPrefix(end, r.End.Sheet)
-	return string(r.Start.ToAddress()) + ":" + endNoSheet
+	return r.format(r.Start.Sheet != "")
 }
 
 func (r Range) StringRel(relativeSheetName string) string {
 	// Turns the range into a string, but with the sheet name
 	// removed from the start address if it matches the relativeSheetName.
-	unshiftedEnd, err := r.End.Shift(-1, -1)
+	return r.format(r.Start.Sheet != relativeSheetName)
+}
+
+func (r Range) format(withSheet bool) string {
+	var start, end string
+	switch {
+	case r.isWrittenWholeRow():
+		start = rowToLabel(r.Start.Row, r.Start.RowRel)
+		end = rowToLabel(r.End.Row-1, r.End.RowRel)
+	case r.isWrittenWholeColumn():
+		start = colToLabel(r.Start.Col, r.Start.ColRel)
+		end = colToLabel(r.End.Col-1, r.End.ColRel)
+	default:
+		unshiftedEnd, err := r.End.Shift(-1, -1)
+		if err != nil {
+			return "ERROR_STRINGIFYING_RANGE"
+		}
+		start = string(r.Start.ToAddressNoSheet())
+		end = string(unshiftedEnd.ToAddressNoSheet())
+	}
+	if withSheet {
+		start = QuoteSheetName(r.Start.Sheet) + "!" + start
+	}
+	return start + ":" + end
+}
+
+func rowToLabel(row uint32, rel bool) string {
+	label := strconv.Itoa(int(row + 1))
+	if !rel {
+		label = "$" + label
+	}
+	return label
+}
+
+func colToLabel(col uint16, rel bool) string {
+	label, err := columnToLetters(col)
 	if err != nil {
-		return "ERROR_STRINGIFYING_RANGE"
+		return ""
+	}
+	if !rel {
+		label = "$" + label
 	}
-	endNoSheet := unshiftedEnd.ToAddressNoSheet()
-	startRel := r.Start.ToAddressRel(relativeSheetName)
-	return fmt.Sprintf("%s:%s", startRel, endNoSheet)
+	return label
+}
+
+// IsWholeColumn returns true if the range spans all the rows of the sheet, e.g. A:B.
+// Like in Excel, A1:A1048576 is the same range as A:A.
+func (r Range) IsWholeColumn() bool {
+	return r.Start.Row == 0 && r.End.Row == MAX_ROWS
+}
+
+// IsWholeRow returns true if the range spans all the columns of the sheet, e.g. 1:2.
+// Like in Excel, A1:XFD1 is the same range as 1:1.
+func (r Range) IsWholeRow() bool {
+	return r.Start.Col == 0 && r.End.Col == MAX_COLS
+}
+
+// isWrittenWholeColumn tells whether the range is written as a whole column, e.g. A:B.
+// Ranges like A1:A1048576 keep their relative rows, and are written as they are.
+// Ranges with absolute rows like A$1:A$1048576 are the same reference as A:A.
+func (r Range) isWrittenWholeColumn() bool {
+	return r.IsWholeColumn() && !r.Start.RowRel && !r.End.RowRel
+}
+
+// isWrittenWholeRow tells whether the range is written as a whole row, e.g. 1:2, see isWrittenWholeColumn.
+func (r Range) isWrittenWholeRow() bool {
+	return r.IsWholeRow() && !r.Start.ColRel && !r.End.ColRel
 }
 
 func ParseRange(s string, sheetName string) (Range, error) {
@@ -37,6 +96,9 @@ func ParseRange(s string, sheetName string) (Range, error) {
 	if len(startEnd) != 2 {
 		return Range{}, errors.New("incompatible format")
 	}
+	if r, ok, err := parseWholeRange(startEnd[0], startEnd[1], sheetName); ok {
+		return r, err
+	}
 	startAddr, errStart := ParseAddress(startEnd[0])
 	endAddr, errEnd := ParseAddress(startEnd[1])
 	if errors.Join(errStart, errEnd) != nil {
@@ -62,8 +124,74 @@ func ParseRange(s string, sheetName string) (Range, error) {
 	return Range{startCell, endCell}, nil
 }
 
+var /* const */ wholeColumnRegex = regexp.MustCompile(`^(\$?)([A-Za-z]{1,3})$`)
+var /* const */ wholeRowRegex = regexp.MustCompile(`^(\$?)([0-9]+)$`)
+
+// parseWholeRange parses whole columns like A:B or $A:$B, and whole rows like 1:2 or $1:$2.
+// It returns false if the range is neither, so that it gets parsed as cells.
+//
+// Whole columns have absolute rows, so that shifting them only moves their columns,
+// and whole rows have absolute columns.
+func parseWholeRange(start string, end string, sheetName string) (Range, bool, error) {
+	startSplit, err := splitAddress(Address(start))
+	if err != nil {
+		return Range{}, false, nil
+	}
+	// Like with cells, a sheet name on the end is ignored
+	endSplit, err := splitAddress(Address(end))
+	if err != nil {
+		return Range{}, false, nil
+	}
+	startLocal, endLocal := string(startSplit.LocalAddress), string(endSplit.LocalAddress)
+	sheet := startSplit.Sheet
+	if sheet == "" {
+		sheet = sheetName
+	}
+
+	if startCol, endCol := wholeColumnRegex.FindStringSubmatch(startLocal), wholeColumnRegex.FindStringSubmatch(endLocal); startCol != nil && endCol != nil {
+		if sheet == "" {
+			return Range{}, true, errors.New("missing sheet prefix and fallback sheet name")
+		}
+		startIdx, errStart := lettersToColumn(startCol[2])
+		endIdx, errEnd := lettersToColumn(endCol[2])
+		if errors.Join(errStart, errEnd) != nil {
+			return Range{}, true, errors.New("column out of bounds")
+		}
+		return Range{
+			Start: Cell{Sheet: sheet, Row: 0, Col: startIdx, RowRel: false, ColRel: startCol[1] == ""},
+			End:   Cell{Sheet: sheet, Row: MAX_ROWS, Col: endIdx + 1, RowRel: false, ColRel: endCol[1] == ""},
+		}, true, nil
+	}
+
+	if startRow, endRow := wholeRowRegex.FindStringSubmatch(startLocal), wholeRowRegex.FindStringSubmatch(endLocal); startRow != nil && endRow != nil {
+		if sheet == "" {
+			return Range{}, true, errors.New("missing sheet prefix and fallback sheet name")
+		}
+		startIdx, errStart := strconv.Atoi(startRow[2])
+		endIdx, errEnd := strconv.Atoi(endRow[2])
+		if errors.Join(errStart, errEnd) != nil || startIdx < 1 || endIdx < 1 || startIdx > MAX_ROWS || endIdx > MAX_ROWS {
+			return Range{}, true, errors.New("row out of bounds")
+		}
+		return Range{
+			Start: Cell{Sheet: sheet, Row: uint32(startIdx - 1), Col: 0, RowRel: startRow[1] == "", ColRel: false},
+			End:   Cell{Sheet: sheet, Row: uint32(endIdx), Col: MAX_COLS, RowRel: endRow[1] == "", ColRel: false},
+		}, true, nil
+	}
+	return Range{}, false, nil
+}
+
 // Returns a list of all cells in the range.
-func (r Range) Cells() (cells []Cell) {
+// Whole columns and rows, which have millions of cells, have none:
+// see CellsIn to get the cells a sheet uses of them.
+func (r Range) Cells() []Cell {
+	if r.IsWholeColumn() || r.IsWholeRow() {
+		return nil
+	}
+	return r.cells()
+}
+
+// cells returns all the cells in the range, however many there are.
+func (r Range) cells() (cells []Cell) {
 	for i := r.Start.Row; i < r.End.Row; i++ {
 		for j := r.Start.Col; j < r.End.Col; j++ {
 			cells = append(cells, Cell{
@@ -77,3 +205,68 @@ func (r Range) Cells() (cells []Cell) {
 	}
 	return
 }
+
+// ClampTo cuts the whole columns and rows of a range to the used range of the sheet,
+// e.g. A:B on a sheet using A1:C10 becomes A1:B10. Other ranges are left untouched.
+func (r Range) ClampTo(s *Sheet) Range {
+	used := s.UsedRange()
+	if r.IsWholeColumn() {
+		r.End.Row = uint32(used.RowCount)
+	}
+	if r.IsWholeRow() {
+		r.End.Col = uint16(used.ColCount)
+	}
+	return r
+}
+
+// CellsIn returns the cells of the range, with whole columns and rows
+// clamped to the used range of the sheet.
+func (r Range) CellsIn(s *Sheet) []Cell {
+	return r.ClampTo(s).cells()
+}
+
+// Normalize returns the same range, but with Start as its top-left
+// corner and End as its bottom-right corner, e.g. B2:A1 becomes A1:B2.
+func (r Range) Normalize() Range {
+	if r.End.Row == 0 || r.End.Col == 0 {
+		return r
+	}
+	startRow, endRow := r.Start.Row, r.End.Row-1
+	startCol, endCol := r.Start.Col, r.End.Col-1
+	if startRow > endRow {
+		startRow, endRow = endRow, startRow
+	}
+	if startCol > endCol {
+		startCol, endCol = endCol, startCol
+	}
+	start := r.Start
+	start.Row, start.Col = startRow, startCol
+	end := r.End
+	end.Row, end.Col = endRow+1, endCol+1
+	return Range{start, end}
+}
+
+// Contains returns true if the cell is inside the range,
+// regardless of their relativeness.
+func (r Range) Contains(c Cell) bool {
+	return c.Sheet == r.Start.Sheet &&
+		c.Row >= r.Start.Row && c.Row < r.End.Row &&
+		c.Col >= r.Start.Col && c.Col < r.End.Col
+}
+
+// Intersect returns the overlap of two ranges of the same sheet,
+// and false if they don't overlap.
+func (r Range) Intersect(other Range) (Range, bool) {
+	if r.Start.Sheet != other.Start.Sheet {
+		return Range{}, false
+	}
+	start, end := r.Start, r.End
+	start.Row = max(r.Start.Row, other.Start.Row)
+	start.Col = max(r.Start.Col, other.Start.Col)
+	end.Row = min(r.End.Row, other.End.Row)
+	end.Col = min(r.End.Col, other.End.Col)
+	if start.Row >= end.Row || start.Col >= end.Col {
+		return Range{}, false
+	}
+	return Range{start, end}, true
+}
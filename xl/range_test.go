@@ -12,7 +12,9 @@ func TestParseRange_Bad(t *testing.T) {
 		"A1:",
 		":B1",
 		// "A1:B1",
-		"B:C", // We don't support column ranges yet/ever
+		"B:2",
+		"0:1",
+		"XFE:XFE",
 	}
 	for _, strAddress := range badAddresses {
 		cellRange, err := ParseRange(strAddress, "Sheet1")
@@ -36,10 +38,15 @@ func TestParseRange_Good(t *testing.T) {
 		"Sheet2!A1:B1",
 		"Sheet2!A1:Sheet2!B1", // weird but allowed and implicitly fixed to Sheet2!A1:B1
 		"Sheet2!A1:Sheet1!B1", // weird but allowed and implicitly fixed to Sheet2!A1:B1
+		"B:C",
+		"$B:$D",
+		"Sheet2!1:1",
+		"$2:3",
 	}
 	for _, strAddress := range goodAddresses {
 		testName := strings.ReplaceAll(strAddress, ":", "_")
 		testName = strings.ReplaceAll(testName, "!", "_")
+		testName = strings.ReplaceAll(testName, "$", "_")
 		t.Run("TestParseRange_Good_"+testName, func(tt *testing.T) {
 			cellRange, err := ParseRange(strAddress, "Sheet1")
 			if err != nil {
@@ -50,3 +57,61 @@ func TestParseRange_Good(t *testing.T) {
 		})
 	}
 }
+
+func TestRangeStringWhole(t *testing.T) {
+	testCases := map[string]string{
+		"B:C":             "Sheet1!B:C",
+		"$B:$D":           "Sheet1!$B:$D",
+		"'My sheet'!1:1":  "'My sheet'!1:1",
+		"$2:3":            "Sheet1!$2:3",
+		"$A:A":            "Sheet1!$A:A",
+		"A$1:A$1048576":   "Sheet1!A:A",
+		"$A2:$XFD3":       "Sheet1!2:3",
+		"A1:A1048576":     "Sheet1!A1:A1048576",
+		"A2:XFD3":         "Sheet1!A2:XFD3",
+		"Sheet2!A1:B2":    "Sheet2!A1:B2",
+		"Sheet2!$A$1:B$2": "Sheet2!$A$1:B$2",
+	}
+	for address, want := range testCases {
+		cellRange, err := ParseRange(address, "Sheet1")
+		if err != nil {
+			t.Errorf("ParseRange(%s) failed with %s", address, err)
+			continue
+		}
+		if got := cellRange.String(); got != want {
+			t.Errorf("ParseRange(%s).String() = %s; want %s", address, got, want)
+		}
+	}
+}
+
+func TestRangeCellsIn(t *testing.T) {
+	sheet := Sheet{Name: "Sheet1", Content: [][]CVal{
+		{CValEmpty, CValEmpty, CValEmpty},
+		{CValEmpty, CValEmpty, CValEmpty},
+	}}
+	column, _ := ParseRange("B:C", "Sheet1")
+	if cells := column.CellsIn(&sheet); len(cells) != 4 {
+		t.Errorf("B:C has %d cells in the sheet; want 4", len(cells))
+	}
+	row, _ := ParseRange("2:2", "Sheet1")
+	if cells := row.CellsIn(&sheet); len(cells) != 3 || cells[0].Row != 1 {
+		t.Errorf("2:2 has cells %v in the sheet; want the 3 cells of row 2", cells)
+	}
+	bounded, _ := ParseRange("A1:D4", "Sheet1")
+	if cells := bounded.CellsIn(&sheet); len(cells) != 16 {
+		t.Errorf("A1:D4 has %d cells in the sheet; want 16", len(cells))
+	}
+}
+
+func TestRangeCellsWhole(t *testing.T) {
+	for _, address := range []string{"A:A", "A1:A1048576", "2:2"} {
+		r, _ := ParseRange(address, "Sheet1")
+		if cells := r.Cells(); cells != nil {
+			t.Errorf("%s has %d cells; want none", address, len(cells))
+		}
+	}
+	bounded, _ := ParseRange("A1:B2", "Sheet1")
+	if cells := bounded.Cells(); len(cells) != 4 {
+		t.Errorf("A1:B2 has %d cells; want 4", len(cells))
+	}
+}
@@ -11,12 +11,17 @@ type RawSheet struct {
 	Content [][]any `json:"content" binding:"required"`
 	// The computed values of formulas in the sheet, if known.
 	// If not provided, the computed values will be of size 0.
+	// Texts like #N/A are errors here, while they stay texts in Content.
 	Computed [][]any `json:"computed"`
 }
 
 type Sheet struct {
 	Name    string   `json:"name"`
 	Content [][]CVal `json:"content"`
+	// Ranges dynamic array formulas spill over, see Sheet.Spill
+	Spills []Spill `json:"spills,omitempty"`
+	// Ranges dynamic array formulas would spill over, but which aren't empty
+	Blocked []Spill `json:"blocked,omitempty"`
 }
 
 type UsedRange struct {
@@ -31,6 +36,45 @@ func (s *Sheet) Get(c Cell) (CVal, error) {
 	return s.Content[c.Row][c.Col], nil
 }
 
+// Set sets the value of a cell. If the cell is outside of the sheet's content,
+// the content is grown with empty cells so that it stays rectangular.
+// Rows all have the width of the sheet, so only widening the sheet goes through all of them.
+func (s *Sheet) Set(c Cell, v CVal) error {
+	if int(c.Row) >= MAX_ROWS || int(c.Col) >= MAX_COLS {
+		return errors.New("cell is out of bounds")
+	}
+	width := s.UsedRange().ColCount
+	if int(c.Col) >= width {
+		width = int(c.Col) + 1
+		for i, row := range s.Content {
+			s.Content[i] = padRow(row, width)
+		}
+	}
+	for len(s.Content) <= int(c.Row) {
+		s.Content = append(s.Content, padRow(nil, width))
+	}
+	if len(s.Content[c.Row]) <= int(c.Col) {
+		// Only rows set by hand can be shorter than the first one
+		s.Content[c.Row] = padRow(s.Content[c.Row], width)
+	}
+	s.Content[c.Row][c.Col] = v
+	return nil
+}
+
+// padRow returns row grown with empty cells up to width.
+func padRow(row []CVal, width int) []CVal {
+	if len(row) >= width {
+		return row
+	}
+	if cap(row) < width {
+		row = append(make([]CVal, 0, width), row...)
+	}
+	for len(row) < width {
+		row = append(row, CValEmpty)
+	}
+	return row
+}
+
 func (s *Sheet) GetRange(c Range) ([][]CVal, error) {
 	vals := make([][]CVal, 0)
 	for i := c.Start.Row; i < c.End.Row; i++ {
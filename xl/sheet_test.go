@@ -118,3 +118,76 @@ func TestToSheet_Computed(t *testing.T) {
 	}
 	cupaloy.SnapshotT(t, parsedSheet)
 }
+
+func TestToSheet_Errors(t *testing.T) {
+	sheetStr := `{
+        "name": "Sheet1",
+        "content": [["#N/A", "=1/0", "=NA()", "#NOPE"]],
+        "computed": [[null, "#DIV/0!", "#n/a", null]]
+    }`
+	var rawSheet RawSheet
+	if err := json.Unmarshal([]byte(sheetStr), &rawSheet); err != nil {
+		t.Fatalf("json.Unmarshal failed with %s", err)
+	}
+	sheet, err := rawSheet.ToSheet()
+	if err != nil {
+		t.Fatalf("rawSheet.ToSheet failed with %s", err)
+	}
+	row := sheet.Content[0]
+	// Only the computed values of formulas are errors written as text
+	if row[0].Type != CTString || row[0].ValString != "#N/A" {
+		t.Errorf("A1 = %v; want the text #N/A", row[0])
+	}
+	if computed := row[1].Computed(); computed.Type != CTError || computed.ValError != ErrorDiv0 {
+		t.Errorf("B1 computed = %v; want #DIV/0!", computed)
+	}
+	if computed := row[2].Computed(); computed.Type != CTError || computed.ValError != ErrorNA {
+		t.Errorf("C1 computed = %v; want #N/A", computed)
+	}
+	if row[3].Type != CTString {
+		t.Errorf("D1 = %v; want the text #NOPE", row[3])
+	}
+
+	data, err := json.Marshal(CVal{Type: CTError, ValError: ErrorNA})
+	if err != nil {
+		t.Fatalf("json.Marshal failed with %s", err)
+	}
+	if string(data) != `{"err":"#N/A"}` {
+		t.Errorf("json.Marshal(A1) = %s; want {\"err\":\"#N/A\"}", data)
+	}
+	var cval CVal
+	if err := json.Unmarshal([]byte(`{"err":"#nope"}`), &cval); err == nil {
+		t.Errorf("json.Unmarshal accepted an unknown error code")
+	}
+}
+
+func TestSheetSet(t *testing.T) {
+	sheet := Sheet{Name: "Sheet1"}
+	for _, c := range []Cell{{Row: 1, Col: 0}, {Row: 0, Col: 2}, {Row: 3, Col: 1}} {
+		if err := sheet.Set(c, CVal{Type: CTNumber, ValNumber: float32(c.Row)}); err != nil {
+			t.Fatalf("Set(%v) failed with %s", c, err)
+		}
+	}
+	if used := sheet.UsedRange(); used.RowCount != 4 || used.ColCount != 3 {
+		t.Errorf("used range = %+v; want 4 rows and 3 columns", used)
+	}
+	for i, row := range sheet.Content {
+		if len(row) != 3 {
+			t.Errorf("row %d has %d cells; want 3", i, len(row))
+		}
+	}
+	if got := sheet.Content[2][2].Type; got != CTEmpty {
+		t.Errorf("C3 has type %s; want empty", got)
+	}
+}
+
+func BenchmarkSheetSet(b *testing.B) {
+	sheet := Sheet{Name: "Sheet1"}
+	for i := 0; i < 100_000; i++ {
+		_ = sheet.Set(Cell{Row: uint32(i), Col: 3}, CValEmpty)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = sheet.Set(Cell{Row: uint32(i % 100_000), Col: uint16(i % 4)}, CValEmpty)
+	}
+}
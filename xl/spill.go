@@ -0,0 +1,141 @@
+package xl
+
+import (
+	"errors"
+	"slices"
+)
+
+// Spill is the range a dynamic array formula spills its values over,
+// e.g. C3:D4 for =A1:B2 in C3. The formula is in its anchor, the top left cell.
+// Both are in the sheet, with RowRel and ColRel set to false.
+type Spill struct {
+	Anchor Cell  `json:"anchor"`
+	Range  Range `json:"range"`
+}
+
+// Spill records the array computed by the formula in anchor: its first value is
+// the computed value of the formula, and the others the computed values of the
+// empty cells below and to the right of it, growing the sheet as needed.
+// The previous spill of the formula is cleared first.
+//
+// If any of those cells isn't empty or is already spilled over, or if they go
+// past the end of the sheet, nothing is spilled and the formula computes to #SPILL!,
+// which is returned as the error. The range it would spill over is then remembered
+// until it spills again, see BlockedSpills.
+func (s *Sheet) Spill(anchor Cell, values [][]CVal) error {
+	anchor = s.spillKey(anchor)
+	val, err := s.Get(anchor)
+	if err != nil || val.Type != CTFormula {
+		return errors.New("spill anchor is not a formula")
+	}
+	if len(values) == 0 || len(values[0]) == 0 {
+		return errors.New("nothing to spill")
+	}
+	s.ClearSpill(anchor)
+
+	end := Cell{Sheet: s.Name, Row: anchor.Row + uint32(len(values)), Col: anchor.Col + uint16(len(values[0]))}
+	if int(anchor.Row)+len(values) > MAX_ROWS || int(anchor.Col)+len(values[0]) > MAX_COLS {
+		return s.blockSpill(Spill{Anchor: anchor})
+	}
+	spill := Spill{Anchor: anchor, Range: Range{Start: anchor, End: end}}
+	for _, c := range spill.Range.cells() {
+		if c = s.spillKey(c); c == anchor {
+			continue
+		}
+		if val, err := s.Get(c); err == nil && (val.Type != CTEmpty || val.HasComputed) {
+			return s.blockSpill(spill)
+		}
+		if _, ok := s.SpillOwner(c); ok {
+			return s.blockSpill(spill)
+		}
+	}
+
+	for i, row := range values {
+		for j, v := range row {
+			c := Cell{Sheet: s.Name, Row: anchor.Row + uint32(i), Col: anchor.Col + uint16(j)}
+			if c == anchor {
+				s.Content[c.Row][c.Col].SetComputed(v)
+				continue
+			}
+			spilled := CValEmpty
+			spilled.SetComputed(v)
+			if err := s.Set(c, spilled); err != nil {
+				return err
+			}
+		}
+	}
+	s.Spills = append(s.Spills, spill)
+	return nil
+}
+
+// blockSpill makes the formula in the anchor of spill compute to #SPILL!, and remembers
+// the range it would spill over, unless it goes past the end of the sheet.
+func (s *Sheet) blockSpill(spill Spill) error {
+	s.Content[spill.Anchor.Row][spill.Anchor.Col].SetComputed(CVal{Type: CTError, ValError: ErrorSpill})
+	if spill.Range != (Range{}) {
+		s.Blocked = append(s.Blocked, spill)
+	}
+	return ErrorSpill
+}
+
+// BlockedSpills returns the anchors of the formulas whose spill is blocked,
+// and would spill over c: they may spill once c is changed.
+func (s *Sheet) BlockedSpills(c Cell) (anchors []Cell) {
+	c = s.spillKey(c)
+	for _, spill := range s.Blocked {
+		if spill.Anchor != c && spill.Range.Contains(c) {
+			anchors = append(anchors, spill.Anchor)
+		}
+	}
+	return
+}
+
+// ClearSpill empties the cells the formula in anchor spilled over, if any,
+// and returns false if it didn't spill. A blocked spill of the formula is forgotten.
+func (s *Sheet) ClearSpill(anchor Cell) bool {
+	anchor = s.spillKey(anchor)
+	s.Blocked = slices.DeleteFunc(s.Blocked, func(spill Spill) bool { return spill.Anchor == anchor })
+	i := slices.IndexFunc(s.Spills, func(spill Spill) bool { return spill.Anchor == anchor })
+	if i < 0 {
+		return false
+	}
+	for _, c := range s.Spills[i].Range.cells() {
+		if c = s.spillKey(c); c == anchor || !c.IsInBounds(s) {
+			continue
+		}
+		if s.Content[c.Row][c.Col].Type == CTEmpty {
+			s.Content[c.Row][c.Col] = CValEmpty
+		}
+	}
+	s.Spills = slices.Delete(s.Spills, i, i+1)
+	return true
+}
+
+// SpillRange returns the range the formula in anchor spills over, its anchor included,
+// which is what anchor# refers to in formulas, e.g. C3# for C3:D4.
+func (s *Sheet) SpillRange(anchor Cell) (Range, bool) {
+	anchor = s.spillKey(anchor)
+	for _, spill := range s.Spills {
+		if spill.Anchor == anchor {
+			return spill.Range, true
+		}
+	}
+	return Range{}, false
+}
+
+// SpillOwner returns the anchor of the formula spilling over c, if any.
+// The anchor of a spill owns itself.
+func (s *Sheet) SpillOwner(c Cell) (Cell, bool) {
+	c = s.spillKey(c)
+	for _, spill := range s.Spills {
+		if spill.Range.Contains(c) {
+			return spill.Anchor, true
+		}
+	}
+	return Cell{}, false
+}
+
+// spillKey returns c the way spills are recorded, in the sheet and without relativeness.
+func (s *Sheet) spillKey(c Cell) Cell {
+	return Cell{Sheet: s.Name, Row: c.Row, Col: c.Col}
+}
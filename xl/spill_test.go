@@ -0,0 +1,71 @@
+package xl
+
+import "testing"
+
+func TestSheetSpill(t *testing.T) {
+	raw := RawSheet{
+		Name: "Sheet1",
+		Content: [][]any{
+			{1, 2, "=A1:B2"},
+			{3, 4, nil},
+		},
+	}
+	sheet, err := raw.ToSheet()
+	if err != nil {
+		t.Fatalf("ToSheet failed with %s", err)
+	}
+	anchor := Cell{Sheet: "Sheet1", Row: 0, Col: 2}
+	values := [][]CVal{
+		{{Type: CTNumber, ValNumber: 1}, {Type: CTNumber, ValNumber: 2}},
+		{{Type: CTNumber, ValNumber: 3}, {Type: CTNumber, ValNumber: 4}},
+	}
+	if err := sheet.Spill(anchor, values); err != nil {
+		t.Fatalf("Spill failed with %s", err)
+	}
+	r, ok := sheet.SpillRange(anchor)
+	if !ok || r.String() != "Sheet1!$C$1:$D$2" {
+		t.Errorf("SpillRange = %s, %t; want Sheet1!$C$1:$D$2", r, ok)
+	}
+	d2 := Cell{Sheet: "Sheet1", Row: 1, Col: 3}
+	if val, _ := sheet.Get(d2); val.Type != CTEmpty || val.Computed().ValNumber != 4 {
+		t.Errorf("D2 = %v; want an empty cell computed to 4", val)
+	}
+	if owner, ok := sheet.SpillOwner(d2); !ok || owner != anchor {
+		t.Errorf("SpillOwner(D2) = %s, %t; want C1", owner.ToAddress(), ok)
+	}
+	if _, ok := sheet.SpillOwner(Cell{Sheet: "Sheet1", Row: 0, Col: 0}); ok {
+		t.Errorf("A1 is owned by a spill")
+	}
+
+	// Blocked by a value written over the spill
+	if err := sheet.Set(d2, CVal{Type: CTString, ValString: "x"}); err != nil {
+		t.Fatalf("Set failed with %s", err)
+	}
+	if err := sheet.Spill(anchor, values); err != ErrorSpill {
+		t.Errorf("Spill returned %v; want #SPILL!", err)
+	}
+	if val, _ := sheet.Get(anchor); val.Computed().ValError != ErrorSpill {
+		t.Errorf("C1 = %v; want #SPILL!", val)
+	}
+	if _, ok := sheet.SpillRange(anchor); ok {
+		t.Errorf("blocked spill was recorded")
+	}
+	if val, _ := sheet.Get(Cell{Sheet: "Sheet1", Row: 1, Col: 2}); val.HasComputed {
+		t.Errorf("C2 = %v; want it cleared with the previous spill", val)
+	}
+}
+
+func TestSheetSpillOutOfBounds(t *testing.T) {
+	anchor := Cell{Sheet: "Sheet1", Row: MAX_ROWS - 1, Col: 0}
+	sheet := Sheet{Name: "Sheet1"}
+	if err := sheet.Set(anchor, CVal{Type: CTFormula, ValFormula: "=A1:A2"}); err != nil {
+		t.Fatalf("Set failed with %s", err)
+	}
+	values := [][]CVal{{{Type: CTNumber, ValNumber: 1}}, {{Type: CTNumber, ValNumber: 2}}}
+	if err := sheet.Spill(anchor, values); err != ErrorSpill {
+		t.Errorf("Spill returned %v; want #SPILL!", err)
+	}
+	if ok := sheet.ClearSpill(anchor); ok {
+		t.Errorf("ClearSpill found a spill")
+	}
+}
@@ -0,0 +1,201 @@
+package xl
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// Table is an Excel table: a range of a sheet with named columns,
+// referenced in formulas with structured references like Table1[Sales].
+type Table struct {
+	Name string `json:"name"`
+	// Whole table, header and totals rows included
+	Ref     Range    `json:"ref"`
+	Columns []string `json:"columns"`
+	// Whether the first row holds the column names
+	Headers bool `json:"headers"`
+	// Whether the last row holds totals
+	Totals bool `json:"totals"`
+}
+
+// TableItem is a special item of a structured reference, e.g. #Headers.
+type TableItem string
+
+const (
+	TableAll     TableItem = "#All"
+	TableData    TableItem = "#Data"
+	TableHeaders TableItem = "#Headers"
+	TableTotals  TableItem = "#Totals"
+	// Written @ in short, e.g. [@Sales]
+	TableThisRow TableItem = "#This Row"
+)
+
+// TableItems lists every special item of structured references.
+var TableItems = []TableItem{TableAll, TableData, TableHeaders, TableTotals, TableThisRow}
+
+// ParseTableItem returns the special item written as s, case-insensitively like Excel does.
+func ParseTableItem(s string) (TableItem, error) {
+	for _, item := range TableItems {
+		if strings.EqualFold(s, string(item)) {
+			return item, nil
+		}
+	}
+	return "", errors.New("unknown table item")
+}
+
+// TableRef is what a structured reference refers to, e.g. Table1[[#Headers],[Sales]:[Cost]].
+type TableRef struct {
+	// Name of the table, "" for the table the formula is in, e.g. [@Sales]
+	Table string `json:"table,omitempty"`
+	// Special items, none meaning #Data
+	Items []TableItem `json:"items,omitempty"`
+	// First and last columns, "" for all of them
+	StartColumn string `json:"startColumn,omitempty"`
+	EndColumn   string `json:"endColumn,omitempty"`
+}
+
+func (r TableRef) IsEq(other TableRef) bool {
+	return strings.EqualFold(r.Table, other.Table) &&
+		slices.Equal(r.Items, other.Items) &&
+		strings.EqualFold(r.StartColumn, other.StartColumn) &&
+		strings.EqualFold(r.EndColumn, other.EndColumn)
+}
+
+// Tables is the list of tables of a workbook.
+type Tables []Table
+
+// Get returns the table with the given name, matched case-insensitively.
+func (t Tables) Get(name string) (*Table, bool) {
+	for i := range t {
+		if strings.EqualFold(t[i].Name, name) {
+			return &t[i], true
+		}
+	}
+	return nil, false
+}
+
+// At returns the table containing c, if any.
+func (t Tables) At(c Cell) (*Table, bool) {
+	for i := range t {
+		if t[i].Ref.Contains(c) {
+			return &t[i], true
+		}
+	}
+	return nil, false
+}
+
+// Resolve returns the range a structured reference located in host refers to.
+// The host tells which table [@Sales] is about, and which row is #This Row.
+func (t Tables) Resolve(ref TableRef, host Cell) (Range, error) {
+	var table *Table
+	var ok bool
+	if ref.Table == "" {
+		table, ok = t.At(host)
+	} else {
+		table, ok = t.Get(ref.Table)
+	}
+	if !ok {
+		return Range{}, errors.New("table not found")
+	}
+	return table.Resolve(ref, host)
+}
+
+// Resolve returns the range of the table a structured reference refers to,
+// ignoring its table name. See Tables.Resolve.
+func (t *Table) Resolve(ref TableRef, host Cell) (Range, error) {
+	ref = ref.normalize()
+	start, end := t.Ref.Start, t.Ref.End
+	if ref.StartColumn != "" {
+		first, ok := t.column(ref.StartColumn)
+		if !ok {
+			return Range{}, errors.New("column not found")
+		}
+		last, ok := t.column(ref.EndColumn)
+		if !ok {
+			return Range{}, errors.New("column not found")
+		}
+		start.Col, end.Col = t.Ref.Start.Col+min(first, last), t.Ref.Start.Col+max(first, last)+1
+	}
+
+	rows := make([][2]uint32, len(ref.Items))
+	for i, item := range ref.Items {
+		first, last, err := t.rows(item, host)
+		if err != nil {
+			return Range{}, err
+		}
+		rows[i] = [2]uint32{first, last}
+	}
+	slices.SortFunc(rows, func(a, b [2]uint32) int { return int(a[0]) - int(b[0]) })
+	start.Row, end.Row = rows[0][0], rows[0][1]
+	for _, r := range rows[1:] {
+		// #Headers and #Totals can't go together without #Data
+		if r[0] > end.Row {
+			return Range{}, errors.New("table items are not contiguous")
+		}
+		end.Row = max(end.Row, r[1])
+	}
+	if start.Row >= end.Row {
+		// Like a table without data rows
+		return Range{}, errors.New("table items are empty")
+	}
+	return Range{
+		Start: Cell{Sheet: start.Sheet, Row: start.Row, Col: start.Col},
+		End:   Cell{Sheet: start.Sheet, Row: end.Row, Col: end.Col},
+	}, nil
+}
+
+// normalize fills in the defaults: #Data without items, and a single column span.
+func (r TableRef) normalize() TableRef {
+	if len(r.Items) == 0 {
+		r.Items = []TableItem{TableData}
+	}
+	if r.EndColumn == "" {
+		r.EndColumn = r.StartColumn
+	}
+	return r
+}
+
+// column returns the index of a column, matched case-insensitively.
+func (t *Table) column(name string) (uint16, bool) {
+	for i, col := range t.Columns {
+		if strings.EqualFold(col, name) {
+			return uint16(i), true
+		}
+	}
+	return 0, false
+}
+
+// rows returns the rows of an item, end excluded.
+func (t *Table) rows(item TableItem, host Cell) (uint32, uint32, error) {
+	dataStart, dataEnd := t.Ref.Start.Row, t.Ref.End.Row
+	if t.Headers {
+		dataStart++
+	}
+	if t.Totals {
+		dataEnd--
+	}
+	switch item {
+	case TableAll:
+		return t.Ref.Start.Row, t.Ref.End.Row, nil
+	case TableData:
+		return dataStart, dataEnd, nil
+	case TableHeaders:
+		if !t.Headers {
+			return 0, 0, errors.New("table has no header row")
+		}
+		return t.Ref.Start.Row, dataStart, nil
+	case TableTotals:
+		if !t.Totals {
+			return 0, 0, errors.New("table has no totals row")
+		}
+		return dataEnd, t.Ref.End.Row, nil
+	case TableThisRow:
+		if host.Row < dataStart || host.Row >= dataEnd {
+			return 0, 0, errors.New("this row is outside of the table data")
+		}
+		return host.Row, host.Row + 1, nil
+	default:
+		return 0, 0, errors.New("unknown table item")
+	}
+}
@@ -0,0 +1,57 @@
+package xl
+
+import "testing"
+
+func TestTablesResolve(t *testing.T) {
+	// Headers in row 2, data in rows 3 to 5, totals in row 6
+	ref, err := ParseRange("B2:D6", "Sheet1")
+	if err != nil {
+		t.Fatalf("ParseRange failed with %s", err)
+	}
+	tables := Tables{{Name: "Sales", Ref: ref, Columns: []string{"Region", "Qty", "Price"}, Headers: true, Totals: true}}
+	host, _ := ParseCell("E4", "Sheet1")
+	inTable, _ := ParseCell("D4", "Sheet1")
+
+	cases := []struct {
+		ref  TableRef
+		host Cell
+		want string
+	}{
+		{TableRef{Table: "Sales"}, host, "Sheet1!$B$3:$D$5"},
+		{TableRef{Table: "sales", StartColumn: "qty"}, host, "Sheet1!$C$3:$C$5"},
+		{TableRef{Table: "Sales", StartColumn: "Price", EndColumn: "Region"}, host, "Sheet1!$B$3:$D$5"},
+		{TableRef{Table: "Sales", Items: []TableItem{TableAll}}, host, "Sheet1!$B$2:$D$6"},
+		{TableRef{Table: "Sales", Items: []TableItem{TableHeaders, TableData}, StartColumn: "Qty"}, host, "Sheet1!$C$2:$C$5"},
+		{TableRef{Table: "Sales", Items: []TableItem{TableTotals}}, host, "Sheet1!$B$6:$D$6"},
+		{TableRef{Table: "Sales", Items: []TableItem{TableThisRow}, StartColumn: "Qty"}, host, "Sheet1!$C$4:$C$4"},
+		{TableRef{Items: []TableItem{TableThisRow}, StartColumn: "Region"}, inTable, "Sheet1!$B$4:$B$4"},
+	}
+	for _, c := range cases {
+		got, err := tables.Resolve(c.ref, c.host)
+		if err != nil {
+			t.Errorf("Resolve(%+v) failed with %s", c.ref, err)
+			continue
+		}
+		if got.String() != c.want {
+			t.Errorf("Resolve(%+v) = %s; want %s", c.ref, got, c.want)
+		}
+	}
+
+	outside, _ := ParseCell("E9", "Sheet1")
+	bad := []struct {
+		ref  TableRef
+		host Cell
+	}{
+		{TableRef{Table: "Nope"}, host},
+		{TableRef{Table: "Sales", StartColumn: "Nope"}, host},
+		{TableRef{Table: "Sales", Items: []TableItem{TableHeaders, TableTotals}}, host},
+		{TableRef{Table: "Sales", Items: []TableItem{TableThisRow}}, outside},
+		// Not in a table
+		{TableRef{StartColumn: "Qty"}, host},
+	}
+	for _, c := range bad {
+		if _, err := tables.Resolve(c.ref, c.host); err == nil {
+			t.Errorf("Resolve(%+v) should have failed", c.ref)
+		}
+	}
+}
@@ -1,11 +1,107 @@
 package xl
 
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
 type RawWorkbook struct {
 	Name   string     `json:"name"`
 	Sheets []RawSheet `json:"sheets"`
 }
 
+// ToWorkbook turns every raw sheet into a sheet, see RawSheet.ToSheet.
+func (w *RawWorkbook) ToWorkbook() (Workbook, error) {
+	wb := Workbook{Name: w.Name, Sheets: make([]Sheet, 0, len(w.Sheets))}
+	for i := range w.Sheets {
+		sheet, err := w.Sheets[i].ToSheet()
+		if err != nil {
+			return Workbook{}, err
+		}
+		wb.Sheets = append(wb.Sheets, sheet)
+	}
+	return wb, nil
+}
+
 type Workbook struct {
 	Name   string  `json:"name"`
 	Sheets []Sheet `json:"sheets"`
+	// Defined names of the workbook and its sheets,
+	// best edited through a parser.NameManager
+	Names DefinedNames `json:"names,omitempty"`
+	// Tables of the sheets, referenced by structured references
+	Tables Tables `json:"tables,omitempty"`
+
+	// Notified of changes made through SetCell, if set
+	Calc Calculator `json:"-"`
+}
+
+// GetSheet returns the sheet with the given name, if it exists.
+// Like in Excel, sheet names are matched case-insensitively.
+// The returned pointer aliases the workbook's sheet, so edits are visible in the workbook.
+func (w *Workbook) GetSheet(name string) (*Sheet, bool) {
+	for i := range w.Sheets {
+		if strings.EqualFold(w.Sheets[i].Name, name) {
+			return &w.Sheets[i], true
+		}
+	}
+	return nil, false
+}
+
+// SheetSpan returns the sheets from first to last in the order of the workbook,
+// like Excel does for 3D references such as Jan:Dec!B5.
+// The two sheets can be given in any order.
+func (w *Workbook) SheetSpan(first string, last string) ([]*Sheet, error) {
+	i := slices.IndexFunc(w.Sheets, func(s Sheet) bool { return strings.EqualFold(s.Name, first) })
+	j := slices.IndexFunc(w.Sheets, func(s Sheet) bool { return strings.EqualFold(s.Name, last) })
+	if i < 0 || j < 0 {
+		return nil, errors.New("sheet not found")
+	}
+	if i > j {
+		i, j = j, i
+	}
+	sheets := make([]*Sheet, 0, j-i+1)
+	for k := i; k <= j; k++ {
+		sheets = append(sheets, &w.Sheets[k])
+	}
+	return sheets, nil
+}
+
+// ResolveName returns the definition of a name as seen from a formula in the given sheet,
+// see DefinedNames.ResolveName.
+func (w *Workbook) ResolveName(name string, sheet string) (DefinedName, bool) {
+	return w.Names.ResolveName(name, sheet)
+}
+
+// ResolveTableRef returns the range a structured reference located in host refers to,
+// see Tables.Resolve.
+func (w *Workbook) ResolveTableRef(ref TableRef, host Cell) (Range, error) {
+	return w.Tables.Resolve(ref, host)
+}
+
+// Calculator recomputes formulas when the cells they depend on change.
+// See the eval package for an implementation.
+type Calculator interface {
+	// CellChanged is called by Workbook.SetCell after the value of c changed.
+	CellChanged(w *Workbook, c Cell) error
+	// NamesChanged is called after the defined names of w were changed by a parser.NameManager.
+	NamesChanged(w *Workbook) error
+}
+
+// SetCell sets the value of a cell, growing its sheet if needed.
+// If the workbook has a Calculator, it is then asked to recompute
+// the formulas affected by the change.
+func (w *Workbook) SetCell(c Cell, value CVal) error {
+	sheet, ok := w.GetSheet(c.Sheet)
+	if !ok {
+		return errors.New("sheet not found")
+	}
+	if err := sheet.Set(c, value); err != nil {
+		return err
+	}
+	if w.Calc == nil {
+		return nil
+	}
+	return w.Calc.CellChanged(w, c)
 }
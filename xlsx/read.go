@@ -0,0 +1,336 @@
+// Package xlsx reads and writes .xlsx files, turning them into
+// the xl package's workbooks and back.
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/usr-ein/excelparser/parser"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+// Open reads an .xlsx file into a raw workbook, named after the file.
+func Open(filename string) (xl.RawWorkbook, error) {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return xl.RawWorkbook{}, errors.Wrap(err, "failed to open xlsx file")
+	}
+	defer zr.Close()
+	wb, err := readZip(&zr.Reader)
+	if err != nil {
+		return xl.RawWorkbook{}, err
+	}
+	wb.Name = filepath.Base(filename)
+	return wb, nil
+}
+
+// Read reads an .xlsx file of the given size into a raw workbook.
+func Read(r io.ReaderAt, size int64) (xl.RawWorkbook, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return xl.RawWorkbook{}, errors.Wrap(err, "failed to open xlsx file")
+	}
+	return readZip(zr)
+}
+
+func readZip(zr *zip.Reader) (xl.RawWorkbook, error) {
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+
+	var workbook xlsxWorkbook
+	if err := decodeFile(files, "xl/workbook.xml", &workbook); err != nil {
+		return xl.RawWorkbook{}, err
+	}
+	var rels xlsxRelationships
+	if err := decodeFile(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return xl.RawWorkbook{}, err
+	}
+	var sst xlsxSST
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeFile(files, "xl/sharedStrings.xml", &sst); err != nil {
+			return xl.RawWorkbook{}, err
+		}
+	}
+	sharedStrings := make([]string, len(sst.Items))
+	for i, si := range sst.Items {
+		sharedStrings[i] = si.String()
+	}
+
+	targets := make(map[string]string, len(rels.Relationships))
+	for _, rel := range rels.Relationships {
+		targets[rel.ID] = resolveTarget(rel.Target)
+	}
+
+	wb := xl.RawWorkbook{Sheets: make([]xl.RawSheet, 0, len(workbook.Sheets))}
+	for _, s := range workbook.Sheets {
+		target, ok := targets[s.RID]
+		if !ok {
+			return xl.RawWorkbook{}, errors.Errorf("no relationship for sheet %s", s.Name)
+		}
+		f, ok := files[target]
+		if !ok {
+			return xl.RawWorkbook{}, errors.Errorf("missing part %s for sheet %s", target, s.Name)
+		}
+		sheet, err := readSheet(f, s.Name, sharedStrings)
+		if err != nil {
+			return xl.RawWorkbook{}, errors.Wrapf(err, "failed to read sheet %s", s.Name)
+		}
+		wb.Sheets = append(wb.Sheets, sheet)
+	}
+	return wb, nil
+}
+
+// resolveTarget turns a relationship target of the workbook part into a path in the archive.
+func resolveTarget(target string) string {
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/")
+	}
+	return path.Join("xl", target)
+}
+
+func decodeFile(files map[string]*zip.File, name string, v any) error {
+	f, ok := files[name]
+	if !ok {
+		return errors.Errorf("missing part %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s", name)
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return errors.Wrapf(err, "failed to decode %s", name)
+	}
+	return nil
+}
+
+// sheetCell is a cell read from a worksheet, before being placed in the sheet's grid.
+type sheetCell struct {
+	row, col int
+	content  any
+	computed any
+	// Index of the shared formula the cell uses without holding its text, if any
+	sharedIndex *int
+}
+
+// sharedFormula is the master of a shared formula, written in its anchor cell only.
+type sharedFormula struct {
+	formula xl.Formula
+	anchor  xl.Cell
+	ref     xl.Range
+}
+
+// readSheet streams the rows of a worksheet, so that large sheets aren't decoded at once.
+func readSheet(f *zip.File, name string, sharedStrings []string) (xl.RawSheet, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return xl.RawSheet{}, err
+	}
+	defer rc.Close()
+
+	cells := make([]sheetCell, 0)
+	shared := make(map[int]sharedFormula)
+	rowCount, colCount := 0, 0
+	hasFormulas := false
+	decoder := xml.NewDecoder(rc)
+	nextRow := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return xl.RawSheet{}, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		var row xlsxRow
+		if err := decoder.DecodeElement(&row, &start); err != nil {
+			return xl.RawSheet{}, err
+		}
+		rowIdx := nextRow
+		if row.R > 0 {
+			rowIdx = row.R - 1
+		}
+		nextRow = rowIdx + 1
+		nextCol := 0
+		for _, c := range row.Cells {
+			i, j := rowIdx, nextCol
+			if c.R != "" {
+				cell, err := xl.ParseCell(c.R, name)
+				if err != nil {
+					return xl.RawSheet{}, errors.Wrapf(err, "invalid cell reference %s", c.R)
+				}
+				i, j = int(cell.Row), int(cell.Col)
+			}
+			nextCol = j + 1
+			content, computed, err := cellValues(c, sharedStrings)
+			if err != nil {
+				return xl.RawSheet{}, errors.Wrapf(err, "invalid cell %s", c.R)
+			}
+			cell := sheetCell{row: i, col: j, content: content, computed: computed}
+			if c.F != nil && c.F.T == "shared" && c.F.Si != nil {
+				if c.F.Text != "" {
+					anchor := xl.Cell{Sheet: name, Row: uint32(i), Col: uint16(j)}
+					ref, err := sharedRange(c.F.Ref, name)
+					if err != nil {
+						return xl.RawSheet{}, errors.Wrapf(err, "invalid shared formula range in %s", c.R)
+					}
+					shared[*c.F.Si] = sharedFormula{formula: xl.Formula(content.(string)), anchor: anchor, ref: ref}
+				} else {
+					cell.sharedIndex = c.F.Si
+					cell.computed = content
+					cell.content = nil
+				}
+			}
+			if cell.content == nil && cell.sharedIndex == nil {
+				continue
+			}
+			if c.F != nil {
+				hasFormulas = true
+			}
+			cells = append(cells, cell)
+			rowCount = max(rowCount, i+1)
+			colCount = max(colCount, j+1)
+		}
+	}
+
+	if err := expandSharedFormulas(cells, shared, name); err != nil {
+		return xl.RawSheet{}, err
+	}
+
+	sheet := xl.RawSheet{
+		Name:    name,
+		Content: makeGrid(rowCount, colCount),
+	}
+	if hasFormulas {
+		sheet.Computed = makeGrid(rowCount, colCount)
+	}
+	for _, c := range cells {
+		sheet.Content[c.row][c.col] = c.content
+		if hasFormulas {
+			sheet.Computed[c.row][c.col] = c.computed
+		}
+	}
+	return sheet, nil
+}
+
+// sharedRange parses the ref attribute of a shared formula, which is a single cell
+// when the formula is only shared with itself.
+func sharedRange(ref string, sheetName string) (xl.Range, error) {
+	if !strings.Contains(ref, ":") {
+		ref = ref + ":" + ref
+	}
+	return xl.ParseRange(ref, sheetName)
+}
+
+// expandSharedFormulas gives the cells using a shared formula their own copy of it,
+// with relative references moved from the anchor cell.
+// Cells whose references would be pushed off the sheet only keep their cached value,
+// like all the cells of a shared formula whose master can't be parsed.
+func expandSharedFormulas(cells []sheetCell, shared map[int]sharedFormula, name string) error {
+	expanded := make(map[int]map[xl.Cell]xl.Formula, len(shared))
+	for i := range cells {
+		c := &cells[i]
+		if c.sharedIndex == nil {
+			continue
+		}
+		formulas, ok := expanded[*c.sharedIndex]
+		if !ok {
+			master, ok := shared[*c.sharedIndex]
+			if !ok {
+				return errors.Errorf("no master for shared formula %d", *c.sharedIndex)
+			}
+			var err error
+			formulas, err = parser.ExpandSharedFormula(master.formula, master.anchor, master.ref)
+			var offSheet *parser.OffSheetError
+			if err != nil && !errors.As(err, &offSheet) {
+				// Only the master keeps its formula, which the parser doesn't support
+				formulas = nil
+			}
+			expanded[*c.sharedIndex] = formulas
+		}
+		formula, ok := formulas[xl.Cell{Sheet: name, Row: uint32(c.row), Col: uint16(c.col)}]
+		if ok {
+			c.content = string(formula)
+		} else {
+			c.content, c.computed = c.computed, nil
+		}
+	}
+	return nil
+}
+
+func makeGrid(rows int, cols int) [][]any {
+	grid := make([][]any, rows)
+	for i := range grid {
+		grid[i] = make([]any, cols)
+	}
+	return grid
+}
+
+// cellValues returns what the cell holds, in the form expected by xl.RawSheet,
+// and for formulas, their cached computed value.
+func cellValues(c xlsxC, sharedStrings []string) (content any, computed any, err error) {
+	value, err := cachedValue(c, sharedStrings)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.F != nil && c.F.Text != "" {
+		return "=" + c.F.Text, value, nil
+	}
+	return value, nil, nil
+}
+
+// cachedValue decodes the <v> value of a cell according to its type.
+func cachedValue(c xlsxC, sharedStrings []string) (any, error) {
+	// Texts are read as they are, even when they look like TRUE, #N/A or a formula
+	if c.T == "inlineStr" {
+		if c.Is == nil {
+			return nil, nil
+		}
+		return xl.Text(c.Is.String()), nil
+	}
+	if c.V == nil {
+		return nil, nil
+	}
+	v := *c.V
+	switch c.T {
+	case "s":
+		idx, err := strconv.Atoi(v)
+		if err != nil || idx < 0 || idx >= len(sharedStrings) {
+			return nil, errors.Errorf("invalid shared string index %s", v)
+		}
+		return xl.Text(sharedStrings[idx]), nil
+	case "b":
+		return v == "1" || v == "true", nil
+	case "e":
+		code, err := xl.ParseErrorCode(v)
+		if err != nil {
+			return nil, errors.Errorf("invalid error %s", v)
+		}
+		return code, nil
+	case "str":
+		// Texts computed by formulas
+		return xl.Text(v), nil
+	case "d":
+		// ISO 8601 dates
+		return v, nil
+	default:
+		num, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid number %s", v)
+		}
+		return num, nil
+	}
+}
@@ -0,0 +1,202 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/usr-ein/excelparser/xl"
+)
+
+const testWorkbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Data" sheetId="1" r:id="rId1"/><sheet name="Other sheet" sheetId="2" r:id="rId2"/></sheets>
+</workbook>`
+
+const testRelsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet2.xml"/>
+</Relationships>`
+
+const testSharedStringsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="2" uniqueCount="2">
+<si><t>hello</t></si><si><r><t>rich </t></r><r><t>text</t></r></si>
+</sst>`
+
+const testSheet1XML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1"><v>1.5</v></c><c r="C1" t="b"><v>1</v></c></row>
+<row r="3"><c r="A3" t="s"><v>1</v></c><c r="B3"><f>B1*2</f><v>3</v></c><c r="D3" t="str"><f>A1&amp;"!"</f><v>hello!</v></c></row>
+<row r="4"><c r="A4" t="inlineStr"><is><t>inline</t></is></c></row>
+</sheetData></worksheet>`
+
+const testSheet2XML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData/></worksheet>`
+
+const testSharedSheetXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1"><v>1</v></c><c r="B1"><f t="shared" ref="B1:B3" si="0">A1*$A$1+1</f><v>2</v></c></row>
+<row r="2"><c r="A2"><v>2</v></c><c r="B2"><f t="shared" si="0"/><v>3</v></c></row>
+<row r="3"><c r="A3"><v>3</v></c><c r="B3"><f t="shared" si="0"/><v>4</v></c></row>
+</sheetData></worksheet>`
+
+const testTextSharedStringsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="3" uniqueCount="3">
+<si><t>#N/A</t></si><si><t>TRUE</t></si><si><t>=x</t></si>
+</sst>`
+
+const testTextSheetXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c></row>
+<row r="2"><c r="A2" t="inlineStr"><is><t>#REF!</t></is></c><c r="B2" t="inlineStr"><is><t>false</t></is></c><c r="C2" t="str"><f>"=y"</f><v>=y</v></c></row>
+</sheetData></worksheet>`
+
+const testUnparsedSharedSheetXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1"><f t="shared" ref="A1:A2" si="0">IF(B1,(),2)</f><v>0</v></c><c r="B1"><f t="shared" ref="B1:B2" si="1">C1+1</f><v>1</v></c></row>
+<row r="2"><c r="A2"><f t="shared" si="0"/><v>2</v></c><c r="B2"><f t="shared" si="1"/><v>1</v></c></row>
+</sheetData></worksheet>`
+
+func makeXlsx(t *testing.T, parts map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zip Create failed with %s", err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("zip Write failed with %s", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip Close failed with %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	data := makeXlsx(t, map[string]string{
+		"xl/workbook.xml":            testWorkbookXML,
+		"xl/_rels/workbook.xml.rels": testRelsXML,
+		"xl/sharedStrings.xml":       testSharedStringsXML,
+		"xl/worksheets/sheet1.xml":   testSheet1XML,
+		"xl/worksheets/sheet2.xml":   testSheet2XML,
+	})
+	raw, err := Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Read failed with %s", err)
+	}
+	if len(raw.Sheets) != 2 || raw.Sheets[0].Name != "Data" || raw.Sheets[1].Name != "Other sheet" {
+		t.Fatalf("unexpected sheets %+v", raw.Sheets)
+	}
+	if len(raw.Sheets[1].Content) != 0 {
+		t.Errorf("empty sheet has content %v", raw.Sheets[1].Content)
+	}
+
+	sheet, err := raw.Sheets[0].ToSheet()
+	if err != nil {
+		t.Fatalf("ToSheet failed with %s", err)
+	}
+	expected := [][]string{
+		{"hello", "1.500", "true", "nil"},
+		{"nil", "nil", "nil", "nil"},
+		{"rich text", "=B1*2 -> 3", "nil", `=A1&"!" -> hello!`},
+		{"inline", "nil", "nil", "nil"},
+	}
+	if len(sheet.Content) != len(expected) {
+		t.Fatalf("sheet has %d rows; want %d", len(sheet.Content), len(expected))
+	}
+	for i, row := range expected {
+		for j, want := range row {
+			if got := sheet.Content[i][j].String(); got != want {
+				t.Errorf("cell (%d, %d) = %s; want %s", i, j, got, want)
+			}
+		}
+	}
+	if sheet.Content[2][1].ComputedType != xl.CTNumber {
+		t.Errorf("B3 computed type = %s; want number", sheet.Content[2][1].ComputedType)
+	}
+}
+
+func TestReadTexts(t *testing.T) {
+	data := makeXlsx(t, map[string]string{
+		"xl/workbook.xml":            testWorkbookXML,
+		"xl/_rels/workbook.xml.rels": testRelsXML,
+		"xl/sharedStrings.xml":       testTextSharedStringsXML,
+		"xl/worksheets/sheet1.xml":   testTextSheetXML,
+		"xl/worksheets/sheet2.xml":   testSheet2XML,
+	})
+	raw, err := Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Read failed with %s", err)
+	}
+	sheet, err := raw.Sheets[0].ToSheet()
+	if err != nil {
+		t.Fatalf("ToSheet failed with %s", err)
+	}
+	// Texts stay texts however they look
+	for i, row := range [][]string{{"#N/A", "TRUE", "=x"}, {"#REF!", "false"}} {
+		for j, want := range row {
+			if got := sheet.Content[i][j]; got.Type != xl.CTString || got.ValString != want {
+				t.Errorf("cell (%d, %d) = %v; want the text %s", i, j, got, want)
+			}
+		}
+	}
+	if computed := sheet.Content[1][2].Computed(); computed.Type != xl.CTString || computed.ValString != "=y" {
+		t.Errorf("C2 computed = %v; want the text =y", computed)
+	}
+}
+
+func TestReadSharedFormulas(t *testing.T) {
+	data := makeXlsx(t, map[string]string{
+		"xl/workbook.xml":            testWorkbookXML,
+		"xl/_rels/workbook.xml.rels": testRelsXML,
+		"xl/worksheets/sheet1.xml":   testSharedSheetXML,
+		"xl/worksheets/sheet2.xml":   testSheet2XML,
+	})
+	raw, err := Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Read failed with %s", err)
+	}
+	sheet, err := raw.Sheets[0].ToSheet()
+	if err != nil {
+		t.Fatalf("ToSheet failed with %s", err)
+	}
+	expected := []string{"=A1*$A$1+1 -> 2", "=A2*$A$1+1 -> 3", "=A3*$A$1+1 -> 4"}
+	for i, want := range expected {
+		if got := sheet.Content[i][1].String(); got != want {
+			t.Errorf("B%d = %s; want %s", i+1, got, want)
+		}
+	}
+}
+
+func TestReadSharedFormulaUnparsed(t *testing.T) {
+	data := makeXlsx(t, map[string]string{
+		"xl/workbook.xml":            testWorkbookXML,
+		"xl/_rels/workbook.xml.rels": testRelsXML,
+		"xl/worksheets/sheet1.xml":   testUnparsedSharedSheetXML,
+		"xl/worksheets/sheet2.xml":   testSheet2XML,
+	})
+	raw, err := Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Read failed with %s", err)
+	}
+	sheet, err := raw.Sheets[0].ToSheet()
+	if err != nil {
+		t.Fatalf("ToSheet failed with %s", err)
+	}
+	// The copy of the master the parser rejects keeps its cached value, the other shared formula is expanded
+	expected := [][]string{
+		{"=IF(B1,(),2) -> 0", "=C1+1 -> 1"},
+		{"2", "=C2+1 -> 1"},
+	}
+	for i, row := range expected {
+		for j, want := range row {
+			if got := sheet.Content[i][j].String(); got != want {
+				t.Errorf("cell (%d, %d) = %s; want %s", i, j, got, want)
+			}
+		}
+	}
+}
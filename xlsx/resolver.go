@@ -0,0 +1,61 @@
+package xlsx
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/usr-ein/excelparser/parser"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+// DirResolver loads the workbooks of external references like [Book2.xlsx]Sheet1!A1
+// from the .xlsx files of a local directory, ignoring the paths they were written with.
+// Each file is only read once.
+type DirResolver struct {
+	Dir string
+	// File names of the external links of a file, by index,
+	// for references like [1]Sheet1!A1
+	Links map[string]string
+
+	mu    sync.Mutex
+	books map[string]*xl.Workbook
+}
+
+var _ parser.WorkbookResolver = (*DirResolver)(nil)
+
+// NewDirResolver returns a resolver loading workbooks from dir.
+func NewDirResolver(dir string) *DirResolver {
+	return &DirResolver{Dir: dir, books: make(map[string]*xl.Workbook)}
+}
+
+// ResolveWorkbook loads the workbook named book, or linked as book, from the directory.
+func (r *DirResolver) ResolveWorkbook(path string, book string) (*xl.Workbook, error) {
+	if link, ok := r.Links[book]; ok {
+		book = link
+	}
+	// The written path is where the file was on the author's machine,
+	// e.g. C:\path\, so only its name matters.
+	name := filepath.Base(strings.ReplaceAll(book, `\`, "/"))
+	key := strings.ToLower(name)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if wb, ok := r.books[key]; ok {
+		return wb, nil
+	}
+	raw, err := Open(filepath.Join(r.Dir, name))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load workbook %s", book)
+	}
+	wb, err := raw.ToWorkbook()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load workbook %s", book)
+	}
+	if r.books == nil {
+		r.books = make(map[string]*xl.Workbook)
+	}
+	r.books[key] = &wb
+	return &wb, nil
+}
@@ -0,0 +1,37 @@
+package xlsx
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/usr-ein/excelparser/xl"
+)
+
+func TestDirResolver(t *testing.T) {
+	dir := t.TempDir()
+	raw := xl.RawSheet{Name: "Sheet1", Content: [][]any{{1.5, "=A1*2"}}}
+	sheet, err := raw.ToSheet()
+	if err != nil {
+		t.Fatalf("ToSheet failed with %s", err)
+	}
+	if err := Save(filepath.Join(dir, "Book2.xlsx"), xl.Workbook{Name: "Book2.xlsx", Sheets: []xl.Sheet{sheet}}); err != nil {
+		t.Fatalf("Save failed with %s", err)
+	}
+
+	r := NewDirResolver(dir)
+	r.Links = map[string]string{"1": "Book2.xlsx"}
+	for _, ref := range [][2]string{{"", "Book2.xlsx"}, {`C:\finance\`, "book2.xlsx"}, {"", "1"}} {
+		wb, err := r.ResolveWorkbook(ref[0], ref[1])
+		if err != nil {
+			t.Errorf("ResolveWorkbook(%q, %q) failed with %s", ref[0], ref[1], err)
+			continue
+		}
+		val, err := wb.Sheets[0].Get(xl.Cell{Sheet: "Sheet1", Col: 1})
+		if err != nil || val.ValFormula != "=A1*2" {
+			t.Errorf("ResolveWorkbook(%q, %q) read %+v, %v", ref[0], ref[1], val, err)
+		}
+	}
+	if _, err := r.ResolveWorkbook("", "Missing.xlsx"); err == nil {
+		t.Errorf("expected an error for a missing workbook")
+	}
+}
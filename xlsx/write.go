@@ -0,0 +1,243 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/usr-ein/excelparser/xl"
+)
+
+const (
+	nsMain          = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	nsRelationships = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	nsPackageRels   = "http://schemas.openxmlformats.org/package/2006/relationships"
+	xmlHeader       = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+)
+
+// Save writes a workbook to an .xlsx file, replacing it if it exists.
+func Save(filename string, wb xl.Workbook) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return errors.Wrap(err, "failed to create xlsx file")
+	}
+	if err := Write(f, wb); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write writes a workbook as an .xlsx file.
+//
+// Formulas are written along with their computed value if they have one,
+// and Excel is asked to recalculate them when opening the file.
+// Strings go through a shared string table, like Excel does.
+func Write(w io.Writer, wb xl.Workbook) error {
+	if len(wb.Sheets) == 0 {
+		return errors.New("workbook has no sheets")
+	}
+	zw := zip.NewWriter(w)
+	sst := newSharedStrings()
+
+	parts := []part{
+		{"[Content_Types].xml", func(w io.Writer) error { return writeContentTypes(w, len(wb.Sheets)) }},
+		{"_rels/.rels", writeRootRels},
+		{"xl/workbook.xml", func(w io.Writer) error { return writeWorkbook(w, wb) }},
+		{"xl/_rels/workbook.xml.rels", func(w io.Writer) error { return writeWorkbookRels(w, len(wb.Sheets)) }},
+	}
+	for i := range wb.Sheets {
+		sheet := &wb.Sheets[i]
+		parts = append(parts, part{sheetPart(i), func(w io.Writer) error { return writeSheet(w, sheet, sst) }})
+	}
+	// The shared strings are only known once all the sheets are written
+	parts = append(parts, part{"xl/sharedStrings.xml", sst.write})
+
+	for _, p := range parts {
+		pw, err := zw.Create(p.name)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create %s", p.name)
+		}
+		bw := bufio.NewWriter(pw)
+		if err := p.write(bw); err != nil {
+			return errors.Wrapf(err, "failed to write %s", p.name)
+		}
+		if err := bw.Flush(); err != nil {
+			return errors.Wrapf(err, "failed to write %s", p.name)
+		}
+	}
+	return zw.Close()
+}
+
+// part is a file of the .xlsx archive.
+type part struct {
+	name  string
+	write func(io.Writer) error
+}
+
+func sheetPart(i int) string {
+	return fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)
+}
+
+func writeContentTypes(w io.Writer, sheetCount int) error {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	for i := 0; i < sheetCount; i++ {
+		fmt.Fprintf(&b, `<Override PartName="/%s" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, sheetPart(i))
+	}
+	b.WriteString(`<Override PartName="/xl/sharedStrings.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sharedStrings+xml"/>`)
+	b.WriteString(`</Types>`)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeRootRels(w io.Writer) error {
+	_, err := fmt.Fprintf(w, `%s<Relationships xmlns="%s"><Relationship Id="rId1" Type="%s/officeDocument" Target="xl/workbook.xml"/></Relationships>`,
+		xmlHeader, nsPackageRels, nsRelationships)
+	return err
+}
+
+func writeWorkbook(w io.Writer, wb xl.Workbook) error {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	fmt.Fprintf(&b, `<workbook xmlns="%s" xmlns:r="%s"><sheets>`, nsMain, nsRelationships)
+	for i, s := range wb.Sheets {
+		fmt.Fprintf(&b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(s.Name), i+1, i+1)
+	}
+	b.WriteString(`</sheets><calcPr fullCalcOnLoad="1"/></workbook>`)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeWorkbookRels links the sheets as rId1 to rIdN, and the shared strings after them.
+func writeWorkbookRels(w io.Writer, sheetCount int) error {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	fmt.Fprintf(&b, `<Relationships xmlns="%s">`, nsPackageRels)
+	for i := 0; i < sheetCount; i++ {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="%s/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, nsRelationships, i+1)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="%s/sharedStrings" Target="sharedStrings.xml"/>`, sheetCount+1, nsRelationships)
+	b.WriteString(`</Relationships>`)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeSheet(w io.Writer, sheet *xl.Sheet, sst *sharedStrings) error {
+	if _, err := fmt.Fprintf(w, `%s<worksheet xmlns="%s"><sheetData>`, xmlHeader, nsMain); err != nil {
+		return err
+	}
+	var b strings.Builder
+	for i, row := range sheet.Content {
+		b.Reset()
+		for j, cell := range row {
+			address := xl.Cell{Row: uint32(i), Col: uint16(j), RowRel: true, ColRel: true}.ToAddressNoSheet()
+			writeCell(&b, string(address), cell, sst)
+		}
+		if b.Len() == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, `<row r="%d">%s</row>`, i+1, b.String()); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, `</sheetData></worksheet>`)
+	return err
+}
+
+// writeCell writes the <c> element of a cell, or nothing if it's empty.
+func writeCell(b *strings.Builder, address string, cell xl.CVal, sst *sharedStrings) {
+	switch cell.Type {
+	case xl.CTString:
+		fmt.Fprintf(b, `<c r="%s" t="s"><v>%d</v></c>`, address, sst.index(cell.ValString))
+	case xl.CTNumber:
+		fmt.Fprintf(b, `<c r="%s"><v>%s</v></c>`, address, formatNumber(cell.ValNumber))
+	case xl.CTBool:
+		fmt.Fprintf(b, `<c r="%s" t="b"><v>%s</v></c>`, address, formatBool(cell.ValBool))
+	case xl.CTError:
+		fmt.Fprintf(b, `<c r="%s" t="e"><v>%s</v></c>`, address, escape(string(cell.ValError)))
+	case xl.CTFormula:
+		formula := escape(strings.TrimPrefix(string(cell.ValFormula), "="))
+		if !cell.HasComputed {
+			fmt.Fprintf(b, `<c r="%s"><f>%s</f></c>`, address, formula)
+			return
+		}
+		switch cell.ComputedType {
+		case xl.CTString:
+			fmt.Fprintf(b, `<c r="%s" t="str"><f>%s</f><v>%s</v></c>`, address, formula, escape(cell.ValString))
+		case xl.CTNumber:
+			fmt.Fprintf(b, `<c r="%s"><f>%s</f><v>%s</v></c>`, address, formula, formatNumber(cell.ValNumber))
+		case xl.CTBool:
+			fmt.Fprintf(b, `<c r="%s" t="b"><f>%s</f><v>%s</v></c>`, address, formula, formatBool(cell.ValBool))
+		case xl.CTError:
+			fmt.Fprintf(b, `<c r="%s" t="e"><f>%s</f><v>%s</v></c>`, address, formula, escape(string(cell.ValError)))
+		default:
+			fmt.Fprintf(b, `<c r="%s"><f>%s</f></c>`, address, formula)
+		}
+	}
+}
+
+func formatNumber(n float32) string {
+	return strconv.FormatFloat(float64(n), 'g', -1, 32)
+}
+
+func formatBool(v bool) string {
+	if v {
+		return "1"
+	}
+	return "0"
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	// Writing to a strings.Builder never fails
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// sharedStrings is the workbook's shared string table, filled as the sheets are written.
+type sharedStrings struct {
+	strings []string
+	indices map[string]int
+}
+
+func newSharedStrings() *sharedStrings {
+	return &sharedStrings{indices: make(map[string]int)}
+}
+
+func (s *sharedStrings) index(str string) int {
+	if idx, ok := s.indices[str]; ok {
+		return idx
+	}
+	idx := len(s.strings)
+	s.strings = append(s.strings, str)
+	s.indices[str] = idx
+	return idx
+}
+
+func (s *sharedStrings) write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, `%s<sst xmlns="%s" uniqueCount="%d">`, xmlHeader, nsMain, len(s.strings)); err != nil {
+		return err
+	}
+	for _, str := range s.strings {
+		space := ""
+		if strings.TrimSpace(str) != str {
+			space = ` xml:space="preserve"`
+		}
+		if _, err := fmt.Fprintf(w, `<si><t%s>%s</t></si>`, space, escape(str)); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, `</sst>`)
+	return err
+}
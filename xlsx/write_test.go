@@ -0,0 +1,64 @@
+package xlsx
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/usr-ein/excelparser/xl"
+)
+
+func TestWriteRoundTrip(t *testing.T) {
+	raw := xl.RawSheet{
+		Name: "Data & more",
+		Content: [][]any{
+			{"hello", 1.5, true, " padded "},
+			{nil, "#N/A", nil, nil},
+			{"hello", "=B1*2", "=A1&\"!\"", "=C1"},
+			{"=1/0", nil, nil, nil},
+		},
+		Computed: [][]any{
+			{nil, nil, nil, nil},
+			{nil, nil, nil, nil},
+			{nil, 3, "hello!", true},
+			{xl.ErrorDiv0, nil, nil, nil},
+		},
+	}
+	sheet, err := raw.ToSheet()
+	if err != nil {
+		t.Fatalf("ToSheet failed with %s", err)
+	}
+	wb := xl.Workbook{Name: "Book1", Sheets: []xl.Sheet{sheet, {Name: "Empty"}}}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, wb); err != nil {
+		t.Fatalf("Write failed with %s", err)
+	}
+	read, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Read failed with %s", err)
+	}
+	if len(read.Sheets) != 2 || read.Sheets[0].Name != "Data & more" || read.Sheets[1].Name != "Empty" {
+		t.Fatalf("unexpected sheets %+v", read.Sheets)
+	}
+	readSheet, err := read.Sheets[0].ToSheet()
+	if err != nil {
+		t.Fatalf("ToSheet failed with %s", err)
+	}
+	if len(readSheet.Content) != len(sheet.Content) {
+		t.Fatalf("sheet has %d rows; want %d", len(readSheet.Content), len(sheet.Content))
+	}
+	for i, row := range sheet.Content {
+		for j, want := range row {
+			if got := readSheet.Content[i][j]; got != want {
+				t.Errorf("cell (%d, %d) = %s; want %s", i, j, got, want)
+			}
+		}
+	}
+}
+
+func TestWriteNoSheets(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, xl.Workbook{Name: "Book1"}); err == nil {
+		t.Errorf("expected an error for a workbook without sheets")
+	}
+}
@@ -0,0 +1,80 @@
+package xlsx
+
+import "encoding/xml"
+
+// The subset of the SpreadsheetML (ECMA-376) schema we read and write.
+// Namespaces are ignored when decoding, so the structs only use local names.
+
+type xlsxWorkbook struct {
+	XMLName xml.Name    `xml:"workbook"`
+	Sheets  []xlsxSheet `xml:"sheets>sheet"`
+}
+
+type xlsxSheet struct {
+	Name    string `xml:"name,attr"`
+	SheetID string `xml:"sheetId,attr"`
+	// Relationship id, e.g. rId1, in the r: namespace
+	RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+}
+
+type xlsxRelationships struct {
+	XMLName       xml.Name           `xml:"Relationships"`
+	Relationships []xlsxRelationship `xml:"Relationship"`
+}
+
+type xlsxRelationship struct {
+	ID     string `xml:"Id,attr"`
+	Type   string `xml:"Type,attr"`
+	Target string `xml:"Target,attr"`
+}
+
+type xlsxSST struct {
+	XMLName xml.Name `xml:"sst"`
+	Items   []xlsxSI `xml:"si"`
+}
+
+// A shared string item, either plain text or rich text made of runs.
+type xlsxSI struct {
+	T    *string   `xml:"t"`
+	Runs []xlsxRun `xml:"r"`
+}
+
+type xlsxRun struct {
+	T string `xml:"t"`
+}
+
+func (si xlsxSI) String() string {
+	if si.T != nil {
+		return *si.T
+	}
+	text := ""
+	for _, r := range si.Runs {
+		text += r.T
+	}
+	return text
+}
+
+type xlsxRow struct {
+	R     int     `xml:"r,attr"`
+	Cells []xlsxC `xml:"c"`
+}
+
+type xlsxC struct {
+	// Address, e.g. B3
+	R string `xml:"r,attr"`
+	// Type: b, d, e, inlineStr, n, s or str. Defaults to n.
+	T  string  `xml:"t,attr"`
+	F  *xlsxF  `xml:"f"`
+	V  *string `xml:"v"`
+	Is *xlsxSI `xml:"is"`
+}
+
+type xlsxF struct {
+	Text string `xml:",chardata"`
+	// Type: normal, shared or array
+	T string `xml:"t,attr"`
+	// Range covered by a shared or array formula
+	Ref string `xml:"ref,attr"`
+	// Shared formula index
+	Si *int `xml:"si,attr"`
+}